@@ -6,11 +6,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"csv-import-kit/api/internal/blob"
 	"csv-import-kit/api/internal/handlers"
+	"csv-import-kit/api/internal/jobs"
 	"csv-import-kit/api/internal/store"
+	"csv-import-kit/api/internal/webhooks"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
@@ -53,18 +58,66 @@ func main() {
 		_, _ = w.Write([]byte("ready"))
 	})
 
-	// アップロード→プレビュー
-	r.Post("/api/imports", handlers.HandleUploadPreview())
+	// /api 配下は API キー（X-API-Key）か JWT（Authorization: Bearer）必須
+	// DB アクセスはキーのワークスペースに閉じる（store.InWorkspace → RLS）
+	authn := handlers.NewAuthenticator(st, os.Getenv("API_KEY"), os.Getenv("DEFAULT_WORKSPACE_ID"))
+	authn.JWT = handlers.NewJWTVerifierFromEnv() // Supabase Auth の Bearer トークン（設定時のみ）
+	tpl := handlers.NewTemplateHandler(st)
+	mh := handlers.NewMappingHandler(st)
+	keys := handlers.NewAPIKeyHandler(st)
+	wsh := handlers.NewWorkspaceHandler(st)
+	members := handlers.NewMemberHandler(st)
+	imp := handlers.NewImportHandler(st)
+	imp.UploadDir = os.Getenv("UPLOAD_DIR") // 受信途中ファイルの置き場所（未設定なら一時ディレクトリ）
+	// 元ファイルの保存先（BLOB_BACKEND=local / s3。local で BLOB_DIR 未設定なら UPLOAD_DIR）
+	if imp.Blobs, err = blob.FromEnv(imp.UploadDir); err != nil {
+		logger.Error("failed to init blob store", "err", err)
+		os.Exit(1)
+	}
+	imp.MaxResumableBytes = int64(envInt("RESUMABLE_UPLOAD_MAX_MB", 2048)) << 20
+	audit := handlers.NewAuditHandler(st)
+	aliases := handlers.NewAliasHandler(st)
+	hooks := handlers.NewWebhookHandler(st)
+	api := &handlers.API{
+		Imports: imp, Mappings: mh, Aliases: aliases, Templates: tpl, Members: members,
+		Keys: keys, Audit: audit, Webhooks: hooks, Workspaces: wsh,
+	}
 
-	// マッピング適用（サーバ側）
-	r.Post("/api/mappings/apply", handlers.ApplyMapping)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(authn.Middleware)
+		api.Routes(r)
+	})
 
-	// テンプレート保存/一覧
-	tpl := handlers.NewTemplateHandler(st)
-	r.Post("/api/templates", tpl.CreateTemplate)
-	r.Get("/api/templates", tpl.ListTemplates)
-	r.Get("/api/templates/{id}", tpl.GetTemplateByID)
-	r.Delete("/api/templates/{id}", tpl.DeleteTemplate)
+	// ゴミ箱の定期パージ（保持期間は TEMPLATE_TRASH_RETENTION_DAYS、既定30日）
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+	retention := time.Duration(envInt("TEMPLATE_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	go tpl.RunTrashPurger(bgCtx, retention, time.Hour, logger)
+
+	// 期限切れ（24 時間チャンクが来ない）の再開可能アップロードを掃除
+	go imp.RunUploadPurger(bgCtx, 10*time.Minute, logger)
+
+	// 取り込みジョブのワーカー（並列数は JOB_WORKERS、既定2）
+	// 停止時は bgCancel の後、DB を閉じる前にワーカーの終了を待つ（実行中のジョブの再キューが閉じたプールに当たらないように）
+	var workers sync.WaitGroup
+	runner := jobs.NewRunner(st, envInt("JOB_WORKERS", 2), logger)
+	imp.RegisterJobs(runner)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runner.Run(bgCtx)
+	}()
+
+	// 進捗ストリーム（SSE）用の LISTEN import_events。停止時に購読中のストリームも閉じる
+	imp.Events = handlers.NewEventBroker(st)
+	go imp.Events.Run(bgCtx, logger)
+
+	// Webhook の配信ワーカー
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhooks.NewDispatcher(st, envInt("WEBHOOK_WORKERS", 2), logger).Run(bgCtx)
+	}()
 
 	// --- HTTP Server（タイムアウト強化 & Graceful Shutdown） ---
 	srv := &http.Server{
@@ -98,11 +151,22 @@ func main() {
 	}
 
 	// Graceful shutdown
+	bgCancel()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error("graceful shutdown failed", "err", err)
 		os.Exit(1)
 	}
+	workers.Wait()
 	logger.Info("server stopped gracefully")
 }
+
+// envInt は数値の環境変数を読む（未設定・不正値は def）
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,184 @@
+// Package blob は元ファイルなどの保存先（ローカルディスク / S3 互換 / メモリ）を切り替えるためのもの。
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound はキーが無い
+var ErrNotFound = errors.New("blob not found")
+
+// Store は key → バイト列の保存先。key は "<workspace>/imports/<id>/original" のような / 区切り
+type Store interface {
+	// Put は r を最後まで読んで保存する（size が分からなければ -1）
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get は中身を返す（呼び出し側で Close）。無ければ ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete は消す（無くてもエラーにしない）
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey は空・絶対パス・.. を含むキーを弾く
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+var errBadKey = errors.New("invalid blob key")
+
+// ===== ローカルディスク =====
+
+// Local は Root 配下にキーのままのパスで置く
+type Local struct {
+	Root string
+}
+
+func NewLocal(root string) *Local { return &Local{Root: root} }
+
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", errBadKey
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(key)), nil
+}
+
+// Put は一時ファイルに書いてから rename する（途中で失敗しても中途半端なファイルを残さない）
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // rename 後は何もしない
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ===== メモリ（テスト用） =====
+
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func NewMemory() *Memory { return &Memory{objects: map[string][]byte{}} }
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !validKey(key) {
+		return errBadKey
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = b
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Keys は保存されているキー（テストの確認用）
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.objects))
+	for k := range m.objects {
+		out = append(out, k)
+	}
+	return out
+}
+
+// ===== 環境変数から =====
+
+// FromEnv は BLOB_BACKEND（local / s3 / memory、既定 local）で保存先を作る
+// local の置き場所は BLOB_DIR（未設定なら defaultDir）。どちらも空なら nil を返す（呼び出し側の既定に任せる）
+func FromEnv(defaultDir string) (Store, error) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("BLOB_BACKEND"))) {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = defaultDir
+		}
+		if dir == "" {
+			return nil, nil
+		}
+		return NewLocal(dir), nil
+	case "memory":
+		return NewMemory(), nil
+	case "s3":
+		return S3FromEnv()
+	default:
+		return nil, errors.New("BLOB_BACKEND must be local, s3 or memory")
+	}
+}
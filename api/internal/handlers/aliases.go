@@ -0,0 +1,352 @@
+// api/internal/handlers/aliases.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// 学習した別名の重みの半減期（最後に使われてからの経過日数）
+const aliasHalfLifeDays = 90
+
+// Alias は mapping_aliases の 1 行（ヘッダ別名 -> スキーマ項目）
+type Alias struct {
+	ID          string     `json:"id"`
+	SchemaKey   string     `json:"schema_key"`
+	TargetField string     `json:"target_field"`
+	Alias       string     `json:"alias"`   // 正規化済み
+	Display     string     `json:"display"` // 元の表記
+	Hits        int        `json:"hits"`
+	Weight      float64    `json:"weight"`
+	Manual      bool       `json:"manual"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Score       float64    `json:"score"` // 参照時に計算（頻度 × 新しさ × weight）
+}
+
+// score は (1 + hits) × weight を最後に使われてからの経過で減衰させたもの
+func (a Alias) score(now time.Time) float64 {
+	seen := a.UpdatedAt
+	if a.LastSeenAt != nil {
+		seen = *a.LastSeenAt
+	}
+	days := now.Sub(seen).Hours() / 24
+	if days < 0 {
+		days = 0
+	}
+	return a.Weight * float64(1+a.Hits) * math.Pow(0.5, days/aliasHalfLifeDays)
+}
+
+// aliasKey はヘッダを別名の照合キーにする（normalizeHeaders と同じ規則）
+func aliasKey(s string) string {
+	return headerKey(s)
+}
+
+type AliasReq struct {
+	SchemaKey   string   `json:"schema_key"`
+	TargetField string   `json:"target_field"`
+	Alias       string   `json:"alias"`
+	Weight      *float64 `json:"weight,omitempty"` // 省略時 1
+}
+
+type AliasHandler struct {
+	Store *store.Store
+}
+
+func NewAliasHandler(s *store.Store) *AliasHandler {
+	return &AliasHandler{Store: s}
+}
+
+const aliasColumns = `id, schema_key, target_field, alias, display, hits, weight, manual, last_seen_at, created_at, updated_at`
+
+func scanAlias(row pgx.Row) (Alias, error) {
+	var a Alias
+	var weight float32
+	err := row.Scan(&a.ID, &a.SchemaKey, &a.TargetField, &a.Alias, &a.Display, &a.Hits, &weight, &a.Manual, &a.LastSeenAt, &a.CreatedAt, &a.UpdatedAt)
+	a.Weight = float64(weight)
+	return a, err
+}
+
+// listAliases は schemaKey（空なら全スキーマ）の別名を読む
+func listAliases(ctx context.Context, tx pgx.Tx, schemaKey, field string) ([]Alias, error) {
+	q := `select ` + aliasColumns + ` from public.mapping_aliases where ($1 = '' or schema_key = $1) and ($2 = '' or target_field = $2)`
+	rows, err := tx.Query(ctx, q, schemaKey, field)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Alias, 0)
+	for rows.Next() {
+		a, err := scanAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// GET /api/aliases?schema_key=&field=   （スコアの高い順）
+func (h *AliasHandler) ListAliases(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out []Alias
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = listAliases(ctx, tx, r.URL.Query().Get("schema_key"), r.URL.Query().Get("field"))
+		return err
+	})
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i := range out {
+		out[i].Score = out[i].score(now)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/aliases  （手動登録。既にあれば manual にして weight を更新）
+func (h *AliasHandler) CreateAlias(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeAliasReq(w, r)
+	if !ok {
+		return
+	}
+
+	const q = `
+insert into public.mapping_aliases (schema_key, target_field, alias, display, weight, manual)
+values ($1, $2, $3, $4, $5, true)
+on conflict (workspace_id, schema_key, target_field, alias)
+do update set weight = excluded.weight, display = excluded.display, manual = true
+returning ` + aliasColumns + `;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out Alias
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = scanAlias(tx.QueryRow(ctx, q, in.SchemaKey, in.TargetField, aliasKey(in.Alias), strings.TrimSpace(in.Alias), *in.Weight))
+		if err != nil {
+			return err
+		}
+		after, err := snapshotAlias(ctx, tx, out.ID)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditAliasCreate, TargetType: "alias", TargetID: out.ID, After: after,
+		})
+	})
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	out.Score = out.score(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PUT /api/aliases/{id}  （編集したものは manual になり、学習で消えなくなる）
+func (h *AliasHandler) UpdateAlias(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	in, ok := decodeAliasReq(w, r)
+	if !ok {
+		return
+	}
+
+	const q = `
+update public.mapping_aliases
+set schema_key = $2, target_field = $3, alias = $4, display = $5, weight = $6, manual = true
+where id = $1
+returning ` + aliasColumns + `;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out Alias
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotAlias(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		out, err = scanAlias(tx.QueryRow(ctx, q, id, in.SchemaKey, in.TargetField, aliasKey(in.Alias), strings.TrimSpace(in.Alias), *in.Weight))
+		if err != nil {
+			return err
+		}
+		after, err := snapshotAlias(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditAliasUpdate, TargetType: "alias", TargetID: id, Before: before, After: after,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "alias already exists for this field", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	out.Score = out.score(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DELETE /api/aliases/{id}
+// 物理削除。同じ上書きが再び確定されれば学習し直される
+func (h *AliasHandler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotAlias(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from public.mapping_aliases where id = $1`, id); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditAliasDelete, TargetType: "alias", TargetID: id, Before: before,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db delete error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeAliasReq(w http.ResponseWriter, r *http.Request) (AliasReq, bool) {
+	var in AliasReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return in, false
+	}
+	in.SchemaKey = strings.TrimSpace(in.SchemaKey)
+	in.TargetField = strings.TrimSpace(in.TargetField)
+	if in.SchemaKey == "" || in.TargetField == "" || aliasKey(in.Alias) == "" {
+		http.Error(w, "schema_key, target_field, alias are required", http.StatusBadRequest)
+		return in, false
+	}
+	if in.Weight == nil {
+		one := 1.0
+		in.Weight = &one
+	}
+	if *in.Weight < 0 {
+		http.Error(w, "weight must be >= 0", http.StatusBadRequest)
+		return in, false
+	}
+	return in, true
+}
+
+// isUniqueViolation は一意制約違反（23505）か
+func isUniqueViolation(err error) bool {
+	var pe *pgconn.PgError
+	return errors.As(err, &pe) && pe.Code == "23505"
+}
+
+func snapshotAlias(ctx context.Context, tx pgx.Tx, id string) (map[string]interface{}, error) {
+	return snapshotRow(ctx, tx, `select to_jsonb(a) from public.mapping_aliases a where id = $1 for update`, id)
+}
+
+// ===== 学習 =====
+
+type aliasPair struct {
+	Field string
+	Key   string
+}
+
+// overridePairs は確定済みの上書き（未割当以外）を (項目, 別名キー) にする
+func overridePairs(ms []ImportMapping) map[aliasPair]string {
+	out := map[aliasPair]string{}
+	for _, m := range ms {
+		if !m.IsOverride || m.Target == nil {
+			continue
+		}
+		k := aliasKey(m.Source)
+		if k == "" {
+			continue
+		}
+		out[aliasPair{Field: *m.Target, Key: k}] = m.Source
+	}
+	return out
+}
+
+// learnAliases はインポート 1 件分の上書きの増減を mapping_aliases に反映する
+// commit で確定した割当を足し（before は nil）、rollback で引く（after は nil）。before と after の両方にある組は数え直さない
+func learnAliases(ctx context.Context, tx pgx.Tx, schemaKey string, before, after []ImportMapping) error {
+	if schemaKey == "" {
+		return nil
+	}
+	prev, next := overridePairs(before), overridePairs(after)
+
+	const dec = `
+update public.mapping_aliases
+set hits = greatest(hits - 1, 0)
+where schema_key = $1 and target_field = $2 and alias = $3;
+`
+	for p := range prev {
+		if _, ok := next[p]; ok {
+			continue
+		}
+		if _, err := tx.Exec(ctx, dec, schemaKey, p.Field, p.Key); err != nil {
+			return err
+		}
+	}
+
+	const inc = `
+insert into public.mapping_aliases (schema_key, target_field, alias, display, hits, last_seen_at)
+values ($1, $2, $3, $4, 1, now())
+on conflict (workspace_id, schema_key, target_field, alias)
+do update set hits = public.mapping_aliases.hits + 1, last_seen_at = now(), display = excluded.display;
+`
+	for p, display := range next {
+		if _, ok := prev[p]; ok {
+			continue
+		}
+		if _, err := tx.Exec(ctx, inc, schemaKey, p.Field, p.Key, display); err != nil {
+			return err
+		}
+	}
+
+	// 誰も使わなくなった学習分は消す（手動のものは残す）
+	_, err := tx.Exec(ctx, `delete from public.mapping_aliases where schema_key = $1 and hits = 0 and not manual`, schemaKey)
+	return err
+}
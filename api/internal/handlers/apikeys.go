@@ -0,0 +1,230 @@
+// api/internal/handlers/apikeys.go
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyPrefix = "csvk_"
+
+type APIKey struct {
+	ID          string     `json:"id"`
+	WorkspaceID string     `json:"workspace_id"`
+	Name        string     `json:"name"`
+	KeyPrefix   string     `json:"key_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type APIKeyCreateReq struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// 省略時は呼び出し元のワークスペース。他ワークスペース向けの発行はブートストラップキーのみ
+	WorkspaceID string `json:"workspace_id,omitempty"`
+}
+
+// 平文キーはこのレスポンスでしか返さない
+type APIKeyCreateResp struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyHandler struct {
+	Store *store.Store
+}
+
+func NewAPIKeyHandler(s *store.Store) *APIKeyHandler {
+	return &APIKeyHandler{Store: s}
+}
+
+// POST /api/keys
+func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var in APIKeyCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || len(in.Scopes) == 0 {
+		http.Error(w, "name, scopes are required", http.StatusBadRequest)
+		return
+	}
+	for _, s := range in.Scopes {
+		if !validScope(s) {
+			http.Error(w, "unknown scope: "+s, http.StatusBadRequest)
+			return
+		}
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	p := PrincipalFrom(r.Context())
+	if in.WorkspaceID == "" {
+		in.WorkspaceID = p.WorkspaceID
+	}
+	// 他ワークスペース向けの発行はワークスペース作成と同じ権限が必要
+	if in.WorkspaceID != p.WorkspaceID {
+		if d := Authorize(p, ActionWorkspaceCreate); d != nil {
+			writeDenial(w, d)
+			return
+		}
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		http.Error(w, "key generation error", http.StatusInternalServerError)
+		return
+	}
+
+	const q = `
+insert into public.api_keys (workspace_id, name, key_prefix, key_hash, scopes, expires_at)
+values ($1, $2, $3, $4, $5, $6)
+returning id, created_at;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := APIKeyCreateResp{
+		APIKey: APIKey{
+			WorkspaceID: in.WorkspaceID,
+			Name:        in.Name,
+			KeyPrefix:   key[:len(apiKeyPrefix)+4],
+			Scopes:      in.Scopes,
+			ExpiresAt:   in.ExpiresAt,
+		},
+		Key: key,
+	}
+	// 監査ログは発行した側のワークスペースに残す（key_hash は載せない）
+	err = pgx.BeginFunc(ctx, h.Store.Pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, q, out.WorkspaceID, out.Name, out.KeyPrefix, hashAPIKey(key), out.Scopes, out.ExpiresAt).Scan(&out.ID, &out.CreatedAt); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, p, auditRecord{
+			Action: AuditAPIKeyCreate, TargetType: "api_key", TargetID: out.ID,
+			After: map[string]interface{}{
+				"workspace_id": out.WorkspaceID, "name": out.Name, "key_prefix": out.KeyPrefix,
+				"scopes": out.Scopes, "expires_at": out.ExpiresAt,
+			},
+		})
+	})
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/keys  （呼び出し元ワークスペースのキーのみ）
+// api_keys は認証前に引くためテナントロールの対象外。ワークスペースは明示的に絞る
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	const q = `
+select id, workspace_id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+from public.api_keys
+where workspace_id = $1
+order by created_at desc;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.Store.Pool.Query(ctx, q, workspaceID(r))
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]APIKey, 0)
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.WorkspaceID, &k.Name, &k.KeyPrefix, &k.Scopes, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt); err != nil {
+			http.Error(w, "db scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, k)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "db rows error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DELETE /api/keys/{id}
+// 行は残して失効させる（監査ログの actor を辿れるように）
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	const q = `
+update public.api_keys
+set revoked_at = now()
+where id = $1 and workspace_id = $2 and revoked_at is null
+returning name;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, h.Store.Pool, func(tx pgx.Tx) error {
+		var name string
+		if err := tx.QueryRow(ctx, q, id, workspaceID(r)).Scan(&name); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditAPIKeyRevoke, TargetType: "api_key", TargetID: id,
+			Extra: map[string]interface{}{"name": name},
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validScope(s string) bool {
+	for _, v := range AllScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAPIKey は "csvk_" + 32byte 乱数（base64url）を返す
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,423 @@
+// api/internal/handlers/archive.go
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"csv-import-kit/api/internal/spreadsheet"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// zip の展開の上限（zip bomb 対策。宣言されたサイズは信用せず、実際に展開したバイト数で数える）
+const (
+	maxArchiveEntries = 200
+	maxArchiveBytes   = 200 << 20 // 全エントリの展開後の合計
+	maxArchiveRatio   = 200       // 1 エントリの展開後 / 圧縮後
+	archiveRatioFloor = 1 << 20   // これ以下の小さいエントリは比率を見ない
+)
+
+var (
+	errArchiveTooLarge = fmt.Errorf("archive expands to more than %d MB", maxArchiveBytes>>20)
+	errArchiveRatio    = fmt.Errorf("archive entry exceeds the compression ratio limit (%d:1)", maxArchiveRatio)
+)
+
+// archiveEntry は zip の中の 1 ファイル
+type archiveEntry struct {
+	Name           string `json:"name"`
+	Size           int64  `json:"size"` // 展開後のバイト数
+	CompressedSize int64  `json:"compressedSize"`
+	// Fingerprint は正規化したヘッダのハッシュ（同じ値のエントリは merge で 1 つの取り込みになる）
+	Fingerprint string `json:"fingerprint,omitempty"`
+	ImportID    string `json:"importId,omitempty"`
+	Skipped     string `json:"skipped,omitempty"` // 取り込まなかった理由
+
+	file    *zip.File
+	opts    *ParseOptions
+	preview previewResponse
+}
+
+// archiveImport は zip から作った取り込み 1 件（merge なら複数エントリ）
+type archiveImport struct {
+	Filename string   `json:"filename"`
+	Entries  []string `json:"entries"`
+	Error    string   `json:"error,omitempty"` // 保存できなかった理由（importId は空）
+	previewResponse
+
+	src   importSource
+	group []int // resp.Entries の添字
+}
+
+type archiveResponse struct {
+	Archive string          `json:"archive"`
+	Mode    string          `json:"mode"` // list / separate / merge
+	Entries []archiveEntry  `json:"entries"`
+	Imports []archiveImport `json:"imports"`
+}
+
+// isArchiveUpload は zip のアップロードか（.ods も中身は zip なので除く）
+func isArchiveUpload(filename, contentType string, b []byte) bool {
+	if spreadsheet.IsODS(b) {
+		return false
+	}
+	ct := strings.ToLower(contentType)
+	return strings.EqualFold(path.Ext(filename), ".zip") ||
+		strings.HasPrefix(ct, "application/zip") || strings.HasPrefix(ct, "application/x-zip-compressed")
+}
+
+// uploadArchive は POST /api/imports に来た zip を扱う
+// フォーム項目 archive: list（中身の一覧だけ）/ separate（既定、エントリごとに取り込み）/ merge（同じヘッダのエントリを連結）
+func (h *ImportHandler) uploadArchive(w http.ResponseWriter, r *http.Request, filename string, data []byte, opts *ParseOptions) {
+	mode := r.FormValue("archive")
+	switch mode {
+	case "":
+		mode = "separate"
+	case "list", "separate", "merge":
+	default:
+		http.Error(w, "archive must be list, separate or merge", http.StatusBadRequest)
+		return
+	}
+
+	entries, status, err := inspectArchive(data, opts)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	resp := archiveResponse{Archive: filename, Mode: mode, Entries: entries, Imports: []archiveImport{}}
+	if mode == "list" {
+		writeArchiveResponse(w, resp)
+		return
+	}
+
+	// 取り込む単位（separate は 1 エントリずつ、merge は指紋ごと）
+	var groups [][]int
+	byPrint := map[string]int{}
+	for i, e := range entries {
+		if e.Skipped != "" {
+			continue
+		}
+		if g, ok := byPrint[e.Fingerprint]; ok && mode == "merge" {
+			groups[g] = append(groups[g], i)
+			continue
+		}
+		byPrint[e.Fingerprint] = len(groups)
+		groups = append(groups, []int{i})
+	}
+
+	base := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	for gi, g := range groups {
+		first := &entries[g[0]]
+		src := importSource{Filename: first.Name, Size: first.Size, Options: first.opts, Archive: filename}
+		pv := first.preview
+		if len(g) == 1 {
+			f := first.file
+			src.open = func() (io.ReadCloser, error) { return openArchiveEntry(f) }
+		} else {
+			src.Filename = fmt.Sprintf("%s_merged_%d.csv", base, gi+1)
+			src.ContentType = "text/csv"
+			// 元の表記から同じキーを作るので headerKeys は先頭のエントリに合わせる
+			src.Options = &ParseOptions{Format: "csv", Delimiter: ",", HeaderRow: new(int)}
+			if first.opts != nil {
+				src.Options.HeaderKeys = first.opts.HeaderKeys
+			}
+			// ヘッダ行は先頭のエントリの元の表記にする（original で書いたルールが当たるように）
+			// 読み直して同じキーにならなければ、正規化したキーで書き直す
+			var merged []byte
+			for _, headers := range [][]string{originalLabels(first.preview), first.preview.Headers} {
+				var err error
+				if merged, err = mergeArchiveEntries(entries, g, headers); err != nil {
+					http.Error(w, err.Error(), archiveErrorStatus(err))
+					return
+				}
+				if pv, err = buildPreviewWith(bytes.NewReader(merged), src.Options); err != nil {
+					http.Error(w, "csv parse error: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				if slices.Equal(pv.Headers, first.preview.Headers) {
+					break
+				}
+			}
+			src.Size = int64(len(merged))
+			src.open = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(merged)), nil }
+		}
+		names := make([]string, len(g))
+		for i, ei := range g {
+			names[i] = entries[ei].Name
+		}
+		src.Entries = names
+		resp.Imports = append(resp.Imports, archiveImport{Filename: src.Filename, Entries: names, previewResponse: pv, src: src, group: g})
+	}
+
+	// 保存（Store が無い＝テスト時はプレビューのみ）
+	// 読み取りは上で全部済ませてあるので、ここで失敗するのは保存だけ。1 件ずつのトランザクションなので、
+	// 失敗しても作れた分はそのまま返し、作れなかった分に error を付ける（一部だけなら 207、全部なら 500）
+	if h.Store != nil {
+		failed := 0
+		for i := range resp.Imports {
+			imp := &resp.Imports[i]
+			ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+			id, jobID, err := h.createImport(ctx, r, imp.src, &imp.previewResponse)
+			cancel()
+			if err != nil {
+				slog.Error("archive import failed", "archive", filename, "filename", imp.Filename, "err", err)
+				imp.Error = "db insert error"
+				failed++
+				continue
+			}
+			imp.ImportID, imp.JobID = id, jobID
+			for _, ei := range imp.group {
+				resp.Entries[ei].ImportID = id
+			}
+		}
+		switch {
+		case failed > 0 && failed == len(resp.Imports):
+			http.Error(w, "db insert error", http.StatusInternalServerError)
+			return
+		case failed > 0:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusMultiStatus)
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+	}
+	writeArchiveResponse(w, resp)
+}
+
+func writeArchiveResponse(w http.ResponseWriter, resp archiveResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func archiveErrorStatus(err error) int {
+	if errors.Is(err, errArchiveTooLarge) || errors.Is(err, errArchiveRatio) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// inspectArchive はエントリを一通り展開してプレビューと指紋を作る（取り込みを作る前に上限をすべて確かめる）
+// 読めないエントリは Skipped に理由を入れて残し、上限超え・危険なパスは zip 全体をエラーにする
+func inspectArchive(data []byte, opts *ParseOptions) ([]archiveEntry, int, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("invalid zip archive")
+	}
+	if len(zr.File) > maxArchiveEntries {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+	}
+	var total int64
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		name := archiveEntryName(f)
+		if !safeArchivePath(name) {
+			return nil, http.StatusBadRequest, fmt.Errorf("unsafe path in archive: %q", name)
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		e := archiveEntry{Name: name, Size: int64(f.UncompressedSize64), CompressedSize: int64(f.CompressedSize64), file: f}
+		base := path.Base(name)
+		switch {
+		case strings.HasPrefix(name, "__MACOSX/"), strings.HasPrefix(base, "._"), base == ".DS_Store", base == "Thumbs.db":
+			continue // OS が作る付随ファイル
+		case f.Flags&0x1 != 0:
+			e.Skipped = "encrypted entry"
+		case strings.EqualFold(path.Ext(base), ".zip"):
+			e.Skipped = "nested archive"
+		}
+		if e.Skipped != "" {
+			entries = append(entries, e)
+			continue
+		}
+		if total+e.Size > maxArchiveBytes {
+			return nil, http.StatusRequestEntityTooLarge, errArchiveTooLarge
+		}
+
+		e.opts = opts
+		if e.opts == nil {
+			e.opts = formatFromUpload(base, "")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s: %v", name, err)
+		}
+		lr := &archiveReader{r: rc, compressed: e.CompressedSize, budget: maxArchiveBytes - total}
+		pv, perr := buildPreviewWith(lr, e.opts)
+		if perr == nil || !isArchiveLimit(perr) {
+			// 途中で止まっても全体を数える（サイズと上限の確認）
+			_, err = io.Copy(io.Discard, lr)
+		}
+		rc.Close()
+		switch {
+		case isArchiveLimit(perr):
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s: %w", name, perr)
+		case err != nil && isArchiveLimit(err):
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("%s: %w", name, err)
+		case err != nil:
+			return nil, http.StatusBadRequest, fmt.Errorf("%s: %v", name, err)
+		}
+		e.Size = lr.n
+		total += lr.n
+		if perr != nil {
+			e.Skipped = "parse error: " + perr.Error()
+		} else if len(pv.Headers) == 0 {
+			e.Skipped = "empty file"
+		} else {
+			e.preview = pv
+			e.Fingerprint = headerFingerprint(pv)
+		}
+		entries = append(entries, e)
+	}
+	return entries, 0, nil
+}
+
+func isArchiveLimit(err error) bool {
+	return errors.Is(err, errArchiveTooLarge) || errors.Is(err, errArchiveRatio)
+}
+
+// archiveEntryName は UTF-8 フラグの無い名前（日本語版 Windows の zip は Shift_JIS）を UTF-8 にし、区切りを / にそろえる
+func archiveEntryName(f *zip.File) string {
+	name := f.Name
+	if !utf8.ValidString(name) {
+		if s, err := japanese.ShiftJIS.NewDecoder().String(name); err == nil {
+			name = s
+		}
+	}
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// safeArchivePath は絶対パス・ドライブ名・.. を含まない相対パスか（展開はしないが、名前は保存・表示に使う）
+func safeArchivePath(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return false
+	}
+	if len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// headerFingerprint はヘッダ（正規化済み）とヘッダ行の有無から作る指紋
+func headerFingerprint(pv previewResponse) string {
+	s := sha256.Sum256([]byte(fmt.Sprintf("%t\x1f%s", pv.HasHeader, strings.Join(pv.Headers, "\x1f"))))
+	return hex.EncodeToString(s[:8])
+}
+
+// archiveReader は展開したバイト数を数え、合計の残りと圧縮率の上限を超えたら止める
+type archiveReader struct {
+	r          io.Reader
+	n          int64
+	compressed int64
+	budget     int64
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.n += int64(n)
+	if a.n > a.budget {
+		return n, errArchiveTooLarge
+	}
+	if a.n > archiveRatioFloor && a.n > a.compressed*maxArchiveRatio {
+		return n, errArchiveRatio
+	}
+	return n, err
+}
+
+// openArchiveEntry は取り込み時の読み直し（inspectArchive で確かめた上限をもう一度かける）
+func openArchiveEntry(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	lr := &archiveReader{r: rc, compressed: int64(f.CompressedSize64), budget: maxArchiveBytes}
+	return struct {
+		io.Reader
+		io.Closer
+	}{lr, rc}, nil
+}
+
+// originalLabels はプレビューの列の元の表記（ヘッダなしの列は正規化したキー）
+func originalLabels(pv previewResponse) []string {
+	out := make([]string, len(pv.Headers))
+	for i, h := range pv.Headers {
+		out[i] = h
+		if i < len(pv.Columns) && pv.Columns[i].Original != "" {
+			out[i] = pv.Columns[i].Original
+		}
+	}
+	return out
+}
+
+// mergeArchiveEntries は同じ指紋のエントリを 1 つの CSV（UTF-8、カンマ区切り、先頭がヘッダ）にする
+// headers はヘッダ行（先頭のエントリの元の表記か、正規化したキー）
+func mergeArchiveEntries(entries []archiveEntry, group []int, headers []string) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.Write(headers); err != nil {
+		return nil, err
+	}
+	for _, ei := range group {
+		e := entries[ei]
+		rc, err := openArchiveEntry(e.file)
+		if err != nil {
+			return nil, err
+		}
+		err = func() error {
+			defer rc.Close()
+			rr, _, err := openRecords(rc, e.opts)
+			if err != nil {
+				return err
+			}
+			skip := e.preview.dataOffset
+			for {
+				rec, err := rr.Read()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if skip > 0 {
+					skip--
+					continue
+				}
+				// JSON は途中で列が増えるので、前の行は足りない分を空にする
+				if len(rec) < len(headers) {
+					rec = append(rec, make([]string, len(headers)-len(rec))...)
+				}
+				if err := cw.Write(rec); err != nil {
+					return err
+				}
+				if buf.Len() > maxArchiveBytes {
+					return errArchiveTooLarge
+				}
+			}
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"csv-import-kit/api/internal/blob"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+type zipEntry struct {
+	name string
+	body string
+}
+
+func zipBytes(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, NonUTF8: !utf8.ValidString(e.name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func postArchive(t *testing.T, data []byte, mode string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postArchiveTo(&ImportHandler{}, nil, data, mode)
+}
+
+func postArchiveTo(h *ImportHandler, p *Principal, data []byte, mode string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "vendor.zip")
+	_, _ = fw.Write(data)
+	if mode != "" {
+		_ = mw.WriteField("archive", mode)
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/imports", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if p != nil {
+		req = req.WithContext(withPrincipal(req.Context(), p))
+	}
+	w := httptest.NewRecorder()
+	h.UploadPreview(w, req)
+	return w
+}
+
+// failingBlobs は fail が true を返す Put だけ失敗する
+type failingBlobs struct {
+	blob.Store
+	fail func(key string) bool
+}
+
+func (f failingBlobs) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if f.fail(key) {
+		return errors.New("blob unavailable")
+	}
+	return f.Store.Put(ctx, key, r, size)
+}
+
+func TestUploadArchive(t *testing.T) {
+	sjisName, _ := japanese.ShiftJIS.NewEncoder().String("関西/2024-02.csv")
+	data := zipBytes(t,
+		zipEntry{"east/2024-01.csv", "Region,Amount\neast,100\neast,200\n"},
+		zipEntry{"__MACOSX/east/._2024-01.csv", "junk"},
+		zipEntry{sjisName, "region,amount\nkansai,300\n"},
+		zipEntry{"customers.csv", "id,name,email\n1,Taro,taro@example.com\n"},
+		zipEntry{"inner.zip", "PK"},
+	)
+
+	// list は中身の一覧だけ
+	w := postArchive(t, data, "list")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp archiveResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range resp.Entries {
+		names = append(names, e.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"east/2024-01.csv", "関西/2024-02.csv", "customers.csv", "inner.zip"}) {
+		t.Fatalf("entries = %q", names)
+	}
+	if resp.Entries[0].Size != 32 || resp.Entries[3].Skipped != "nested archive" || len(resp.Imports) != 0 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if resp.Entries[0].Fingerprint != resp.Entries[1].Fingerprint || resp.Entries[0].Fingerprint == resp.Entries[2].Fingerprint {
+		t.Fatalf("fingerprints = %+v", resp.Entries)
+	}
+
+	// separate はエントリごと
+	resp = archiveResponse{}
+	w = postArchive(t, data, "")
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Mode != "separate" || len(resp.Imports) != 3 {
+		t.Fatalf("resp = %+v", resp)
+	}
+
+	// merge は同じヘッダ（正規化後）を 1 つの CSV にまとめる
+	resp = archiveResponse{}
+	w = postArchive(t, data, "merge")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Imports) != 2 {
+		t.Fatalf("imports = %+v", resp.Imports)
+	}
+	m := resp.Imports[0]
+	if m.Filename != "vendor_merged_1.csv" || m.RowCount != 3 || !reflect.DeepEqual(m.Entries, []string{"east/2024-01.csv", "関西/2024-02.csv"}) {
+		t.Fatalf("merged = %+v", m)
+	}
+	if !reflect.DeepEqual(m.SampleRows, [][]string{{"east", "100"}, {"east", "200"}, {"kansai", "300"}}) {
+		t.Fatalf("rows = %q", m.SampleRows)
+	}
+	// 元の表記（先頭のエントリのもの）が残る。original で書いたルールが合わさった取り込みにも当たる
+	if len(m.Columns) != 2 || m.Columns[0].Original != "Region" || m.Columns[1].Original != "Amount" ||
+		!reflect.DeepEqual(m.Headers, []string{"region", "amount"}) {
+		t.Fatalf("columns = %+v, headers = %q", m.Columns, m.Headers)
+	}
+}
+
+func TestUploadArchiveLimits(t *testing.T) {
+	// パスの外に出る名前は zip 全体を拒否
+	w := postArchive(t, zipBytes(t, zipEntry{"../../etc/passwd.csv", "a,b\n1,2\n"}), "list")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("traversal status = %d: %s", w.Code, w.Body)
+	}
+
+	// 圧縮率の高すぎるエントリ（zip bomb）
+	bomb := "a,b\n" + strings.Repeat("0,0\n", 2<<20)
+	w = postArchive(t, zipBytes(t, zipEntry{"bomb.csv", bomb}), "list")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bomb status = %d: %s", w.Code, w.Body)
+	}
+
+	if w := postArchive(t, []byte("not a zip"), ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid zip status = %d", w.Code)
+	}
+	for _, name := range []string{"a/../../b.csv", "/abs.csv", `C:\x.csv`} {
+		if safeArchivePath(strings.ReplaceAll(name, `\`, "/")) {
+			t.Errorf("%q should be unsafe", name)
+		}
+	}
+}
+
+func TestUploadArchivePartialFailure(t *testing.T) {
+	st, ws := testWorkspace(t, "archive-partial")
+	puts := 0
+	h := &ImportHandler{Store: st, Blobs: failingBlobs{Store: blob.NewMemory(), fail: func(string) bool { puts++; return puts == 2 }}}
+	data := zipBytes(t,
+		zipEntry{"a.csv", "id,name\n1,Taro\n"},
+		zipEntry{"b.csv", "id,name\n2,Hanako\n"},
+		zipEntry{"c.csv", "id,name\n3,Jiro\n"},
+	)
+	w := postArchiveTo(h, &Principal{WorkspaceID: ws, Name: "test"}, data, "separate")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp archiveResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 作れた分は ID 付きで、作れなかった分は error 付きで返る
+	if len(resp.Imports) != 3 || resp.Imports[0].ImportID == "" || resp.Imports[2].ImportID == "" ||
+		resp.Imports[1].ImportID != "" || resp.Imports[1].Error == "" || resp.Entries[1].ImportID != "" || resp.Entries[2].ImportID == "" {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
@@ -0,0 +1,334 @@
+// api/internal/handlers/audit.go
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 監査ログの action（import_audit_logs.action）
+const (
+	AuditTemplateCreate  = "template.create"
+	AuditTemplateUpdate  = "template.update"
+	AuditTemplateDelete  = "template.delete"
+	AuditTemplateRestore = "template.restore"
+	AuditImportUpload    = "import.upload"
+	AuditImportReparse   = "import.reparse"
+	AuditImportValidate  = "import.validate"
+	AuditImportCommit    = "import.commit"
+	AuditImportRollback  = "import.rollback"
+	AuditImportFailed    = "import.failed"
+	AuditMappingUpdate   = "mapping.update"
+	AuditAliasCreate     = "alias.create"
+	AuditAliasUpdate     = "alias.update"
+	AuditAliasDelete     = "alias.delete"
+	AuditAPIKeyCreate    = "apikey.create"
+	AuditAPIKeyRevoke    = "apikey.revoke"
+	AuditMemberUpsert    = "member.upsert"
+	AuditMemberDelete    = "member.delete"
+	AuditWebhookCreate   = "webhook.create"
+	AuditWebhookUpdate   = "webhook.update"
+	AuditWebhookDelete   = "webhook.delete"
+)
+
+// auditRecord は import_audit_logs に書く 1 件
+type auditRecord struct {
+	Action     string
+	ImportID   *string
+	TargetType string // "template" / "import" / "api_key" / "member"
+	TargetID   string
+	Before     map[string]interface{} // 変更前（作成時は nil）
+	After      map[string]interface{} // 変更後（削除時は nil）
+	Extra      map[string]interface{} // 件数など補足
+}
+
+// writeAudit は変更と同じトランザクションで監査ログを追記する（失敗したら変更ごとロールバックさせる）
+// workspace_id は明示する（テナントロール外のトランザクションからも呼ぶため）
+func writeAudit(ctx context.Context, tx pgx.Tx, p *Principal, rec auditRecord) error {
+	return writeAuditAs(ctx, tx, p.WorkspaceID, p.Actor(), rec)
+}
+
+// writeAuditAs はリクエスト外（ジョブ）から書く版。actor はジョブを投入した人
+func writeAuditAs(ctx context.Context, tx pgx.Tx, workspaceID, actor string, rec auditRecord) error {
+	md := map[string]interface{}{
+		"target": map[string]string{"type": rec.TargetType, "id": rec.TargetID},
+	}
+	if rec.Before != nil {
+		md["before"] = rec.Before
+	}
+	if rec.After != nil {
+		md["after"] = rec.After
+	}
+	if rec.Before != nil && rec.After != nil {
+		md["diff"] = diffSnapshots(rec.Before, rec.After)
+	}
+	for k, v := range rec.Extra {
+		md[k] = v
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	const q = `
+insert into public.import_audit_logs (workspace_id, import_id, action, actor, metadata)
+values ($1, $2, $3, $4, $5::jsonb);
+`
+	_, err = tx.Exec(ctx, q, workspaceID, rec.ImportID, rec.Action, nullIfEmpty(actor), string(b))
+	return err
+}
+
+// diffSnapshots は変更のあったキーだけ {before, after} で返す
+func diffSnapshots(before, after map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	keys := map[string]struct{}{}
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		// updated_at は毎回変わるだけなので差分に含めない
+		if k == "updated_at" {
+			continue
+		}
+		if !reflect.DeepEqual(before[k], after[k]) {
+			out[k] = map[string]interface{}{"before": before[k], "after": after[k]}
+		}
+	}
+	return out
+}
+
+// snapshotRow は "select to_jsonb(t) ..." の結果を map にする（行ロックは呼び出し側の SQL で）
+func snapshotRow(ctx context.Context, tx pgx.Tx, q string, args ...interface{}) (map[string]interface{}, error) {
+	var raw []byte
+	if err := tx.QueryRow(ctx, q, args...).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	delete(m, "workspace_id")
+	return m, nil
+}
+
+// ===== GET /api/audit =====
+
+type AuditLog struct {
+	ID        int64           `json:"id"`
+	ImportID  *string         `json:"import_id,omitempty"`
+	Action    string          `json:"action"`
+	Actor     *string         `json:"actor,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type AuditListResp struct {
+	Items      []AuditLog `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"` // 次ページは ?cursor=<この値>
+}
+
+type AuditHandler struct {
+	Store *store.Store
+}
+
+func NewAuditHandler(s *store.Store) *AuditHandler {
+	return &AuditHandler{Store: s}
+}
+
+// GET /api/audit?import_id=&actor=&action=&since=&limit=&cursor=
+// ?format=csv（または Accept: text/csv）でフィルタに合う全件を CSV で返す
+func (h *AuditHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	where := []string{"true"}
+	args := []interface{}{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if v := qs.Get("import_id"); v != "" {
+		if !isUUID(v) {
+			http.Error(w, "import_id must be a UUID", http.StatusBadRequest)
+			return
+		}
+		add("import_id = ?", v)
+	}
+	if v := qs.Get("actor"); v != "" {
+		add("actor = ?", v)
+	}
+	if v := qs.Get("action"); v != "" {
+		// "template." のように末尾ドットなら前方一致
+		if strings.HasSuffix(v, ".") {
+			add("action like ?", v+"%")
+		} else {
+			add("action = ?", v)
+		}
+	}
+	if v := qs.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		add("created_at >= ?", t)
+	}
+
+	asCSV := qs.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv")
+	limit := 50
+	if !asCSV {
+		if v := qs.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 500 {
+				http.Error(w, "limit must be 1..500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if v := qs.Get("cursor"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			add("id < ?", id)
+		}
+	}
+
+	q := `
+select id, import_id, action, actor, metadata, created_at
+from public.import_audit_logs
+where ` + strings.Join(where, " and ") + `
+order by id desc`
+	if !asCSV {
+		// 1 件多く取って次ページの有無を判定
+		q += " limit " + strconv.Itoa(limit+1)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if asCSV {
+		h.exportCSV(ctx, w, r, q, args)
+		return
+	}
+
+	items := make([]AuditLog, 0, limit)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var a AuditLog
+			if err := rows.Scan(&a.ID, &a.ImportID, &a.Action, &a.Actor, &a.Metadata, &a.CreatedAt); err != nil {
+				return err
+			}
+			items = append(items, a)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	out := AuditListResp{Items: items}
+	if len(items) > limit {
+		out.Items = items[:limit]
+		out.NextCursor = strconv.FormatInt(items[limit-1].ID, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// exportCSV は行を読みながらそのまま書き出す（件数が多くてもメモリに溜めない）
+func (h *AuditHandler) exportCSV(ctx context.Context, w http.ResponseWriter, r *http.Request, q string, args []interface{}) {
+	started := false
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		started = true
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "created_at", "action", "actor", "import_id", "metadata"})
+		for rows.Next() {
+			var a AuditLog
+			if err := rows.Scan(&a.ID, &a.ImportID, &a.Action, &a.Actor, &a.Metadata, &a.CreatedAt); err != nil {
+				return err
+			}
+			_ = cw.Write([]string{
+				strconv.FormatInt(a.ID, 10),
+				a.CreatedAt.UTC().Format(time.RFC3339),
+				csvCell(a.Action),
+				csvCell(derefString(a.Actor)),
+				csvCell(derefString(a.ImportID)),
+				csvCell(string(a.Metadata)),
+			})
+		}
+		cw.Flush()
+		return rows.Err()
+	})
+	if err != nil && !started {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+	}
+}
+
+// csvCell は表計算ソフトで数式として解釈される値の先頭に ' を付ける（CSV インジェクション対策）
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// isUUID は 8-4-4-4-12 の 16 進表記か（DB のキャストで 500 にしないよう先に 400 にする）
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := map[string]interface{}{"name": "a", "rules": map[string]interface{}{"x": "X"}, "updated_at": "t1", "gone": 1.0}
+	after := map[string]interface{}{"name": "b", "rules": map[string]interface{}{"x": "X"}, "updated_at": "t2", "added": true}
+
+	got := diffSnapshots(before, after)
+	want := map[string]interface{}{
+		"name":  map[string]interface{}{"before": "a", "after": "b"},
+		"gone":  map[string]interface{}{"before": 1.0, "after": nil},
+		"added": map[string]interface{}{"before": nil, "after": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	cases := map[string]string{
+		"":                  "",
+		"import.commit":     "import.commit",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-2":                "'-2",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\tx":               "'\tx",
+		"\rx":               "'\rx",
+		"key:a=b":           "key:a=b",
+	}
+	for in, want := range cases {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	for s, want := range map[string]bool{
+		"3f1c2a9e-5b7d-4c1e-9a2b-0123456789ab": true,
+		"3F1C2A9E-5B7D-4C1E-9A2B-0123456789AB": true,
+		"3f1c2a9e5b7d4c1e9a2b0123456789ab":     false,
+		"3f1c2a9e-5b7d-4c1e-9a2b-0123456789ag": false,
+		"x":                                    false,
+	} {
+		if got := isUUID(s); got != want {
+			t.Errorf("isUUID(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestListAudit(t *testing.T) {
+	st, ws := testWorkspace(t, "audit-list")
+	ctx := context.Background()
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `insert into public.imports (status, original_filename) values ('uploaded', 'a.csv') returning id`).Scan(&importID); err != nil {
+			return err
+		}
+		recs := []struct {
+			actor string
+			rec   auditRecord
+		}{
+			{"user:a", auditRecord{Action: AuditTemplateCreate, TargetType: "template", TargetID: "t1"}},
+			{"user:a", auditRecord{Action: AuditTemplateUpdate, TargetType: "template", TargetID: "t1"}},
+			{"=cmd|' /C calc'!A0", auditRecord{Action: AuditImportUpload, ImportID: &importID, TargetType: "import", TargetID: importID}},
+		}
+		for _, r := range recs {
+			if err := writeAuditAs(ctx, tx, ws, r.actor, r.rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAuditHandler(st)
+	list := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/audit?"+query, nil)
+		req = req.WithContext(withPrincipal(req.Context(), &Principal{WorkspaceID: ws, Name: "test"}))
+		rec := httptest.NewRecorder()
+		h.ListAudit(rec, req)
+		return rec
+	}
+	page := func(query string) AuditListResp {
+		t.Helper()
+		rec := list(query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+		var out AuditListResp
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if rec := list("import_id=not-a-uuid"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad import_id: %d", rec.Code)
+	}
+	if got := page("import_id=" + importID); len(got.Items) != 1 || got.Items[0].Action != AuditImportUpload {
+		t.Fatalf("import_id filter: %+v", got)
+	}
+	if got := page("action=template."); len(got.Items) != 2 {
+		t.Fatalf("action prefix filter: %+v", got)
+	}
+	if got := page("actor=user:a&action=template.update"); len(got.Items) != 1 {
+		t.Fatalf("actor + action filter: %+v", got)
+	}
+
+	// 新しい順に 2 件ずつ
+	first := page("limit=2")
+	if len(first.Items) != 2 || first.NextCursor == "" || first.Items[0].Action != AuditImportUpload {
+		t.Fatalf("first page: %+v", first)
+	}
+	second := page("limit=2&cursor=" + first.NextCursor)
+	if len(second.Items) != 1 || second.NextCursor != "" || second.Items[0].Action != AuditTemplateCreate {
+		t.Fatalf("second page: %+v", second)
+	}
+
+	rec := list("format=csv")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][2] != "action" || rows[1][2] != AuditImportUpload {
+		t.Fatalf("csv rows: %q", rows)
+	}
+	if rows[1][3] != "'=cmd|' /C calc'!A0" || rows[1][4] != importID {
+		t.Fatalf("csv cells should be escaped: %q", rows[1])
+	}
+}
@@ -0,0 +1,269 @@
+// api/internal/handlers/auth.go
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// API キーのスコープ
+const (
+	ScopeTemplatesRead  = "templates:read"
+	ScopeTemplatesWrite = "templates:write"
+	ScopeImportsWrite   = "imports:write"
+	ScopeImportsCommit  = "imports:commit"
+	ScopeKeysAdmin      = "keys:admin" // API キーの発行/失効
+	ScopeAuditRead      = "audit:read"
+	ScopeFeedbackRead   = "feedback:read" // マッピング学習データの書き出し
+	ScopeWebhooksAdmin  = "webhooks:admin"
+)
+
+// AllScopes は発行時に指定できるスコープ一覧
+var AllScopes = []string{
+	ScopeTemplatesRead,
+	ScopeTemplatesWrite,
+	ScopeImportsWrite,
+	ScopeImportsCommit,
+	ScopeKeysAdmin,
+	ScopeAuditRead,
+	ScopeFeedbackRead,
+	ScopeWebhooksAdmin,
+}
+
+// Principal は認証済みの呼び出し元（API キー or JWT ユーザ）
+type Principal struct {
+	KeyID       string   // api_keys.id（ブートストラップキー・JWT は空）
+	UserID      string   // JWT の sub
+	AuthRole    string   // JWT の role（Supabase の authenticated など）
+	Role        Role     // ワークスペース内ロール（ユーザのみ。API キーは Scopes で判定）
+	Name        string   // キー名 or メールアドレス
+	Scopes      []string // API キーのスコープ
+	WorkspaceID string   // RLS の app.workspace_id に渡すテナント
+	Bootstrap   bool     // 環境変数 API_KEY による全権キー（ワークスペース横断の管理操作が可能）
+}
+
+// Actor は監査ログ（import_audit_logs.actor）に記録する呼び出し元の表記
+func (p *Principal) Actor() string {
+	switch {
+	case p == nil:
+		return ""
+	case p.UserID != "":
+		return "user:" + p.UserID
+	default:
+		return "key:" + p.Name
+	}
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFrom はリクエストの認証済み呼び出し元を返す（未認証なら nil）
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// workspaceID はリクエストの呼び出し元のワークスペース（未認証なら ""）
+func workspaceID(r *http.Request) string {
+	if p := PrincipalFrom(r.Context()); p != nil {
+		return p.WorkspaceID
+	}
+	return ""
+}
+
+var (
+	errInvalidKey       = errors.New("invalid api key")
+	errNoWorkspaceClaim = errors.New("token has no workspace claim")
+)
+
+// Authenticator は X-API-Key ヘッダ、または Authorization: Bearer <jwt> を検証する
+type Authenticator struct {
+	Store *store.Store
+	// 環境変数 API_KEY。DB にキーが 1 つも無い状態から管理用キーを発行するための全権キー
+	BootstrapKey string
+	// ブートストラップキーが操作するワークスペース（環境変数 DEFAULT_WORKSPACE_ID）
+	DefaultWorkspaceID string
+	// Bearer トークンの検証器（nil なら JWT は受け付けない）
+	JWT *JWTVerifier
+
+	// テスト差し替え用（nil なら Store を引く）
+	lookupKey  func(ctx context.Context, hash string) (*Principal, error)
+	lookupRole func(ctx context.Context, workspaceID, userID string) (Role, error)
+}
+
+func NewAuthenticator(s *store.Store, bootstrapKey, defaultWorkspaceID string) *Authenticator {
+	if defaultWorkspaceID == "" {
+		defaultWorkspaceID = store.DefaultWorkspaceID
+	}
+	return &Authenticator{Store: s, BootstrapKey: bootstrapKey, DefaultWorkspaceID: defaultWorkspaceID}
+}
+
+// Middleware は資格情報を検証して Principal を context に載せる。無い/不正なら 401
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get("X-API-Key"))
+		bearer := ""
+		if authz := r.Header.Get("Authorization"); len(authz) > 7 && strings.EqualFold(authz[:7], "Bearer ") {
+			bearer = strings.TrimSpace(authz[7:])
+		}
+		// Bearer で API キーを送ってくるクライアントもあるので許容する
+		if key == "" && strings.HasPrefix(bearer, apiKeyPrefix) {
+			key, bearer = bearer, ""
+		}
+
+		var p *Principal
+		var err error
+		switch {
+		case key != "":
+			p, err = a.authenticate(r.Context(), key)
+		case bearer != "" && a.JWT != nil:
+			p, err = a.authenticateBearer(r.Context(), bearer)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			http.Error(w, "api key or bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, errInvalidKey) {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, errNoWorkspaceClaim) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "auth error", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, key string) (*Principal, error) {
+	if a.BootstrapKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.BootstrapKey)) == 1 {
+		return &Principal{Name: "bootstrap", Scopes: AllScopes, WorkspaceID: a.DefaultWorkspaceID, Bootstrap: true}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	lookup := a.lookupKey
+	if lookup == nil {
+		lookup = a.lookupStoredKey
+	}
+	return lookup(ctx, hashAPIKey(key))
+}
+
+// authenticateBearer は JWT を検証し、クレームから Principal を作る
+func (a *Authenticator) authenticateBearer(ctx context.Context, token string) (*Principal, error) {
+	c, err := a.JWT.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: sub is required", errInvalidToken)
+	}
+	if c.WorkspaceID == "" {
+		return nil, errNoWorkspaceClaim
+	}
+	p := &Principal{
+		UserID:      c.Subject,
+		AuthRole:    c.Role,
+		Name:        c.Email,
+		WorkspaceID: c.WorkspaceID,
+	}
+
+	// ロールは workspace_members を正とし、未登録ならトークンの workspace_role クレームを使う
+	lookup := a.lookupRole
+	if lookup == nil {
+		lookup = a.lookupMemberRole
+	}
+	role, err := lookup(ctx, p.WorkspaceID, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = Role(c.WorkspaceRole)
+	}
+	if role.Valid() {
+		p.Role = role
+	}
+	return p, nil
+}
+
+// lookupMemberRole は workspace_members からロールを引く（未登録なら ""）
+func (a *Authenticator) lookupMemberRole(ctx context.Context, workspaceID, userID string) (Role, error) {
+	if a.Store == nil {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var role string
+	err := a.Store.InWorkspace(ctx, workspaceID, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `select role from public.workspace_members where user_id = $1`, userID).Scan(&role)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return Role(role), nil
+}
+
+// lookupStoredKey は有効なキーを引き、同時に last_used_at を更新する
+func (a *Authenticator) lookupStoredKey(ctx context.Context, hash string) (*Principal, error) {
+	const q = `
+update public.api_keys
+set last_used_at = now()
+where key_hash = $1
+  and revoked_at is null
+  and (expires_at is null or expires_at > now())
+returning id, name, scopes, workspace_id;
+`
+	var p Principal
+	err := a.Store.Pool.QueryRow(ctx, q, hash).Scan(&p.KeyID, &p.Name, &p.Scopes, &p.WorkspaceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticatorScopes(t *testing.T) {
+	a := &Authenticator{
+		BootstrapKey: "boot",
+		lookupKey: func(ctx context.Context, hash string) (*Principal, error) {
+			if hash == hashAPIKey("reader") {
+				return &Principal{KeyID: "k1", Name: "reader", Scopes: []string{ScopeTemplatesRead}}, nil
+			}
+			return nil, errInvalidKey
+		},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := a.Middleware(Require(ActionTemplateWrite)(ok))
+
+	cases := []struct {
+		key  string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"reader", http.StatusForbidden},
+		{"boot", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/templates", nil)
+		if c.key != "" {
+			req.Header.Set("X-API-Key", c.key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Fatalf("key=%q: got %d, want %d", c.key, w.Code, c.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// api/internal/handlers/columns.go
+package handlers
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ColumnInfo はプレビューの列 1 つ分（ルールはどの表記でも列を指せる）
+type ColumnInfo struct {
+	Index        int    `json:"index"`        // 列番号（1 始まり。ヘッダなしのときの col_N の N）
+	Original     string `json:"original"`     // ファイルに書かれていたヘッダの表記（ヘッダなしは空）
+	Normalized   string `json:"normalized"`   // headers に入る正規化したキー
+	InferredType string `json:"inferredType"` // サンプル行から推定した型
+}
+
+// buildColumns は元の表記・正規化したキー・サンプル行から列の一覧を作る
+func buildColumns(originals, headers []string, rows [][]string) []ColumnInfo {
+	out := make([]ColumnInfo, len(headers))
+	for i, h := range headers {
+		var orig string
+		if i < len(originals) {
+			orig = originals[i]
+		}
+		values := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if i < len(row) {
+				values = append(values, row[i])
+			}
+		}
+		out[i] = ColumnInfo{Index: i + 1, Original: orig, Normalized: h, InferredType: inferColumnType(values)}
+	}
+	return out
+}
+
+// columnsFromHeaders は headers だけ渡されたとき（POST /api/mappings/apply・古いプレビュー）の列一覧
+// 元の表記は分からないので headers をそのまま使う
+func columnsFromHeaders(headers []string) []ColumnInfo {
+	out := make([]ColumnInfo, len(headers))
+	for i, h := range headers {
+		out[i] = ColumnInfo{Index: i + 1, Original: h, Normalized: h}
+	}
+	return out
+}
+
+// 真偽値とみなす値（小文字・NFKC 後）
+var boolWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "y": true, "n": true,
+	"はい": true, "いいえ": true, "有": true, "無": true,
+}
+
+// inferColumnType は空でない値がすべて当てはまる型を返す
+// integer / number / boolean / date / datetime / string（値が無ければ empty）
+func inferColumnType(values []string) string {
+	integer, number, boolean, date, datetime := true, true, true, true, true
+	seen := false
+	for _, v := range values {
+		v = strings.TrimSpace(norm.NFKC.String(v))
+		if v == "" {
+			continue
+		}
+		seen = true
+		// 符号は先頭だけ（2024-06-01 は数値ではない）
+		num := isNumericLike(v) && strings.ContainsAny(v, "0123456789") && strings.LastIndexAny(v, "+-") <= 0
+		integer = integer && num && !strings.ContainsAny(v, ".%")
+		number = number && num
+		boolean = boolean && boolWords[strings.ToLower(v)]
+		dt := !num && isDateTimeLike(v) && strings.ContainsAny(v, "-/")
+		date = date && dt && !strings.Contains(v, ":")
+		datetime = datetime && dt
+	}
+	switch {
+	case !seen:
+		return "empty"
+	case integer:
+		return "integer"
+	case number:
+		return "number"
+	case boolean:
+		return "boolean"
+	case date:
+		return "date"
+	case datetime:
+		return "datetime"
+	}
+	return "string"
+}
+
+// resolveColumn はルールの取り出し元が指す列の位置（0 始まり）を返す
+// 文字列のルールは、正規化したキー → 元の表記 → 表記ゆれをそろえたキー → 以前の正規化のキーの順に探す
+func resolveColumn(src *RuleSource, cols []ColumnInfo) (int, bool) {
+	find := func(match func(c ColumnInfo) bool) (int, bool) {
+		for i, c := range cols {
+			if match(c) {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	switch {
+	case src.Index > 0:
+		return find(func(c ColumnInfo) bool { return c.Index == src.Index })
+	case src.Original != "":
+		return find(func(c ColumnInfo) bool { return c.Original == src.Original })
+	case src.re != nil:
+		return find(func(c ColumnInfo) bool { return src.re.MatchString(c.Original) || src.re.MatchString(c.Normalized) })
+	case src.Normalized != "":
+		k := headerKey(src.Normalized)
+		if i, ok := find(func(c ColumnInfo) bool { return c.Normalized == src.Normalized || c.Normalized == k }); ok {
+			return i, true
+		}
+		return find(func(c ColumnInfo) bool { return c.Original != "" && legacyHeaderKey(c.Original) == src.Normalized })
+	}
+	if i, ok := find(func(c ColumnInfo) bool { return c.Normalized == src.Column }); ok {
+		return i, true
+	}
+	if i, ok := find(func(c ColumnInfo) bool { return c.Original == src.Column }); ok {
+		return i, true
+	}
+	k := headerKey(src.Column)
+	if k == "" {
+		return 0, false
+	}
+	if i, ok := find(func(c ColumnInfo) bool { return c.Normalized == k || headerKey(c.Original) == k }); ok {
+		return i, true
+	}
+	return find(func(c ColumnInfo) bool { return c.Original != "" && legacyHeaderKey(c.Original) == src.Column })
+}
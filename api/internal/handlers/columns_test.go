@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPreviewColumns(t *testing.T) {
+	src := "Order ID,Unit Price (JPY),Ordered At,Paid\n1001,980.5,2024-06-01,yes\n1002,1200,2024-06-02,no\n"
+	pv, err := buildPreviewWith(strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnInfo{
+		{Index: 1, Original: "Order ID", Normalized: "order_id", InferredType: "integer"},
+		{Index: 2, Original: "Unit Price (JPY)", Normalized: "unit_price", InferredType: "number"},
+		{Index: 3, Original: "Ordered At", Normalized: "ordered_at", InferredType: "date"},
+		{Index: 4, Original: "Paid", Normalized: "paid", InferredType: "boolean"},
+	}
+	if !reflect.DeepEqual(pv.Columns, want) {
+		t.Fatalf("columns = %+v", pv.Columns)
+	}
+
+	// ヘッダなしは元の表記が空
+	pv, err = buildPreviewWith(strings.NewReader("2024-07-01 10:00,east,3\n2024-07-02 11:30,west,5\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pv.Columns) != 3 || pv.Columns[0].Original != "" || pv.Columns[0].Normalized != "col_1" ||
+		pv.Columns[0].InferredType != "datetime" || pv.Columns[1].InferredType != "string" {
+		t.Fatalf("columns = %+v", pv.Columns)
+	}
+}
+
+func TestInferColumnType(t *testing.T) {
+	cases := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"", " "}, "empty"},
+		{[]string{"1,200", "-3", "４５"}, "integer"},
+		{[]string{"1.5", "2", "10%"}, "number"},
+		{[]string{"2024/06/01", ""}, "date"},
+		{[]string{"2024-06-01", "2024-06-01T10:00:00Z"}, "datetime"},
+		{[]string{"TRUE", "false"}, "boolean"},
+		{[]string{"1", "abc"}, "string"},
+	}
+	for _, c := range cases {
+		if got := inferColumnType(c.values); got != c.want {
+			t.Errorf("inferColumnType(%q) = %q, want %q", c.values, got, c.want)
+		}
+	}
+}
+
+func TestApplyRulesColumnReferences(t *testing.T) {
+	rules, issues := parseRules(json.RawMessage(`{
+		"a": "unit_price",
+		"b": "Unit Price (JPY)",
+		"c": {"original": "Order ID"},
+		"d": {"normalized": "Order-ID"},
+		"e": {"index": 2},
+		"f": {"index": 9}
+	}`))
+	if len(issues) > 0 {
+		t.Fatalf("issues = %+v", issues)
+	}
+	cols := []ColumnInfo{
+		{Index: 1, Original: "Order ID", Normalized: "order_id"},
+		{Index: 2, Original: "Unit Price (JPY)", Normalized: "unit_price"},
+	}
+	got := applyRules(rules, cols, [][]string{{"1001", "980"}})
+	if !reflect.DeepEqual(got.NormalizedRows[0], []string{"980", "980", "1001", "1001", "980", ""}) {
+		t.Fatalf("rows = %q (headers %q)", got.NormalizedRows, got.NormalizedHeaders)
+	}
+
+	// 保存するときはオブジェクトのまま残る
+	b, err := json.Marshal(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"c":{"original":"Order ID"}`) || !strings.Contains(string(b), `"e":{"index":2}`) {
+		t.Fatalf("marshal = %s", b)
+	}
+
+	for _, raw := range []string{`{"x":{}}`, `{"x":{"original":"A","index":1}}`, `{"x":{"index":-1}}`, `{"x":{"index":1.5}}`, `{"x":{"original":" "}}`} {
+		if _, issues := parseRules(json.RawMessage(raw)); len(issues) != 1 || issues[0].Path != "rules.x" {
+			t.Errorf("%s: issues = %+v", raw, issues)
+		}
+	}
+}
+
+func TestApplyRulesPositionalAndPattern(t *testing.T) {
+	rules, issues := parseRules(json.RawMessage(`{
+		"amount": {"index": 3},
+		"price": {"pattern": "(?i)^unit.?price"},
+		"missing": {"pattern": "^nothing$"}
+	}`))
+	if len(issues) > 0 {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	// ヘッダの無いファイルでも、ヘッダのあるファイルでも同じ列番号
+	headerless := columnsFromHeaders([]string{"col_1", "col_2", "col_3"})
+	withHeader := []ColumnInfo{
+		{Index: 1, Original: "ID", Normalized: "id"},
+		{Index: 2, Original: "Unit Price (JPY)", Normalized: "unit_price"},
+		{Index: 3, Original: "Amount", Normalized: "amount"},
+	}
+	got := applyRules(rules, headerless, [][]string{{"1", "980", "2"}})
+	if !reflect.DeepEqual(got.NormalizedRows[0], []string{"2", "", ""}) || got.Resolved["amount"] == nil || *got.Resolved["amount"] != 3 || got.Resolved["price"] != nil {
+		t.Fatalf("headerless = %+v", got)
+	}
+	got = applyRules(rules, withHeader, [][]string{{"1", "980", "2"}})
+	if !reflect.DeepEqual(got.NormalizedRows[0], []string{"2", "", "980"}) || *got.Resolved["price"] != 2 {
+		t.Fatalf("with header = %+v", got)
+	}
+
+	if _, issues := parseRules(json.RawMessage(`{"x":{"pattern":"("}}`)); len(issues) != 1 || !strings.Contains(issues[0].Reason, "invalid pattern") {
+		t.Fatalf("issues = %+v", issues)
+	}
+	for _, raw := range []string{`{"x":{"pattern":"  "}}`, `{"x":{"pattern":".*"}}`, `{"x":{"pattern":"(?i)price|"}}`} {
+		if _, issues := parseRules(json.RawMessage(raw)); len(issues) != 1 || issues[0].Path != "rules.x" {
+			t.Errorf("%s: issues = %+v", raw, issues)
+		}
+	}
+	if checkColumnCount(3, 3) != nil || checkColumnCount(0, 7) != nil || checkColumnCount(3, 4) == nil {
+		t.Fatal("checkColumnCount")
+	}
+}
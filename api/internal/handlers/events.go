@@ -0,0 +1,406 @@
+// api/internal/handlers/events.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// import_events はジョブ・インポートの変化をトリガで記録したもの（db/migrations/011）
+// 通知チャネル名はトリガ側と揃える
+const eventsChannel = "import_events"
+
+const (
+	sseHeartbeat    = 15 * time.Second // 中継（プロキシ）に切られないためのコメント行
+	ssePollFallback = 2 * time.Second  // ブローカー無しで動かす時の読み直し間隔
+	sseBatch        = 500
+)
+
+// ImportEvent は SSE の 1 イベント（id は Last-Event-ID に使う）
+type ImportEvent struct {
+	ID        int64           `json:"id"`
+	ImportID  string          `json:"import_id"`
+	JobID     *string         `json:"job_id,omitempty"`
+	Type      string          `json:"type"` // status / queued / phase / progress / retry / completed / failed / cancelled
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// EventBroker は LISTEN import_events を 1 本だけ張り、インポートごとの購読者に起こし通知を配る
+// 通知は「新しいイベントがある」合図だけで、中身は購読側が import_events から読む（取りこぼしても次で追いつく）
+type EventBroker struct {
+	Store *store.Store
+
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+	done bool
+}
+
+func NewEventBroker(s *store.Store) *EventBroker {
+	return &EventBroker{Store: s, subs: map[string]map[chan struct{}]struct{}{}}
+}
+
+// Subscribe は importID の起こし通知を受けるチャネルを返す（ブローカー停止時は close される）
+func (b *EventBroker) Subscribe(importID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[importID] == nil {
+		b.subs[importID] = map[chan struct{}]struct{}{}
+	}
+	b.subs[importID][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[importID][ch]; !ok {
+				return // 停止時に close 済み
+			}
+			delete(b.subs[importID], ch)
+			if len(b.subs[importID]) == 0 {
+				delete(b.subs, importID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// wake は importID の購読者を起こす（空なら全員。再接続直後の取りこぼし対策）
+// 送れない（前の合図が未処理）なら捨てる。読み直しでまとめて拾える
+func (b *EventBroker) wake(importID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, set := range b.subs {
+		if importID != "" && id != importID {
+			continue
+		}
+		for ch := range set {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (b *EventBroker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = true
+	for id, set := range b.subs {
+		for ch := range set {
+			close(ch)
+		}
+		delete(b.subs, id)
+	}
+}
+
+// Run は ctx が終わるまで LISTEN を続ける（切れたら張り直す）。終了時に購読をすべて閉じる
+func (b *EventBroker) Run(ctx context.Context, logger *slog.Logger) {
+	defer b.closeAll()
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("event listener stopped, reconnecting", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (b *EventBroker) listen(ctx context.Context) error {
+	conn, err := b.Store.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// プールに返す前に購読を外す（接続が死んでいればプール側で捨てられる）
+		uctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, _ = conn.Exec(uctx, "unlisten *")
+		cancel()
+		conn.Release()
+	}()
+	if _, err := conn.Exec(ctx, "listen "+eventsChannel); err != nil {
+		return err
+	}
+	b.wake("") // 張り直すまでの間の分を拾わせる
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var msg struct {
+			ImportID string `json:"import_id"`
+		}
+		if json.Unmarshal([]byte(n.Payload), &msg) == nil && msg.ImportID != "" {
+			b.wake(msg.ImportID)
+		}
+	}
+}
+
+// GET /api/imports/{id}/events
+// SSE で import_events を流す。Last-Event-ID（または ?last_event_id=）より後から再開できる
+// 指定が無ければそのインポートの最初のイベントから送る
+func (h *ImportHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ws := workspaceID(r)
+	last := lastEventID(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var one int
+		return tx.QueryRow(ctx, `select 1 from public.imports where id = $1`, id).Scan(&one)
+	})
+	cancel()
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// サーバ全体の WriteTimeout をこの接続だけ外す
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// 購読してから読む（間に来たイベントを落とさない）
+	var wake <-chan struct{}
+	poll := sseHeartbeat
+	if h.Events != nil {
+		ch, unsubscribe := h.Events.Subscribe(id)
+		defer unsubscribe()
+		wake = ch
+	} else {
+		poll = ssePollFallback
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx のバッファリング無効
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	cur := newEventCursor(last)
+	send := func() error {
+		err := h.nextEvents(r.Context(), ws, id, cur, func(ev ImportEvent) error {
+			return writeSSE(w, ev, cur.floor)
+		})
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := send(); err != nil {
+		return
+	}
+
+	hb := time.NewTicker(sseHeartbeat)
+	defer hb.Stop()
+	tick := time.NewTicker(poll)
+	defer tick.Stop()
+	for {
+		select {
+		case <-r.Context().Done(): // クライアント切断
+			return
+		case _, ok := <-wake:
+			if !ok {
+				return // サーバ停止
+			}
+			if send() != nil {
+				return
+			}
+		case <-tick.C:
+			// 通知を取りこぼした場合の保険
+			if send() != nil {
+				return
+			}
+		case <-hb.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventCursor は SSE の読み進め位置
+// import_events.id は insert した時点の順で、見える（コミットされる）順ではない。commit ジョブの長いトランザクションが書いた N が、
+// 別の接続で先にコミットされた進捗 N+1 より後に見えることがある。そこで送った ID を覚えておき、
+// 「これ以下の ID はもう新しく見えてこない」と確かめられた floor までだけを読み終えたことにする
+type eventCursor struct {
+	floor   int64
+	sent    map[int64]bool   // floor より大きい送信済みの ID
+	pending []eventWatermark // まだ確かめられていない読み取り時点
+}
+
+// eventWatermark は読み取り時点。lastID までの ID を持つトランザクションは、どれも xid が xmax より小さい
+// （lastID を読んだ後にスナップショットを取り、emit_import_event は ID より先に xid を持つ）
+type eventWatermark struct {
+	lastID     int64
+	xmin, xmax int64
+}
+
+func newEventCursor(floor int64) *eventCursor {
+	return &eventCursor{floor: floor, sent: map[int64]bool{}}
+}
+
+// sentIDs は floor より大きい送信済みの ID（読み直しで除く）
+func (c *eventCursor) sentIDs() []int64 {
+	out := make([]int64, 0, len(c.sent))
+	for id := range c.sent {
+		out = append(out, id)
+	}
+	return out
+}
+
+// advance は wm より前の読み取り時点のうち、当時動いていたトランザクションがすべて終わった（xmin >= xmax）ものの lastID まで floor を進め、
+// wm を次に確かめる読み取り時点として積む
+// wm の取得より後に読んだ行は、確かめられた時点までのコミット済みの行をすべて含むので、floor 以下に読み残しは無い
+func (c *eventCursor) advance(wm eventWatermark) {
+	keep := c.pending[:0]
+	for _, p := range c.pending {
+		if wm.xmin >= p.xmax {
+			c.floor = max(c.floor, p.lastID)
+		} else {
+			keep = append(keep, p)
+		}
+	}
+	c.pending = keep
+	// 同じ lastID なら先に積んだ方（xmax が小さい）が早く確かめられる
+	if wm.lastID > c.floor && (len(c.pending) == 0 || c.pending[len(c.pending)-1].lastID < wm.lastID) {
+		c.pending = append(c.pending, wm)
+	}
+	for id := range c.sent {
+		if id <= c.floor {
+			delete(c.sent, id)
+		}
+	}
+}
+
+// nextEvents はまだ送っていないイベントを ID 順に emit に渡し、読み終えたことが確かめられた所まで cur.floor を進める
+func (h *ImportHandler) nextEvents(ctx context.Context, ws, importID string, cur *eventCursor, emit func(ImportEvent) error) error {
+	qctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	wm, err := h.eventWatermark(qctx, ws)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for {
+		qctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		evs, err := h.eventsAfter(qctx, ws, importID, cur.floor, cur.sentIDs())
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, ev := range evs {
+			cur.sent[ev.ID] = true
+			if err := emit(ev); err != nil {
+				return err
+			}
+		}
+		if len(evs) < sseBatch {
+			break
+		}
+	}
+	cur.advance(wm)
+	return nil
+}
+
+// eventWatermark は発番済みの最後の ID を読んでから、スナップショットの xmin / xmax を取る（順番が大事なので別の文）
+func (h *ImportHandler) eventWatermark(ctx context.Context, ws string) (eventWatermark, error) {
+	var wm eventWatermark
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `select public.import_events_last_id()`).Scan(&wm.lastID); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `
+select pg_snapshot_xmin(s)::text::bigint, pg_snapshot_xmax(s)::text::bigint
+from pg_current_snapshot() s`).Scan(&wm.xmin, &wm.xmax)
+	})
+	return wm, err
+}
+
+// eventsAfter は after より大きい ID のうち、まだ送っていない（skip に無い）イベントを ID 順に返す
+func (h *ImportHandler) eventsAfter(ctx context.Context, ws, importID string, after int64, skip []int64) ([]ImportEvent, error) {
+	var out []ImportEvent
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+select id, import_id, job_id, type, data, created_at
+from public.import_events
+where import_id = $1 and id > $2 and id <> all($3)
+order by id
+limit `+strconv.Itoa(sseBatch), importID, after, skip)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var ev ImportEvent
+			if err := rows.Scan(&ev.ID, &ev.ImportID, &ev.JobID, &ev.Type, &ev.Data, &ev.CreatedAt); err != nil {
+				return err
+			}
+			out = append(out, ev)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+// lastEventID は再接続時の Last-Event-ID（EventSource が自動で付ける）。無い・不正なら 0
+func lastEventID(r *http.Request) int64 {
+	v := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// writeSSE は 1 イベントを書く（data は 1 行の JSON）
+// id: は再開位置（ここまでは読み終えた floor）。イベント自身の ID は data の id で、floor より後は再接続で重ねて届くことがある
+func writeSSE(w io.Writer, ev ImportEvent, resume int64) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", resume, ev.Type, b)
+	return err
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"csv-import-kit/api/internal/jobs"
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestLastEventID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/imports/x/events?last_event_id=7", nil)
+	if got := lastEventID(r); got != 7 {
+		t.Fatalf("query: got %d", got)
+	}
+	// ヘッダが優先
+	r.Header.Set("Last-Event-ID", "42")
+	if got := lastEventID(r); got != 42 {
+		t.Fatalf("header: got %d", got)
+	}
+	r.Header.Set("Last-Event-ID", "abc")
+	r.URL.RawQuery = ""
+	if got := lastEventID(r); got != 0 {
+		t.Fatalf("invalid: got %d", got)
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	ev := ImportEvent{ID: 3, ImportID: "imp-1", Type: "progress", Data: json.RawMessage(`{"rows_done":10}`), CreatedAt: time.Unix(0, 0).UTC()}
+	if err := writeSSE(&buf, ev, 3); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 3\nevent: progress\ndata: {\"id\":3,\"import_id\":\"imp-1\",\"type\":\"progress\",\"data\":{\"rows_done\":10},\"created_at\":\"1970-01-01T00:00:00Z\"}\n\n"
+	if buf.String() != want {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+func TestEventBrokerWake(t *testing.T) {
+	b := NewEventBroker(nil)
+	a, unsubA := b.Subscribe("imp-a")
+	other, unsubOther := b.Subscribe("imp-b")
+	defer unsubOther()
+
+	// 合図はまとめられる（未処理なら 1 つだけ）
+	b.wake("imp-a")
+	b.wake("imp-a")
+	select {
+	case <-a:
+	default:
+		t.Fatal("subscriber should be woken")
+	}
+	select {
+	case <-a:
+		t.Fatal("wake should be coalesced")
+	case <-other:
+		t.Fatal("other import should not be woken")
+	default:
+	}
+
+	unsubA()
+	unsubA() // 2 回呼んでも安全
+	b.closeAll()
+	if _, ok := <-other; ok {
+		t.Fatal("closeAll should close subscriptions")
+	}
+	unsubOther()
+	if _, ok := <-mustSubscribe(b); ok {
+		t.Fatal("subscribe after close should return closed channel")
+	}
+}
+
+func mustSubscribe(b *EventBroker) <-chan struct{} {
+	ch, _ := b.Subscribe("imp-c")
+	return ch
+}
+
+func TestEventCursorAdvance(t *testing.T) {
+	c := newEventCursor(10)
+	c.sent[12] = true // 11 はまだ見えていない（長いトランザクションの中）
+
+	// 11 を書いたトランザクション（xid 100）が動いている間は floor を進めない
+	c.advance(eventWatermark{lastID: 12, xmin: 100, xmax: 105})
+	if c.floor != 10 || !c.sent[12] {
+		t.Fatalf("cursor = %+v", c)
+	}
+	c.advance(eventWatermark{lastID: 12, xmin: 103, xmax: 106})
+	if c.floor != 10 || len(c.pending) != 1 {
+		t.Fatalf("cursor = %+v", c)
+	}
+	// xid 105 未満がすべて終わったら 12 までは読み終えている
+	c.advance(eventWatermark{lastID: 13, xmin: 105, xmax: 107})
+	if c.floor != 12 || len(c.sent) != 0 || len(c.pending) != 1 {
+		t.Fatalf("cursor = %+v", c)
+	}
+}
+
+// testWorkspace は DB のテスト用にワークスペースを作る（終わったら消す）
+// マイグレーション適用済みの DB が必要（TEST_DATABASE_URL、store のテストと同じ）
+func testWorkspace(t *testing.T, name string) (*store.Store, string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	st, err := store.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ws string
+	if err := st.Pool.QueryRow(context.Background(), `insert into public.workspaces (name) values ($1) returning id`, name).Scan(&ws); err != nil {
+		st.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = st.Pool.Exec(context.Background(), `delete from public.workspaces where id = $1`, ws)
+		st.Close()
+	})
+	return st, ws
+}
+
+func TestNextEventsOutOfOrderCommit(t *testing.T) {
+	st, ws := testWorkspace(t, "events-order")
+	ctx := context.Background()
+
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `insert into public.imports (status, original_filename) values ('ready_to_commit', 'a.csv') returning id`).Scan(&importID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A: commit ジョブのように status を committed にしてまだコミットしない（イベント N）
+	txA, err := st.Pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = txA.Rollback(context.Background()) }()
+	if _, err := txA.Exec(ctx, `update public.imports set status = 'committed' where id = $1`, importID); err != nil {
+		t.Fatal(err)
+	}
+	// B: 別の接続で後からイベント N+1 を書き、先にコミット
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		_, err := jobs.Enqueue(ctx, tx, jobs.Spec{Type: JobParse, ImportID: importID})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ImportHandler{Store: st}
+	cur := newEventCursor(0)
+	var got []ImportEvent
+	collect := func(ev ImportEvent) error { got = append(got, ev); return nil }
+	if err := h.nextEvents(ctx, ws, importID, cur, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Type != "queued" {
+		t.Fatalf("before A commits: %+v", got)
+	}
+	if err := txA.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := h.nextEvents(ctx, ws, importID, cur, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Type != "status" {
+		t.Fatalf("after A commits, the earlier id must still be sent once: %+v", got)
+	}
+	// 両方終わった後は floor が追いつく
+	if err := h.nextEvents(ctx, ws, importID, cur, collect); err != nil || len(got) != 1 || cur.floor < got[0].ID {
+		t.Fatalf("floor = %d, events = %+v, err = %v", cur.floor, got, err)
+	}
+}
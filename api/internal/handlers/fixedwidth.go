@@ -0,0 +1,179 @@
+// api/internal/handlers/fixedwidth.go
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/width"
+)
+
+// 固定長の列数の上限
+const maxFixedColumns = 500
+
+// FixedColumn は固定長ファイルの 1 列
+// 位置は Shift_JIS のバイト位置で数える（全角・※ などは 2 桁、半角カナは 1 桁。runeWidth）
+type FixedColumn struct {
+	Start  int    `json:"start"`            // 1 始まり
+	Length int    `json:"length,omitempty"` // 0 は行末まで（最後の列のみ）
+	Name   string `json:"name,omitempty"`   // 省略時はヘッダ行 / col_N
+}
+
+// validateFixedColumns は列の並び（昇順・重なりなし）を確かめる
+func validateFixedColumns(cols []FixedColumn) error {
+	if len(cols) > maxFixedColumns {
+		return fmt.Errorf("columns must be at most %d", maxFixedColumns)
+	}
+	end := 1
+	for i, c := range cols {
+		switch {
+		case c.Start < 1:
+			return fmt.Errorf("columns[%d].start must be 1 or greater", i)
+		case c.Length < 0, c.Length == 0 && i != len(cols)-1:
+			return fmt.Errorf("columns[%d].length must be positive (0 is allowed only for the last column)", i)
+		case c.Start < end:
+			return fmt.Errorf("columns[%d] overlaps the previous column", i)
+		}
+		end = c.Start + c.Length
+	}
+	return nil
+}
+
+// runeWidth は桁数。Shift_JIS にある文字はそのバイト数（※ ① α などの曖昧幅の文字も 2、半角カナは 1）
+// Shift_JIS に無い文字は表示幅（東アジアの全角・広い文字は 2）
+func runeWidth(r rune) int {
+	if r < utf8.RuneSelf {
+		return 1
+	}
+	if b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(string(r))); err == nil {
+		return len(b)
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// sliceFixed は 1 行を列に切り出す（列の境界をまたぐ全角文字は始まった側の列に入れる）
+func sliceFixed(line string, cols []FixedColumn) []string {
+	bufs := make([]strings.Builder, len(cols))
+	pos, ci := 1, 0
+	for _, r := range line {
+		for ci < len(cols) && cols[ci].Length > 0 && pos >= cols[ci].Start+cols[ci].Length {
+			ci++
+		}
+		if ci == len(cols) {
+			break
+		}
+		if pos >= cols[ci].Start {
+			bufs[ci].WriteRune(r)
+		}
+		pos += runeWidth(r)
+	}
+	out := make([]string, len(cols))
+	for i := range bufs {
+		out[i] = bufs[i].String()
+	}
+	return out
+}
+
+// detectFixedColumns はどの行でも空白になっている桁を境に列を切る
+// 値の中の空白は行ごとに位置が違うので境界にはならない。全角空白も詰め物として空白扱い
+func detectFixedColumns(lines []string) []FixedColumn {
+	var used []bool
+	for _, line := range lines {
+		pos := 0
+		for _, r := range line {
+			w := runeWidth(r)
+			if !unicode.IsSpace(r) {
+				for len(used) < pos+w {
+					used = append(used, false)
+				}
+				for k := pos; k < pos+w; k++ {
+					used[k] = true
+				}
+			}
+			pos += w
+		}
+	}
+
+	var cols []FixedColumn
+	for p := 0; p < len(used); p++ {
+		if used[p] && (p == 0 || !used[p-1]) {
+			start := p + 1
+			if len(cols) == 0 {
+				start = 1 // 先頭の空白も最初の列に含める
+			} else {
+				prev := &cols[len(cols)-1]
+				prev.Length = start - prev.Start
+			}
+			cols = append(cols, FixedColumn{Start: start})
+		}
+	}
+	return cols
+}
+
+// fixedSampleLines は列の推定に使う行（空行・コメント行は除く）
+func fixedSampleLines(head []byte, comment string) []string {
+	var out []string
+	for _, line := range strings.Split(string(sniffSample(head)), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || (comment != "" && strings.HasPrefix(line, comment)) {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// fixedReader は固定長ファイルを 1 行 1 レコードで読む（値の前後の詰め物は trim で落とす。既定 both）
+type fixedReader struct {
+	r       *bufio.Reader
+	cols    []FixedColumn
+	comment string
+	trim    string
+}
+
+func (f *fixedReader) Read() ([]string, error) {
+	for {
+		line, err := f.r.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" || (f.comment != "" && strings.HasPrefix(line, f.comment)) {
+			continue
+		}
+		rec := sliceFixed(line, f.cols)
+		mode := f.trim
+		if mode == "" {
+			mode = "both"
+		}
+		for i := range rec {
+			rec[i] = trimValue(rec[i], mode)
+		}
+		return rec, nil
+	}
+}
+
+// fixedColumnNames は列に付けた名前（1 つも無ければ nil）
+func fixedColumnNames(cols []FixedColumn) []string {
+	named := false
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = strings.TrimSpace(c.Name)
+		named = named || names[i] != ""
+	}
+	if !named {
+		return nil
+	}
+	return names
+}
+
+var errNoFixedColumns = errors.New("could not detect fixed-width columns (specify columns)")
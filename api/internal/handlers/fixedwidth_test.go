@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestDetectFixedColumns(t *testing.T) {
+	lines := []string{
+		"ID  NAME          AMOUNT",
+		"  1 Taro Yamada      980",
+		" 10 Hanako Sato    12000",
+	}
+	got := detectFixedColumns(lines)
+	want := []FixedColumn{{Start: 1, Length: 4}, {Start: 5, Length: 14}, {Start: 19}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSliceFixedFullWidth(t *testing.T) {
+	// 全角は 2 桁（Shift_JIS のバイト位置と同じ）。全角空白の詰め物は trim で落ちる
+	cols := []FixedColumn{{Start: 1, Length: 4}, {Start: 5, Length: 10}, {Start: 15}}
+	got := sliceFixed("0001山田　太郎20240101", cols)
+	want := []string{"0001", "山田　太郎", "20240101"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	got = sliceFixed("0002佐藤　　　20240102", cols)
+	if trimValue(got[1], "both") != "佐藤" {
+		t.Fatalf("got %q", got)
+	}
+	// ※ ① などの曖昧幅の文字も Shift_JIS では 2 バイト。後ろの列がずれない
+	got = sliceFixed("0004※①　　　20240104", cols)
+	if want := []string{"0004", "※①　　　", "20240104"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// 半角カナは 1 バイト
+	got = sliceFixed("0005ﾔﾏﾀﾞ      20240105", cols)
+	if want := []string{"0005", "ﾔﾏﾀﾞ      ", "20240105"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// 短い行は足りない列が空
+	if got := sliceFixed("0003", cols); !reflect.DeepEqual(got, []string{"0003", "", ""}) {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestBuildPreviewFixedWidth(t *testing.T) {
+	src, err := japanese.ShiftJIS.NewEncoder().String(
+		"取引明細\n" +
+			"0001ﾔﾏﾀﾞ ﾀﾛｳ  山田商店  000012000\n" +
+			"0002ｻﾄｳ ﾊﾅｺ   佐藤工業  000000980\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &ParseOptions{
+		Format:   "fixed",
+		Encoding: "shift_jis",
+		SkipTop:  1,
+		Columns: []FixedColumn{
+			{Start: 1, Length: 4, Name: "Account No"},
+			{Start: 5, Length: 10, Name: "kana"},
+			{Start: 15, Length: 10, Name: "company"},
+			{Start: 25, Name: "amount"},
+		},
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	pv, err := buildPreviewWith(strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.Format != "fixed" || pv.HasHeader || pv.RowCount != 2 {
+		t.Fatalf("preview = %+v", pv)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"account_no", "kana", "company", "amount"}) {
+		t.Fatalf("headers = %q", pv.Headers)
+	}
+	want := [][]string{{"0001", "ﾔﾏﾀﾞ ﾀﾛｳ", "山田商店", "000012000"}, {"0002", "ｻﾄｳ ﾊﾅｺ", "佐藤工業", "000000980"}}
+	if !reflect.DeepEqual(pv.SampleRows, want) {
+		t.Fatalf("rows = %q", pv.SampleRows)
+	}
+}
+
+func TestBuildPreviewFixedWidthDetected(t *testing.T) {
+	src := "CODE NAME        QTY\n" +
+		"A01  red bean      3\n" +
+		"B20  green tea    12\n"
+	pv, err := buildPreviewWith(strings.NewReader(src), &ParseOptions{Format: "fixed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pv.HasHeader || !reflect.DeepEqual(pv.Headers, []string{"code", "name", "qty"}) {
+		t.Fatalf("preview = %+v", pv)
+	}
+	if !reflect.DeepEqual(pv.SampleRows[0], []string{"A01", "red bean", "3"}) || len(pv.FixedColumns) != 3 {
+		t.Fatalf("preview = %+v", pv)
+	}
+}
+
+func TestValidateFixedColumns(t *testing.T) {
+	bad := []ParseOptions{
+		{Format: "fixed", Columns: []FixedColumn{{Start: 0, Length: 2}}},
+		{Format: "fixed", Columns: []FixedColumn{{Start: 1, Length: 4}, {Start: 3, Length: 2}}},
+		{Format: "fixed", Columns: []FixedColumn{{Start: 1}, {Start: 5, Length: 2}}},
+		{Columns: []FixedColumn{{Start: 1, Length: 2}}},
+		{Format: "xml"},
+	}
+	for _, o := range bad {
+		if err := o.validate(); err == nil {
+			t.Errorf("%+v should be rejected", o)
+		}
+	}
+}
+
+func TestUploadPreviewParseOptions(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "bank.txt")
+	_, _ = fw.Write([]byte("0001YAMADA    980\n0002SATO      1200\n"))
+	_ = mw.WriteField("parseOptions", `{"format":"fixed","headerRow":-1,"columns":[{"start":1,"length":4,"name":"id"},{"start":5,"length":10,"name":"name"},{"start":15,"name":"amount"}]}`)
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/imports", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	(&ImportHandler{}).UploadPreview(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var pv previewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &pv); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"id", "name", "amount"}) || pv.SampleRows[1][2] != "1200" {
+		t.Fatalf("preview = %+v", pv)
+	}
+
+	// 不正な列定義は 422
+	body.Reset()
+	mw = multipart.NewWriter(&body)
+	fw, _ = mw.CreateFormFile("file", "bank.txt")
+	_, _ = fw.Write([]byte("0001YAMADA\n"))
+	_ = mw.WriteField("parseOptions", `{"format":"fixed","columns":[{"start":0,"length":4}]}`)
+	_ = mw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/api/imports", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	(&ImportHandler{}).UploadPreview(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
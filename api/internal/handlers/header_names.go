@@ -0,0 +1,223 @@
+// api/internal/handlers/header_names.go
+package handlers
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// headerKey はヘッダの表記ゆれをそろえた照合キー（normalizeHeaders・別名・サジェストで共通）
+//  1. NFKC（全角英数・全角空白・全角括弧は半角に、半角カナは全角に）
+//  2. 「（必須）」「[任意]」「(JPY)」のような注記や、先頭・末尾の「*」「※」を落とす
+//  3. 小文字にし、空白の並び・ハイフンを _ に
+func headerKey(s string) string {
+	k := stripDecorations(norm.NFKC.String(s))
+	k = strings.ToLower(k)
+	var b strings.Builder
+	space := false
+	for _, r := range k {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r == '-':
+			r = '_'
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// legacyHeaderKey は headerKey より前の正規化（前後の空白を落として小文字、空白・ハイフンを _）
+// それまでに保存したテンプレートのルール・import_mappings・別名のキー（unit_price_(jpy) など）と照合するためだけに使う
+func legacyHeaderKey(s string) string {
+	k := strings.ToLower(strings.TrimSpace(s))
+	k = strings.ReplaceAll(k, " ", "_")
+	return strings.ReplaceAll(k, "-", "_")
+}
+
+// 注記として落とす括弧の中身（必須・任意の印、単位・通貨）
+var headerNotes = map[string]bool{
+	"必須": true, "任意": true, "required": true, "optional": true, "req": true, "opt": true,
+	"半角": true, "全角": true, "半角英数": true, "半角数字": true, "半角英数字": true, "全角カナ": true, "カナ": true,
+	"円": true, "jpy": true, "yen": true, "usd": true, "¥": true, "$": true, "%": true,
+}
+
+// 括弧の組（NFKC の後なので全角の（）［］＜＞はもう半角）
+var headerBrackets = [][2]string{{"(", ")"}, {"[", "]"}, {"【", "】"}, {"<", ">"}, {"〈", "〉"}, {"《", "》"}, {"〔", "〕"}}
+
+// 先頭・末尾につく印
+const headerMarks = "*※◎○●★☆◆■†"
+
+// stripDecorations は注記と印を落とす（中身が注記でない括弧「単価(税込)」は残す）
+func stripDecorations(s string) string {
+	for {
+		before := s
+		s = strings.TrimSpace(strings.Trim(strings.TrimSpace(s), headerMarks))
+		for _, br := range headerBrackets {
+			// 末尾の注記
+			if strings.HasSuffix(s, br[1]) {
+				if i := strings.LastIndex(s, br[0]); i >= 0 && headerNotes[strings.ToLower(strings.TrimSpace(s[i+len(br[0]):len(s)-len(br[1])]))] {
+					s = s[:i]
+				}
+			}
+			// 先頭の注記（【必須】氏名）
+			if strings.HasPrefix(s, br[0]) {
+				if i := strings.Index(s, br[1]); i >= 0 && headerNotes[strings.ToLower(strings.TrimSpace(s[len(br[0]):i]))] {
+					s = s[i+len(br[1]):]
+				}
+			}
+		}
+		if s == before {
+			return s
+		}
+	}
+}
+
+// isWordRune は語の一部になる文字（どの文字体系でもよい。長音「ー」や結合文字も含む）
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
+
+// asciiHeaderKey はヘッダを英数字のキーにする（parseOptions の headerKeys: "ascii"）
+// よく使う業務用語は英訳（注文番号 → order_number）、かなはヘボン式のローマ字、訳せない漢字は落とす
+func asciiHeaderKey(key string) string {
+	rs := []rune(key)
+	var parts []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			parts = append(parts, cur.String())
+			cur.Reset()
+		}
+	}
+	kana := false // cur がローマ字（英数字との境目で区切る）
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		if r < 0x80 {
+			if kana || r == '_' || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				flush()
+				kana = false
+			}
+			if r != '_' && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				cur.WriteRune(r)
+			}
+			i++
+			continue
+		}
+		if en, n := glossaryMatch(rs[i:]); n > 0 {
+			flush()
+			parts = append(parts, en)
+			i += n
+			continue
+		}
+		if roma, n := kanaRomaji(rs[i:]); n > 0 {
+			if !kana {
+				flush()
+				kana = true
+			}
+			cur.WriteString(roma)
+			i += n
+			continue
+		}
+		flush() // 訳せない漢字・記号
+		i++
+	}
+	flush()
+	return strings.Join(parts, "_")
+}
+
+// headerGlossary はヘッダによく出る業務用語の英訳（長い語を優先して当てる）
+var headerGlossary = map[string]string{
+	"注文番号": "order_number", "注文日": "order_date", "注文": "order", "受注": "order", "発注": "purchase_order",
+	"顧客名": "customer_name", "顧客": "customer", "得意先": "customer", "取引先": "partner", "会員": "member",
+	"氏名": "name", "名前": "name", "姓": "last_name", "フリガナ": "kana", "ふりがな": "kana",
+	"会社名": "company_name", "会社": "company", "部署": "department", "担当者": "assignee", "担当": "assignee", "社員": "employee",
+	"郵便番号": "postal_code", "都道府県": "prefecture", "市区町村": "city", "住所": "address",
+	"電話番号": "phone", "電話": "phone", "携帯": "mobile", "メールアドレス": "email", "メール": "email",
+	"生年月日": "birth_date", "性別": "gender", "年齢": "age",
+	"日付": "date", "日時": "datetime", "年月日": "date", "年月": "year_month", "時刻": "time",
+	"作成日": "created_at", "更新日": "updated_at", "登録日": "registered_at", "開始日": "start_date", "終了日": "end_date", "期限": "due_date",
+	"商品名": "product_name", "商品": "product", "品名": "item_name", "品番": "item_code", "型番": "model_number",
+	"単価": "unit_price", "数量": "quantity", "金額": "amount", "価格": "price", "合計": "total", "小計": "subtotal",
+	"消費税": "tax", "税込": "tax_included", "税抜": "tax_excluded", "税": "tax", "値引": "discount", "割引": "discount", "送料": "shipping",
+	"売上": "sales", "仕入": "purchase", "在庫": "stock", "請求": "invoice", "支払": "payment", "入金": "deposit",
+	"出荷": "shipment", "納品": "delivery", "店舗名": "store_name", "店舗": "store", "支店": "branch", "倉庫": "warehouse",
+	"番号": "number", "コード": "code", "区分": "category", "分類": "category", "種別": "type", "状態": "status", "ステータス": "status",
+	"備考": "note", "メモ": "memo", "数": "count", "率": "rate", "年": "year", "月": "month",
+}
+
+var maxGlossaryRunes = func() int {
+	n := 0
+	for k := range headerGlossary {
+		n = max(n, len([]rune(k)))
+	}
+	return n
+}()
+
+func glossaryMatch(rs []rune) (string, int) {
+	for n := min(len(rs), maxGlossaryRunes); n > 0; n-- {
+		if en, ok := headerGlossary[string(rs[:n])]; ok {
+			return en, n
+		}
+	}
+	return "", 0
+}
+
+// ひらがなのローマ字（ヘボン式）。カタカナはひらがなにしてから引く
+var kanaTable = map[string]string{
+	"あ": "a", "い": "i", "う": "u", "え": "e", "お": "o",
+	"か": "ka", "き": "ki", "く": "ku", "け": "ke", "こ": "ko", "が": "ga", "ぎ": "gi", "ぐ": "gu", "げ": "ge", "ご": "go",
+	"さ": "sa", "し": "shi", "す": "su", "せ": "se", "そ": "so", "ざ": "za", "じ": "ji", "ず": "zu", "ぜ": "ze", "ぞ": "zo",
+	"た": "ta", "ち": "chi", "つ": "tsu", "て": "te", "と": "to", "だ": "da", "ぢ": "ji", "づ": "zu", "で": "de", "ど": "do",
+	"な": "na", "に": "ni", "ぬ": "nu", "ね": "ne", "の": "no",
+	"は": "ha", "ひ": "hi", "ふ": "fu", "へ": "he", "ほ": "ho", "ば": "ba", "び": "bi", "ぶ": "bu", "べ": "be", "ぼ": "bo",
+	"ぱ": "pa", "ぴ": "pi", "ぷ": "pu", "ぺ": "pe", "ぽ": "po",
+	"ま": "ma", "み": "mi", "む": "mu", "め": "me", "も": "mo", "や": "ya", "ゆ": "yu", "よ": "yo",
+	"ら": "ra", "り": "ri", "る": "ru", "れ": "re", "ろ": "ro", "わ": "wa", "を": "o", "ん": "n", "ゔ": "vu",
+	"ぁ": "a", "ぃ": "i", "ぅ": "u", "ぇ": "e", "ぉ": "o", "ゃ": "ya", "ゅ": "yu", "ょ": "yo",
+	"きゃ": "kya", "きゅ": "kyu", "きょ": "kyo", "ぎゃ": "gya", "ぎゅ": "gyu", "ぎょ": "gyo",
+	"しゃ": "sha", "しゅ": "shu", "しょ": "sho", "じゃ": "ja", "じゅ": "ju", "じょ": "jo",
+	"ちゃ": "cha", "ちゅ": "chu", "ちょ": "cho", "にゃ": "nya", "にゅ": "nyu", "にょ": "nyo",
+	"ひゃ": "hya", "ひゅ": "hyu", "ひょ": "hyo", "びゃ": "bya", "びゅ": "byu", "びょ": "byo",
+	"ぴゃ": "pya", "ぴゅ": "pyu", "ぴょ": "pyo", "みゃ": "mya", "みゅ": "myu", "みょ": "myo",
+	"りゃ": "rya", "りゅ": "ryu", "りょ": "ryo",
+	"ふぁ": "fa", "ふぃ": "fi", "ふぇ": "fe", "ふぉ": "fo", "てぃ": "ti", "でぃ": "di", "うぃ": "wi", "うぇ": "we", "しぇ": "she", "じぇ": "je", "ちぇ": "che",
+}
+
+// toHiragana はカタカナをひらがなにする（それ以外はそのまま）
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - 0x60
+	}
+	return r
+}
+
+// kanaRomaji は先頭のかな（拗音・促音・長音を含む）をローマ字にし、使った文字数を返す
+func kanaRomaji(rs []rune) (string, int) {
+	r := toHiragana(rs[0])
+	switch {
+	case r == 'ー':
+		return "", 1 // 長音は落とす（メール → meru）
+	case r == 'っ' && len(rs) > 1:
+		if next, n := kanaRomaji(rs[1:]); n > 0 && next != "" {
+			return next[:1] + next, n + 1
+		}
+		return "", 1
+	}
+	if len(rs) > 1 {
+		if s, ok := kanaTable[string([]rune{r, toHiragana(rs[1])})]; ok {
+			return s, 2
+		}
+	}
+	if s, ok := kanaTable[string(r)]; ok {
+		return s, 1
+	}
+	return "", 0
+}
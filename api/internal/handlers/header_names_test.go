@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeaderKey(t *testing.T) {
+	cases := map[string]string{
+		"Unit Price (JPY)":   "unit_price",
+		"ＵＮＩＴ　ＰＲＩＣＥ":         "unit_price",
+		"注文番号（必須）":           "注文番号",
+		"【必須】氏名":             "氏名",
+		"*メールアドレス":           "メールアドレス",
+		"※備考 [任意]":           "備考",
+		"単価（税込）":             "単価(税込)",
+		"ﾌﾘｶﾞﾅ":              "フリガナ",
+		"order-id":           "order_id",
+		"  Customer   Name ": "customer_name",
+	}
+	for in, want := range cases {
+		if got := headerKey(in); got != want {
+			t.Errorf("headerKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+	// 別名の照合キーも同じ規則
+	if aliasKey("ＥＭＡＩＬ（必須）") != "email" {
+		t.Errorf("aliasKey = %q", aliasKey("ＥＭＡＩＬ（必須）"))
+	}
+}
+
+// 以前の正規化で保存したキー（テンプレート・import_mappings・別名）も同じ列に当たる
+func TestLegacyHeaderKeyLookup(t *testing.T) {
+	cols := []ColumnInfo{
+		{Index: 1, Original: "Order ID", Normalized: "order_id"},
+		{Index: 2, Original: "Unit Price (JPY)", Normalized: "unit_price"},
+		{Index: 3, Original: "注文番号（必須）", Normalized: "注文番号"},
+	}
+	for _, src := range []RuleSource{
+		{Column: "unit_price_(jpy)"},
+		{Normalized: "unit_price_(jpy)"},
+	} {
+		if i, ok := resolveColumn(&src, cols); !ok || i != 1 {
+			t.Errorf("%+v: got %d, %v", src, i, ok)
+		}
+	}
+	if i, ok := resolveColumn(&RuleSource{Column: "注文番号（必須）"}, cols); !ok || i != 2 {
+		t.Errorf("original: got %d, %v", i, ok)
+	}
+
+	now := time.Now()
+	got := suggestMapping([]string{"price"}, []string{"Order ID", "Unit Price (JPY)"},
+		[]Alias{{ID: "a1", TargetField: "price", Alias: "unit_price_(jpy)", Hits: 2, Weight: 1, LastSeenAt: &now}}, now)
+	if got[0].Source == nil || *got[0].Source != "Unit Price (JPY)" || got[0].Reason != "alias" {
+		t.Fatalf("suggest = %+v", got[0])
+	}
+}
+
+func TestASCIIHeaderKey(t *testing.T) {
+	cases := map[string]string{
+		"注文番号":       "order_number",
+		"商品名":        "product_name",
+		"メールアドレス":    "email",
+		"売上_数量":      "sales_quantity",
+		"キャンペーン":     "kyanpen",
+		"ショップid":     "shoppu_id",
+		"unit_price": "unit_price",
+		"謎":          "",
+	}
+	for in, want := range cases {
+		if got := asciiHeaderKey(in); got != want {
+			t.Errorf("asciiHeaderKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildPreviewJapaneseHeader(t *testing.T) {
+	// 漢字・かなのヘッダも語として数える（以前は英字だけだったのでヘッダなし扱いだった）
+	src := "注文番号（必須）,顧客名,金額（円）\nA-001,山田太郎,1200\nA-002,佐藤花子,980\n"
+	pv, err := buildPreviewWith(strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pv.HasHeader || !reflect.DeepEqual(pv.Headers, []string{"注文番号", "顧客名", "金額"}) {
+		t.Fatalf("preview = %+v", pv)
+	}
+	if !looksLikeHeader([]string{"注文番号", "顧客", "商品"}, []string{"1001", "山田", "りんご"}) {
+		t.Fatal("CJK words should count as header words")
+	}
+
+	pv, err = buildPreviewWith(strings.NewReader(src), &ParseOptions{HeaderKeys: "ascii"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"order_number", "customer_name", "amount"}) ||
+		!reflect.DeepEqual(pv.HeaderLabels, []string{"注文番号", "顧客名", "金額"}) {
+		t.Fatalf("preview = %+v", pv)
+	}
+}
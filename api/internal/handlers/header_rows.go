@@ -0,0 +1,186 @@
+// api/internal/handlers/header_rows.go
+package handlers
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 表題・空行などの前置き行を探す範囲と、複数行ヘッダの行数の上限
+const (
+	headerScanRows = 10
+	maxHeaderRows  = 3
+)
+
+// headerGuess はヘッダの位置（先頭からのレコード番号）と行数（0 = ヘッダなし）
+type headerGuess struct {
+	Row  int
+	Rows int
+}
+
+// detectHeader は Excel から書き出した CSV のような「表題・空行 → (グループ行) → 項目行 → データ」の並びから
+// 本当のヘッダ行を探す。前置き行（埋まったセルが半分以下）を飛ばしながら、先頭 headerScanRows 行まで見る
+func detectHeader(all [][]string) headerGuess {
+	w := tableWidth(all)
+	for i := 0; i < len(all) && i <= headerScanRows; i++ {
+		var next []string
+		if i+1 < len(all) {
+			next = all[i+1]
+		}
+		group := i > 0 && isGroupRow(all[i-1], all[i])
+		if (i == 0 && looksLikeHeader(all[0], next)) || labelHeader(all[i], next, w, group) {
+			if group {
+				return headerGuess{Row: i - 1, Rows: 2}
+			}
+			return headerGuess{Row: i, Rows: 1}
+		}
+		// データ行に当たったら終わり（次の行の上にかかるグループ行なら続ける）
+		if !preambleRow(all[i], w) && (next == nil || !isGroupRow(all[i], next)) {
+			break
+		}
+	}
+	return headerGuess{}
+}
+
+// tableWidth は一番多い列数（同数なら広い方）。表題の行は列が少ないので外れる
+func tableWidth(all [][]string) int {
+	counts := map[int]int{}
+	best, bestN := 0, 0
+	for _, rec := range all {
+		n := len(rec)
+		counts[n]++
+		if counts[n] > bestN || (counts[n] == bestN && n > best) {
+			best, bestN = n, counts[n]
+		}
+	}
+	return best
+}
+
+func filledCells(rec []string) int {
+	n := 0
+	for _, v := range rec {
+		if strings.TrimSpace(v) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// isLabel は項目名らしい値（文字を含み、数値・日時・key=value ではない）
+func isLabel(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" || isNumericLike(s) || isDateTimeLike(s) || isKeyValue(s) {
+		return false
+	}
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+// preambleRow は表題・作成日・空行のような前置き行か（埋まったセルが表の幅の半分以下）
+func preambleRow(rec []string, w int) bool {
+	return filledCells(rec)*2 <= w
+}
+
+// labelHeader は rec が項目行か。表の幅の 6 割以上が項目名で埋まり、次の行に数値・日時がある
+// 上にグループ行があるときは「数量・金額・数量・金額」のような重複を許す
+func labelHeader(rec, next []string, w int, allowDup bool) bool {
+	f := filledCells(rec)
+	if w < 2 || f < 2 || float64(f) < 0.6*float64(w) {
+		return false
+	}
+	seen := map[string]bool{}
+	for _, v := range rec {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !isLabel(v) {
+			return false
+		}
+		if seen[v] && !allowDup {
+			return false
+		}
+		seen[v] = true
+	}
+	if next == nil {
+		return false
+	}
+	nf, data := filledCells(next), 0
+	for _, v := range next {
+		v = strings.TrimSpace(v)
+		if v != "" && (isNumericLike(v) || isDateTimeLike(v)) {
+			data++
+		}
+	}
+	return data > 0 && float64(data) >= 0.2*float64(nf)
+}
+
+// isGroupRow は group が field の上にかかるグループ行（「売上」が「数量・金額」の 2 列にまたがる）か
+// 先頭列だけの表題（"売上一覧,,,"）はグループとみなさない
+func isGroupRow(group, field []string) bool {
+	if len(group) < 2 {
+		return false
+	}
+	first, spans := -1, false
+	for c, v := range group {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			// 左のグループの続き（上が空で下に項目がある）
+			if first >= 0 && c < len(field) && strings.TrimSpace(field[c]) != "" &&
+				strings.TrimSpace(field[c-1]) != "" {
+				spans = true
+			}
+			continue
+		}
+		if !isLabel(v) {
+			return false
+		}
+		if first < 0 {
+			first = c
+		}
+	}
+	if first < 0 || (filledCells(group) == 1 && first == 0) {
+		return false
+	}
+	return spans
+}
+
+// mergeHeaderRows は複数行のヘッダを「グループ_項目」の 1 行にする（売上_数量）
+// 横に結合されたセルは左の値が右へ続き、縦に結合されたセル（上だけ埋まった「日付」）はそのまま使う
+func mergeHeaderRows(rows [][]string) []string {
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	cell := func(r []string, c int) string {
+		if c < len(r) {
+			return strings.TrimSpace(r[c])
+		}
+		return ""
+	}
+	last := rows[len(rows)-1]
+	filled := make([][]string, len(rows)-1)
+	for i, r := range rows[:len(rows)-1] {
+		filled[i] = make([]string, width)
+		for c := 0; c < width; c++ {
+			v := cell(r, c)
+			if v == "" && c > 0 && cell(last, c) != "" && cell(last, c-1) != "" {
+				v = filled[i][c-1]
+			}
+			filled[i][c] = v
+		}
+	}
+	out := make([]string, width)
+	for c := range out {
+		var parts []string
+		for i := range filled {
+			if v := filled[i][c]; v != "" && (len(parts) == 0 || parts[len(parts)-1] != v) {
+				parts = append(parts, v)
+			}
+		}
+		if v := cell(last, c); v != "" && (len(parts) == 0 || parts[len(parts)-1] != v) {
+			parts = append(parts, v)
+		}
+		out[c] = strings.Join(parts, "_")
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPreviewTitleAndTwoRowHeader(t *testing.T) {
+	// Excel から書き出した CSV：表題・空行・グループ行・項目行
+	src := "2024年6月 売上一覧\n" +
+		",,,,,\n" +
+		"日付,店舗,売上,,仕入,\n" +
+		",,数量,金額,数量,金額\n" +
+		"2024-06-01,渋谷,3,1200,2,600\n" +
+		"2024-06-02,新宿,5,2000,1,300\n"
+	pv, err := buildPreviewWith(strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pv.HasHeader || pv.HeaderRow != 2 || pv.HeaderRows != 2 || pv.RowCount != 2 {
+		t.Fatalf("preview = %+v", pv)
+	}
+	want := []string{"日付", "店舗", "売上_数量", "売上_金額", "仕入_数量", "仕入_金額"}
+	if !reflect.DeepEqual(pv.Headers, want) {
+		t.Fatalf("headers = %q, want %q", pv.Headers, want)
+	}
+	if len(pv.Preamble) != 2 || pv.Preamble[0][0] != "2024年6月 売上一覧" {
+		t.Fatalf("preamble = %q", pv.Preamble)
+	}
+	if !reflect.DeepEqual(pv.SampleRows[0], []string{"2024-06-01", "渋谷", "3", "1200", "2", "600"}) {
+		t.Fatalf("rows = %q", pv.SampleRows)
+	}
+
+	// 表題 1 行 + 1 行ヘッダ
+	pv, err = buildPreviewWith(strings.NewReader("受注一覧（2024/06）\n注文番号,顧客,金額\nA-1,山田,980\nA-2,佐藤,1200\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.HeaderRow != 1 || pv.HeaderRows != 1 || !reflect.DeepEqual(pv.Headers, []string{"注文番号", "顧客", "金額"}) || pv.RowCount != 2 {
+		t.Fatalf("preview = %+v", pv)
+	}
+
+	// ヘッダの無いデータは今までどおり col_N
+	pv, err = buildPreviewWith(strings.NewReader("2024-07-01,east,3\n2024-07-02,west,5\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.HasHeader || pv.RowCount != 2 || len(pv.Preamble) != 0 {
+		t.Fatalf("preview = %+v", pv)
+	}
+}
+
+func TestBuildPreviewHeaderRowsOption(t *testing.T) {
+	src := "区分,A,,B,\n,x,y,x,y\n1,2,3,4,5\n"
+	opts := &ParseOptions{HeaderRow: intp(0), HeaderRows: 2}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	pv, err := buildPreviewWith(strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"区分", "a_x", "a_y", "b_x", "b_y"}) || pv.RowCount != 1 {
+		t.Fatalf("preview = %+v", pv)
+	}
+	for _, bad := range []ParseOptions{{HeaderRows: 4}, {HeaderRow: intp(-1), HeaderRows: 2}, {Format: "json", HeaderRows: 1}} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v should be rejected", bad)
+		}
+	}
+}
+
+func TestMergeHeaderRows(t *testing.T) {
+	got := mergeHeaderRows([][]string{
+		{"売上一覧", "", ""},
+		{"売上", "", "備考"},
+		{"数量", "金額", ""},
+	})
+	// 先頭行の表題は右へ続く（3 行ヘッダを明示したとき）
+	want := []string{"売上一覧_売上_数量", "売上一覧_売上_金額", "備考"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,1021 @@
+// api/internal/handlers/import_jobs.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/blob"
+	"csv-import-kit/api/internal/jobs"
+	"csv-import-kit/api/internal/webhooks"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ジョブ種別（jobs.type）
+// parse: 元ファイル → import_rows_raw / apply: マッピング → normalized_json
+// validate: detected_errors / commit: contacts へ確定
+const (
+	JobParse    = "parse"
+	JobApply    = "apply"
+	JobValidate = "validate"
+	JobCommit   = "commit"
+)
+
+// 1 トランザクションで扱う行数
+const jobBatchSize = 1000
+
+type parsePayload struct {
+	Key     string        `json:"key,omitempty"`     // BlobStore のキー
+	Path    string        `json:"path,omitempty"`    // 旧形式（ローカルパス）
+	Options *ParseOptions `json:"options,omitempty"` // 省略時は推定
+}
+
+type applyPayload struct {
+	Rules      json.RawMessage `json:"rules,omitempty"`      // 省略時は import_mappings
+	TemplateID string          `json:"templateId,omitempty"` // rules の代わりにテンプレート
+}
+
+// ImportJob は GET /api/jobs/{id} のレスポンス
+type ImportJob struct {
+	ID              string          `json:"id"`
+	ImportID        *string         `json:"import_id"`
+	Type            string          `json:"type"`
+	Status          string          `json:"status"`
+	Progress        float32         `json:"progress"` // 0〜100
+	RowsTotal       int             `json:"rows_total"`
+	RowsDone        int             `json:"rows_done"`
+	RowsFailed      int             `json:"rows_failed"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"max_attempts"`
+	CancelRequested bool            `json:"cancel_requested"`
+	LastError       *string         `json:"last_error,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	RunAt           time.Time       `json:"run_at"`
+	CreatedBy       *string         `json:"created_by,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+}
+
+const jobColumns = `id, import_id, type, status, progress, rows_total, rows_done, rows_failed, attempts, max_attempts,
+cancel_requested, last_error, result, run_at, created_by, created_at, updated_at, finished_at`
+
+func scanJob(row pgx.Row) (ImportJob, error) {
+	var j ImportJob
+	err := row.Scan(&j.ID, &j.ImportID, &j.Type, &j.Status, &j.Progress, &j.RowsTotal, &j.RowsDone, &j.RowsFailed,
+		&j.Attempts, &j.MaxAttempts, &j.CancelRequested, &j.LastError, &j.Result, &j.RunAt, &j.CreatedBy,
+		&j.CreatedAt, &j.UpdatedAt, &j.FinishedAt)
+	return j, err
+}
+
+var errJobActive = errors.New("another job is queued or running for this import")
+
+// ===== HTTP =====
+
+// EnqueueJob は POST /api/imports/{id}/{parse|apply|validate|commit} のハンドラを返す（202 + ジョブ）
+// 状態の前提（commit は ready_to_commit のみ等）はここで見て、実行時にも再確認する
+func (h *ImportHandler) EnqueueJob(typ string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload interface{}
+		if typ == JobApply {
+			var in applyPayload
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if hasRules(in.Rules) && in.TemplateID != "" {
+				http.Error(w, "specify either rules or templateId, not both", http.StatusBadRequest)
+				return
+			}
+			// 不正なルールはキューに入れる前に 422
+			if hasRules(in.Rules) {
+				if _, issues := parseRules(in.Rules); len(issues) > 0 {
+					writeRuleIssues(w, issues)
+					return
+				}
+			}
+			payload = in
+		}
+		h.enqueueJob(w, r, typ, payload, nil)
+	}
+}
+
+// POST /api/imports/{id}/reparse
+// 読み取り設定を明示して元ファイルを読み直す（取り込み済みの行は置き換え、status は uploaded に戻る）
+func (h *ImportHandler) Reparse(w http.ResponseWriter, r *http.Request) {
+	var opts ParseOptions
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&opts)
+	if errors.Is(err, io.EOF) {
+		// 本文が空なら前回記録した設定のまま読み直す
+		h.enqueueJob(w, r, JobParse, nil, nil)
+		return
+	}
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := opts.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	h.enqueueJob(w, r, JobParse, nil, &opts)
+}
+
+// enqueueJob はジョブを積んで 202 を返す（reparse のときだけ opts を受け取る）
+func (h *ImportHandler) enqueueJob(w http.ResponseWriter, r *http.Request, typ string, payload interface{}, opts *ParseOptions) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	p := PrincipalFrom(r.Context())
+	var out ImportJob
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var status string
+		if err := tx.QueryRow(ctx, `select status from public.imports where id = $1 for update`, id).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errImportNotFound
+			}
+			return err
+		}
+		if status == "committed" {
+			return errImportCommitted
+		}
+		if typ == JobCommit && status != "ready_to_commit" {
+			return fmt.Errorf("%w: import is %s (run validate first)", errImportState, status)
+		}
+		if typ == JobParse {
+			// 再取り込みは保存してある元ファイルを読む（元ファイルの保存より前のインポートは最初のジョブと同じパス）
+			// 設定の指定が無ければ前回 reparse で記録した設定で読む
+			var pl parsePayload
+			err := tx.QueryRow(ctx, `
+select coalesce(i.original_key, ''),
+       coalesce((select payload->>'path' from public.jobs
+                 where import_id = i.id and type = 'parse' order by created_at limit 1), ''),
+       i.parse_options
+from public.imports i where i.id = $1`, id).Scan(&pl.Key, &pl.Path, &pl.Options)
+			if err != nil || (pl.Key == "" && pl.Path == "") {
+				return fmt.Errorf("%w: original file is not available", errImportState)
+			}
+			if pl.Key != "" {
+				pl.Path = ""
+			}
+			// 読み直す間に前回の apply / validate の結果で確定されないよう、status と派生列を先に戻す
+			before := pl.Options
+			if opts != nil {
+				pl.Options = opts
+			}
+			const upd = `update public.imports set parse_options = $2, status = 'uploaded', updated_at = now() where id = $1`
+			if _, err := tx.Exec(ctx, upd, id, pl.Options); err != nil {
+				return err
+			}
+			const clear = `
+update public.import_rows_raw set normalized_json = null, detected_errors = null
+where import_id = $1 and (normalized_json is not null or detected_errors is not null)`
+			if _, err := tx.Exec(ctx, clear, id); err != nil {
+				return err
+			}
+			if opts != nil || status != "uploaded" {
+				if err := writeAudit(ctx, tx, p, auditRecord{
+					Action: AuditImportReparse, ImportID: &id, TargetType: "import", TargetID: id,
+					Before: map[string]interface{}{"status": status, "parse_options": before},
+					After:  map[string]interface{}{"status": "uploaded", "parse_options": pl.Options},
+				}); err != nil {
+					return err
+				}
+			}
+			payload = pl
+		}
+
+		jobID, err := jobs.Enqueue(ctx, tx, jobs.Spec{Type: typ, ImportID: id, Payload: payload, CreatedBy: p.Actor()})
+		if isUniqueViolation(err) {
+			return errJobActive
+		}
+		if err != nil {
+			return err
+		}
+		out, err = scanJob(tx.QueryRow(ctx, `select `+jobColumns+` from public.jobs where id = $1`, jobID))
+		return err
+	})
+	switch {
+	case errors.Is(err, errImportNotFound):
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errImportCommitted), errors.Is(err, errJobActive), errors.Is(err, errImportState):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+out.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+var errImportState = errors.New("import is not in the required state")
+
+// POST /api/imports/{id}/rollback
+// 確定した行（contacts.import_id がこのインポート）を消して rolled_back にする。ジョブにはせず、同じトランザクションで監査ログを書く
+func (h *ImportHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var deleted int64
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var status string
+		if err := tx.QueryRow(ctx, `select status from public.imports where id = $1 for update`, id).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errImportNotFound
+			}
+			return err
+		}
+		if status != "committed" {
+			return fmt.Errorf("%w: import is %s", errImportState, status)
+		}
+		ct, err := tx.Exec(ctx, `delete from public.contacts where import_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		deleted = ct.RowsAffected()
+		if _, err := tx.Exec(ctx, `update public.imports set status = 'rolled_back', updated_at = now() where id = $1`, id); err != nil {
+			return err
+		}
+		// commit で学習した別名を取り消す（学習と同じ apply 時点のマッピング）
+		applied, err := loadAppliedMappings(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := learnAliases(ctx, tx, applied.SchemaKey, applied.Mappings, nil); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditImportRollback, ImportID: &id, TargetType: "import", TargetID: id,
+			Before: map[string]interface{}{"status": status},
+			After:  map[string]interface{}{"status": "rolled_back"},
+			Extra:  map[string]interface{}{"deleted": deleted},
+		})
+	})
+	switch {
+	case errors.Is(err, errImportNotFound):
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errImportState):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"import_id": id, "status": "rolled_back", "deleted": deleted})
+}
+
+// GET /api/jobs/{id}
+func (h *ImportHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out ImportJob
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = scanJob(tx.QueryRow(ctx, `select `+jobColumns+` from public.jobs where id = $1`, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/imports/{id}/jobs  （新しい順）
+func (h *ImportHandler) ListImportJobs(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := make([]ImportJob, 0)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `select `+jobColumns+` from public.jobs where import_id = $1 order by created_at desc`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			j, err := scanJob(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, j)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/jobs/{id}/cancel
+// queued は即 cancelled。running はワーカーが次の heartbeat で止める（レスポンスは cancel_requested=true）
+func (h *ImportHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out ImportJob
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		if _, err := jobs.Cancel(ctx, tx, id); err != nil {
+			return err
+		}
+		var err error
+		out, err = scanJob(tx.QueryRow(ctx, `select `+jobColumns+` from public.jobs where id = $1`, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ===== ワーカー側 =====
+
+// RegisterJobs は取り込みジョブのハンドラを runner に登録する
+func (h *ImportHandler) RegisterJobs(r *jobs.Runner) {
+	r.Register(JobParse, h.runParse)
+	r.Register(JobApply, h.runApply)
+	r.Register(JobValidate, h.runValidate)
+	r.Register(JobCommit, h.runCommit)
+	r.OnFinalFailure = h.onJobFailed
+}
+
+// onJobFailed はリトライを使い切ったら imports を failed にして監査ログを残す
+func (h *ImportHandler) onJobFailed(ctx context.Context, j *jobs.Job, jobErr error) {
+	if j.ImportID == nil {
+		return
+	}
+	id := *j.ImportID
+	err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update public.imports set status = 'failed', updated_at = now() where id = $1 and status <> 'committed'`, id); err != nil {
+			return err
+		}
+		err := writeAuditAs(ctx, tx, j.WorkspaceID, derefString(j.CreatedBy), auditRecord{
+			Action: AuditImportFailed, ImportID: &id, TargetType: "import", TargetID: id,
+			Extra: map[string]interface{}{"job_id": j.ID, "job_type": j.Type, "attempts": j.Attempts, "error": jobErr.Error()},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = webhooks.Enqueue(ctx, tx, webhooks.EventImportFailed, importWebhookData(id, "failed", j, map[string]interface{}{
+			"job_type": j.Type, "error": jobErr.Error(),
+		}))
+		return err
+	})
+	if err != nil {
+		// ジョブ自体は failed 済みなので、ここは記録できなかっただけ
+		slog.Error("mark import failed", "import_id", id, "err", err)
+	}
+}
+
+// importWebhookData は webhook の data（確定・失敗と同じトランザクションで積む）
+func importWebhookData(importID, status string, j *jobs.Job, detail map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{"import_id": importID, "status": status, "job_id": j.ID}
+	for k, v := range detail {
+		out[k] = v
+	}
+	return out
+}
+
+// importHeaders は imports.sample のヘッダ（プレビュー時の正規化済み列名）
+func importHeaders(ctx context.Context, tx pgx.Tx, id string) (string, []string, error) {
+	var status string
+	var headers []string
+	err := tx.QueryRow(ctx, `
+select status, coalesce(array(select jsonb_array_elements_text(sample->'headers')), '{}')
+from public.imports where id = $1`, id).Scan(&status, &headers)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, jobs.Permanent(errImportNotFound)
+	}
+	return status, headers, err
+}
+
+// importColumns はプレビューの columns（元の表記・列番号でルールを当てるため）
+// columns を保存していない古いインポートは headers から作る
+func importColumns(ctx context.Context, tx pgx.Tx, id string, headers []string) ([]ColumnInfo, error) {
+	var raw []byte
+	if err := tx.QueryRow(ctx, `select sample->'columns' from public.imports where id = $1`, id).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var cols []ColumnInfo
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cols); err != nil {
+			return nil, err
+		}
+	}
+	if len(cols) != len(headers) {
+		return columnsFromHeaders(headers), nil
+	}
+	return cols, nil
+}
+
+// rowObject はレコードを {ヘッダ: 値} にする（ヘッダより多い列は col_N）
+func rowObject(headers, rec []string) map[string]string {
+	out := make(map[string]string, len(rec))
+	for i, v := range rec {
+		key := "col_" + strconv.Itoa(i+1)
+		if i < len(headers) {
+			key = headers[i]
+		}
+		out[key] = v
+	}
+	return out
+}
+
+// rowArray は rowObject の逆（applyRules に渡すため headers の順に並べる）
+func rowArray(headers []string, obj map[string]string) []string {
+	out := make([]string, len(headers))
+	for i, h := range headers {
+		out[i] = obj[h]
+	}
+	return out
+}
+
+// runParse は元ファイルを全行読み、import_rows_raw を作り直す
+func (h *ImportHandler) runParse(ctx context.Context, j *jobs.Job, p *jobs.Progress) (interface{}, error) {
+	var pl parsePayload
+	if err := json.Unmarshal(j.Payload, &pl); err != nil || (pl.Key == "" && pl.Path == "") {
+		return nil, jobs.Permanent(fmt.Errorf("invalid payload"))
+	}
+	importID := derefString(j.ImportID)
+
+	// 1 周目で区切り文字・ヘッダ・行数、2 周目で取り込み（ファイル全体はメモリに載せない）
+	f, err := h.openOriginal(ctx, pl)
+	if err != nil {
+		return nil, err
+	}
+	pv, err := buildPreviewWith(f, pl.Options)
+	f.Close()
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("csv parse error: %w", err))
+	}
+	if f, err = h.openOriginal(ctx, pl); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, _, err := openRecords(f, pl.Options)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	// 表題などの前置き行とヘッダ行を飛ばす
+	for i := 0; i < pv.dataOffset; i++ {
+		if _, err := reader.Read(); err != nil {
+			return nil, jobs.Permanent(err)
+		}
+	}
+
+	// 途中で失敗してリトライしても重複しないよう、最初に消してから入れ直す
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `delete from public.import_rows_raw where import_id = $1`, importID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	const ins = `insert into public.import_rows_raw (import_id, row_index, raw_json) values ($1, $2, $3::jsonb)`
+	n := 0
+	done := false
+	for !done {
+		batch := &pgx.Batch{}
+		for batch.Len() < jobBatchSize {
+			rec, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return nil, jobs.Permanent(fmt.Errorf("csv parse error at row %d: %w", n+1, err))
+			}
+			b, _ := json.Marshal(rowObject(pv.Headers, rec))
+			batch.Queue(ins, importID, n, string(b))
+			n++
+		}
+		if batch.Len() > 0 {
+			err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+				return tx.SendBatch(ctx, batch).Close()
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := p.Report(ctx, jobs.Counters{Total: pv.RowCount, Done: n}); err != nil {
+			return nil, err
+		}
+	}
+
+	// ヘッダ・サンプルも読み直した結果にそろえる（読み取り設定を変えたときに変わる）
+	sample, err := previewSample(&pv)
+	if err != nil {
+		return nil, err
+	}
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `update public.imports set row_count = $2, sample = $3::jsonb, updated_at = now() where id = $1`,
+			importID, n, string(sample))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = p.Report(ctx, jobs.Counters{Total: n, Done: n})
+	return map[string]int{"rows": n}, nil
+}
+
+// openOriginal は parse ジョブの元ファイルを開く（無ければリトライしても無駄なので Permanent）
+func (h *ImportHandler) openOriginal(ctx context.Context, pl parsePayload) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	var err error
+	if pl.Key != "" {
+		rc, err = h.blobs().Get(ctx, pl.Key)
+	} else {
+		rc, err = os.Open(pl.Path)
+	}
+	if errors.Is(err, blob.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return nil, jobs.Permanent(fmt.Errorf("read original file: %w", err))
+	}
+	return rc, err
+}
+
+// jobRules は apply に使うルール（payload の rules / templateId、無ければ保存済みの import_mappings）
+// 列番号で書いたテンプレートなら前提の列数も返す（checkColumnCount）
+// 保存済みマッピングで適用するときはその内容も返す（commit で学習する元。ルール / テンプレートなら空）
+func (h *ImportHandler) jobRules(ctx context.Context, j *jobs.Job) (RuleSet, int, appliedMappings, error) {
+	var pl applyPayload
+	if len(j.Payload) > 0 {
+		if err := json.Unmarshal(j.Payload, &pl); err != nil {
+			return nil, 0, appliedMappings{}, jobs.Permanent(fmt.Errorf("invalid payload"))
+		}
+	}
+	var rules RuleSet
+	var issues []RuleIssue
+	columnCount := 0
+	applied := appliedMappings{Mappings: []ImportMapping{}}
+	switch {
+	case hasRules(pl.Rules):
+		rules, issues = parseRules(pl.Rules)
+	case pl.TemplateID != "":
+		var err error
+		rules, columnCount, issues, err = (&MappingHandler{Store: h.Store}).loadTemplateRules(ctx, j.WorkspaceID, pl.TemplateID)
+		if errors.Is(err, errTemplateNotFound) {
+			return nil, 0, applied, jobs.Permanent(err)
+		}
+		if err != nil {
+			return nil, 0, applied, err
+		}
+	default:
+		rules = RuleSet{}
+		err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+			saved, err := loadImportMappings(ctx, tx, derefString(j.ImportID), false)
+			if err != nil {
+				return err
+			}
+			applied = appliedMappings{SchemaKey: derefString(saved.SchemaKey), Mappings: saved.Mappings}
+			for _, m := range saved.Mappings {
+				if m.Target != nil {
+					rules[*m.Target] = &RuleSource{Column: m.Source}
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, errImportNotFound) {
+			return nil, 0, applied, jobs.Permanent(err)
+		}
+		if err != nil {
+			return nil, 0, applied, err
+		}
+		if len(rules) == 0 {
+			return nil, 0, applied, jobs.Permanent(errors.New("no mappings saved for this import (PUT /api/imports/{id}/mappings first)"))
+		}
+	}
+	if len(issues) > 0 {
+		return nil, 0, applied, jobs.Permanent(fmt.Errorf("invalid rules: %s %s", issues[0].Path, issues[0].Reason))
+	}
+	return rules, columnCount, applied, nil
+}
+
+// appliedMappings は apply で使った保存済みマッピング（imports.applied_mappings）
+// apply の後に PUT で変えたマッピングは normalized_json に入っていないので、学習・取り消しはこちらを使う
+type appliedMappings struct {
+	SchemaKey string          `json:"schemaKey,omitempty"`
+	Mappings  []ImportMapping `json:"mappings"`
+}
+
+// loadAppliedMappings は apply で使ったマッピングを返す（記録より前に apply したインポートは保存済みのもの）
+func loadAppliedMappings(ctx context.Context, tx pgx.Tx, id string) (appliedMappings, error) {
+	var raw []byte
+	if err := tx.QueryRow(ctx, `select applied_mappings from public.imports where id = $1`, id).Scan(&raw); err != nil {
+		return appliedMappings{}, err
+	}
+	if raw != nil {
+		var out appliedMappings
+		err := json.Unmarshal(raw, &out)
+		return out, err
+	}
+	saved, err := loadImportMappings(ctx, tx, id, false)
+	if err != nil {
+		return appliedMappings{}, err
+	}
+	return appliedMappings{SchemaKey: derefString(saved.SchemaKey), Mappings: saved.Mappings}, nil
+}
+
+// stagedRow は import_rows_raw の 1 行
+type stagedRow struct {
+	Index      int
+	Raw        map[string]string
+	Normalized map[string]string
+}
+
+// eachStagedBatch は row_index 順に jobBatchSize 件ずつ fn に渡す（fn は同じトランザクションで更新する）
+func (h *ImportHandler) eachStagedBatch(ctx context.Context, j *jobs.Job, where string, fn func(tx pgx.Tx, rows []stagedRow) error) error {
+	importID := derefString(j.ImportID)
+	last := -1
+	for {
+		var n int
+		err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+			q := `
+select row_index, raw_json, normalized_json from public.import_rows_raw
+where import_id = $1 and row_index > $2` + where + `
+order by row_index
+limit ` + strconv.Itoa(jobBatchSize)
+			rows, err := tx.Query(ctx, q, importID, last)
+			if err != nil {
+				return err
+			}
+			batch := make([]stagedRow, 0, jobBatchSize)
+			for rows.Next() {
+				var r stagedRow
+				if err := rows.Scan(&r.Index, &r.Raw, &r.Normalized); err != nil {
+					rows.Close()
+					return err
+				}
+				batch = append(batch, r)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			n = len(batch)
+			if n == 0 {
+				return nil
+			}
+			last = batch[n-1].Index
+			return fn(tx, batch)
+		})
+		if err != nil {
+			return err
+		}
+		if n < jobBatchSize {
+			return nil
+		}
+	}
+}
+
+func (h *ImportHandler) countStaged(ctx context.Context, j *jobs.Job, where string) (int, error) {
+	var n int
+	err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `select count(*) from public.import_rows_raw where import_id = $1`+where, derefString(j.ImportID)).Scan(&n)
+	})
+	return n, err
+}
+
+// runApply はルールを全行に適用して normalized_json を作る（検証結果はクリア）
+func (h *ImportHandler) runApply(ctx context.Context, j *jobs.Job, p *jobs.Progress) (interface{}, error) {
+	rules, columnCount, applied, err := h.jobRules(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+	var headers []string
+	var cols []ColumnInfo
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		var err error
+		if _, headers, err = importHeaders(ctx, tx, derefString(j.ImportID)); err != nil {
+			return err
+		}
+		cols, err = importColumns(ctx, tx, derefString(j.ImportID), headers)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkColumnCount(columnCount, len(cols)); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	total, err := h.countStaged(ctx, j, "")
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, jobs.Permanent(errors.New("no staged rows (run parse first)"))
+	}
+
+	const upd = `update public.import_rows_raw set normalized_json = $3::jsonb, detected_errors = null where import_id = $1 and row_index = $2`
+	done := 0
+	err = h.eachStagedBatch(ctx, j, "", func(tx pgx.Tx, rows []stagedRow) error {
+		arr := make([][]string, len(rows))
+		for i, r := range rows {
+			arr[i] = rowArray(headers, r.Raw)
+		}
+		res := applyRules(rules, cols, arr)
+		batch := &pgx.Batch{}
+		for i, r := range rows {
+			obj := make(map[string]string, len(res.NormalizedHeaders))
+			for k, dest := range res.NormalizedHeaders {
+				obj[dest] = res.NormalizedRows[i][k]
+			}
+			b, _ := json.Marshal(obj)
+			batch.Queue(upd, derefString(j.ImportID), r.Index, string(b))
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		done += len(rows)
+		return p.Report(ctx, jobs.Counters{Total: total, Done: done})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 適用し直したら検証もやり直し。使ったマッピングは commit で学習するために残す
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		const upd = `update public.imports set status = 'mapping', applied_mappings = $2, updated_at = now() where id = $1 and status <> 'committed'`
+		_, err := tx.Exec(ctx, upd, derefString(j.ImportID), applied)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"rows": done, "fields": rules.Dests()}, nil
+}
+
+// runValidate は normalized_json を検証して detected_errors を付け、ready_to_commit にする
+func (h *ImportHandler) runValidate(ctx context.Context, j *jobs.Job, p *jobs.Progress) (interface{}, error) {
+	importID := derefString(j.ImportID)
+	const notNull = ` and normalized_json is not null`
+	total, err := h.countStaged(ctx, j, notNull)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, jobs.Permanent(errors.New("no mapped rows (run apply first)"))
+	}
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `update public.imports set status = 'validating', updated_at = now() where id = $1`, importID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	const upd = `update public.import_rows_raw set detected_errors = $3::jsonb where import_id = $1 and row_index = $2`
+	done, failed := 0, 0
+	codes := map[string]int{}
+	err = h.eachStagedBatch(ctx, j, notNull, func(tx pgx.Tx, rows []stagedRow) error {
+		batch := &pgx.Batch{}
+		for _, r := range rows {
+			errs := validateRow(r.Normalized)
+			var v interface{}
+			if len(errs) > 0 {
+				failed++
+				for _, e := range errs {
+					codes[e]++
+				}
+				b, _ := json.Marshal(errs)
+				v = string(b)
+			}
+			batch.Queue(upd, importID, r.Index, v)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		done += len(rows)
+		return p.Report(ctx, jobs.Counters{Total: total, Done: done, Failed: failed})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{"rows": done, "valid": done - failed, "invalid": failed, "errors": codes}
+	err = h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update public.imports set status = 'ready_to_commit', updated_at = now() where id = $1`, importID); err != nil {
+			return err
+		}
+		err := writeAuditAs(ctx, tx, j.WorkspaceID, derefString(j.CreatedBy), auditRecord{
+			Action: AuditImportValidate, ImportID: &importID, TargetType: "import", TargetID: importID,
+			Extra: map[string]interface{}{"job_id": j.ID, "result": result},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = webhooks.Enqueue(ctx, tx, webhooks.EventImportValidated, importWebhookData(importID, "ready_to_commit", j, result))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// contactColumns は確定先 contacts の列（normalized_json の同名キーを入れる）
+var contactColumns = []string{"name", "email", "phone", "address_line1", "city", "postal_code", "country"}
+
+// runCommit はエラーの無い行を 1 トランザクションで contacts に入れる（途中で失敗したら何も入らない）
+func (h *ImportHandler) runCommit(ctx context.Context, j *jobs.Job, p *jobs.Progress) (interface{}, error) {
+	importID := derefString(j.ImportID)
+	var result map[string]interface{}
+	err := h.Store.InWorkspace(ctx, j.WorkspaceID, func(tx pgx.Tx) error {
+		var status string
+		if err := tx.QueryRow(ctx, `select status from public.imports where id = $1 for update`, importID).Scan(&status); err != nil {
+			return err
+		}
+		if status != "ready_to_commit" {
+			return jobs.Permanent(fmt.Errorf("%w: import is %s", errImportState, status))
+		}
+
+		var mapped bool
+		err := tx.QueryRow(ctx, `
+select exists (select 1 from public.import_rows_raw where import_id = $1 and normalized_json ?| $2)`,
+			importID, contactColumns).Scan(&mapped)
+		if err != nil {
+			return err
+		}
+		if !mapped {
+			return jobs.Permanent(fmt.Errorf("no contacts fields are mapped (%s)", strings.Join(contactColumns, ", ")))
+		}
+
+		sel := make([]string, len(contactColumns))
+		for i, c := range contactColumns {
+			sel[i] = "nullif(r.normalized_json->>'" + c + "', '')"
+		}
+		q := `
+insert into public.contacts (import_id, ` + strings.Join(contactColumns, ", ") + `)
+select r.import_id, ` + strings.Join(sel, ", ") + `
+from public.import_rows_raw r
+where r.import_id = $1 and r.normalized_json is not null
+  and coalesce(jsonb_array_length(r.detected_errors), 0) = 0
+order by r.row_index;
+`
+		ct, err := tx.Exec(ctx, q, importID)
+		if err != nil {
+			return err
+		}
+		var skipped int
+		err = tx.QueryRow(ctx, `
+select count(*) from public.import_rows_raw
+where import_id = $1 and coalesce(jsonb_array_length(detected_errors), 0) > 0`, importID).Scan(&skipped)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `update public.imports set status = 'committed', updated_at = now() where id = $1`, importID); err != nil {
+			return err
+		}
+
+		// 確定した行に当てたマッピング（apply 時点）の上書きを別名として学習する
+		applied, err := loadAppliedMappings(ctx, tx, importID)
+		if err != nil {
+			return err
+		}
+		if err := learnAliases(ctx, tx, applied.SchemaKey, nil, applied.Mappings); err != nil {
+			return err
+		}
+
+		inserted := int(ct.RowsAffected())
+		result = map[string]interface{}{"inserted": inserted, "skipped": skipped}
+		if err := p.Report(ctx, jobs.Counters{Total: inserted + skipped, Done: inserted + skipped, Failed: skipped}); err != nil {
+			return err
+		}
+		err = writeAuditAs(ctx, tx, j.WorkspaceID, derefString(j.CreatedBy), auditRecord{
+			Action: AuditImportCommit, ImportID: &importID, TargetType: "import", TargetID: importID,
+			Before: map[string]interface{}{"status": status},
+			After:  map[string]interface{}{"status": "committed"},
+			Extra:  map[string]interface{}{"job_id": j.ID, "result": result},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = webhooks.Enqueue(ctx, tx, webhooks.EventImportCommitted, importWebhookData(importID, "committed", j, result))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ===== 行の検証 =====
+
+var (
+	emailRe = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phoneRe = regexp.MustCompile(`^\+?[0-9()\- ]{6,}$`)
+)
+
+var dateLayouts = []string{"2006-01-02", "2006/01/02", "2006/1/2", "2006-1-2", "20060102", time.RFC3339, "2006-01-02 15:04:05"}
+
+// validateRow は項目名から型を推して値を検証する（空欄は対象外）
+// エラーは "<code>:<項目>"（例 "invalid_email:email"）
+func validateRow(row map[string]string) []string {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []string
+	for _, k := range keys {
+		v := strings.TrimSpace(row[k])
+		if v == "" {
+			continue
+		}
+		switch fieldKind(k) {
+		case "email":
+			if !emailRe.MatchString(v) {
+				errs = append(errs, "invalid_email:"+k)
+			}
+		case "phone":
+			if !phoneRe.MatchString(v) {
+				errs = append(errs, "invalid_phone:"+k)
+			}
+		case "date":
+			if !isDate(v) {
+				errs = append(errs, "invalid_date:"+k)
+			}
+		case "number":
+			if _, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64); err != nil {
+				errs = append(errs, "invalid_number:"+k)
+			}
+		}
+	}
+	return errs
+}
+
+func fieldKind(k string) string {
+	switch {
+	case strings.Contains(k, "email"):
+		return "email"
+	case strings.Contains(k, "phone") || strings.HasSuffix(k, "tel"):
+		return "phone"
+	case strings.HasSuffix(k, "date") || strings.HasSuffix(k, "_at"):
+		return "date"
+	case k == "quantity" || k == "qty" || strings.HasSuffix(k, "price") || strings.HasSuffix(k, "amount") || strings.HasSuffix(k, "total"):
+		return "number"
+	}
+	return ""
+}
+
+func isDate(v string) bool {
+	for _, l := range dateLayouts {
+		if _, err := time.Parse(l, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
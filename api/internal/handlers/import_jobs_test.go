@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestValidateRow(t *testing.T) {
+	got := validateRow(map[string]string{
+		"name":       "山田",
+		"email":      "yamada@example",
+		"phone":      "03-1234-5678",
+		"order_date": "2026/13/01",
+		"quantity":   "1,200",
+		"unit_price": "abc",
+		"ship_date":  "",
+	})
+	want := []string{"invalid_email:email", "invalid_date:order_date", "invalid_number:unit_price"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if errs := validateRow(map[string]string{"email": "a@b.co", "order_date": "2026-01-02"}); len(errs) != 0 {
+		t.Fatalf("valid row: %v", errs)
+	}
+}
+
+func TestRowObjectRoundTrip(t *testing.T) {
+	headers := []string{"a", "b"}
+	obj := rowObject(headers, []string{"1", "2", "3"})
+	if obj["col_3"] != "3" {
+		t.Fatalf("extra cell should be col_3: %v", obj)
+	}
+	if got := rowArray(headers, obj); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("rowArray: %v", got)
+	}
+	if got := rowArray([]string{"a", "b", "c"}, rowObject(headers, []string{"1"})); !reflect.DeepEqual(got, []string{"1", "", ""}) {
+		t.Fatalf("short row: %v", got)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	st, ws := testWorkspace(t, "rollback")
+	ctx := context.Background()
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `insert into public.imports (status, original_filename) values ('committed', 'a.csv') returning id`).Scan(&importID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `insert into public.contacts (import_id, email) values ($1, 'a@example.com'), ($1, 'b@example.com'), (null, 'c@example.com')`, importID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ImportHandler{Store: st}
+	withID := uploadRequester(ws)
+	rollback := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Rollback(rec, withID(httptest.NewRequest("POST", "/api/imports/"+importID+"/rollback", nil), importID))
+		return rec
+	}
+	if rec := rollback(); rec.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", rec.Code, rec.Body)
+	}
+	// 2 回目は committed ではないので 409
+	if rec := rollback(); rec.Code != http.StatusConflict {
+		t.Fatalf("second rollback: %d %s", rec.Code, rec.Body)
+	}
+
+	var contacts, audits int
+	var status string
+	var deleted int
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `select count(*) from public.contacts`).Scan(&contacts); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, `select status from public.imports where id = $1`, importID).Scan(&status); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `
+select count(*), coalesce(max((metadata->>'deleted')::int), 0) from public.import_audit_logs
+where import_id = $1 and action = $2`, importID, AuditImportRollback).Scan(&audits, &deleted)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contacts != 1 || status != "rolled_back" || audits != 1 || deleted != 2 {
+		t.Fatalf("contacts = %d, status = %s, audits = %d, deleted = %d", contacts, status, audits, deleted)
+	}
+}
+
+// 本文なしの reparse でも status を uploaded に戻し、前回の apply / validate の結果を消す（古い行で commit させない）
+func TestReparseResetsDerivedState(t *testing.T) {
+	st, ws := testWorkspace(t, "reparse-reset")
+	ctx := context.Background()
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `
+insert into public.imports (status, original_filename, original_key) values ('ready_to_commit', 'a.csv', 'originals/a.csv')
+returning id`).Scan(&importID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+insert into public.import_rows_raw (import_id, row_index, raw_json, normalized_json, detected_errors)
+values ($1, 0, '{"メール":"a@example.com"}', '{"email":"a@example.com"}', '[]')`, importID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ImportHandler{Store: st}
+	withID := uploadRequester(ws)
+	rec := httptest.NewRecorder()
+	h.Reparse(rec, withID(httptest.NewRequest("POST", "/api/imports/"+importID+"/reparse", nil), importID))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("reparse: %d %s", rec.Code, rec.Body)
+	}
+	// parse ジョブが終わる前の commit は validate からやり直し
+	rec = httptest.NewRecorder()
+	h.EnqueueJob(JobCommit)(rec, withID(httptest.NewRequest("POST", "/api/imports/"+importID+"/commit", nil), importID))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("commit after reparse: %d %s", rec.Code, rec.Body)
+	}
+
+	var status string
+	var derived int
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `select status from public.imports where id = $1`, importID).Scan(&status); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `
+select count(*) from public.import_rows_raw
+where import_id = $1 and (normalized_json is not null or detected_errors is not null)`, importID).Scan(&derived)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "uploaded" || derived != 0 {
+		t.Fatalf("status = %s, rows with derived columns = %d", status, derived)
+	}
+}
@@ -0,0 +1,388 @@
+// api/internal/handlers/import_mappings.go
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportMapping はソース列 1 つ分の判断（import_mappings の 1 行）
+type ImportMapping struct {
+	Source     string  `json:"source"`
+	Target     *string `json:"target"`              // null = 未割当
+	Suggested  *string `json:"suggested,omitempty"` // サジェスタの提案（無ければ null）
+	Confidence float32 `json:"confidence"`
+	IsOverride bool    `json:"isOverride"` // target != suggested（サーバで判定）
+}
+
+type ImportMappingsReq struct {
+	SchemaKey string          `json:"schemaKey,omitempty"` // 省略時は前回の値（commit で上書きを学習するときに使う）
+	Mappings  []ImportMapping `json:"mappings"`
+}
+
+type ImportMappingsResp struct {
+	ImportID  string          `json:"importId"`
+	Status    string          `json:"status"`
+	SchemaKey *string         `json:"schemaKey,omitempty"`
+	Mappings  []ImportMapping `json:"mappings"`
+	UpdatedAt *time.Time      `json:"updatedAt,omitempty"` // 未保存なら省略
+}
+
+var (
+	errImportNotFound  = errors.New("import not found")
+	errImportCommitted = errors.New("import already committed")
+)
+
+// GET /api/imports/{id}/mappings
+// 別セッションで途中のインポートを再開するためのもの
+func (h *MappingHandler) GetImportMappings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out ImportMappingsResp
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = loadImportMappings(ctx, tx, id, false)
+		return err
+	})
+	if errors.Is(err, errImportNotFound) {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PUT /api/imports/{id}/mappings
+// 現在のマッピングで置き換える。is_override は suggested と target を比べてサーバが決める
+// 割当（target）が変わった列だけ updated_at / decided_by を更新する（feedback の ?since= で古い判断を新しく見せない）
+func (h *MappingHandler) PutImportMappings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in ImportMappingsReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if issues := validateImportMappings(in.Mappings); len(issues) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "invalid_mappings",
+			"issues": issues,
+		})
+		return
+	}
+	for i := range in.Mappings {
+		in.Mappings[i].IsOverride = !sameField(in.Mappings[i].Target, in.Mappings[i].Suggested)
+	}
+
+	const upsert = `
+insert into public.import_mappings as m (import_id, source_col, target_field, suggested_field, confidence, is_override, decided_by)
+values ($1, $2, $3, $4, $5, $6, $7)
+on conflict (import_id, source_col) do update
+set target_field = excluded.target_field,
+    suggested_field = excluded.suggested_field,
+    confidence = excluded.confidence,
+    is_override = excluded.is_override,
+    decided_by = case when m.target_field is distinct from excluded.target_field then excluded.decided_by else m.decided_by end,
+    updated_at = case when m.target_field is distinct from excluded.target_field then now() else m.updated_at end;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	p := PrincipalFrom(r.Context())
+	var out ImportMappingsResp
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := loadImportMappings(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if before.Status == "committed" {
+			return errImportCommitted
+		}
+
+		// 送られてこなかった列だけ消す
+		sources := make([]string, len(in.Mappings))
+		for i, m := range in.Mappings {
+			sources[i] = m.Source
+		}
+		if _, err := tx.Exec(ctx, `delete from public.import_mappings where import_id = $1 and source_col <> all($2)`, id, sources); err != nil {
+			return err
+		}
+		for _, m := range in.Mappings {
+			if _, err := tx.Exec(ctx, upsert, id, m.Source, m.Target, m.Suggested, m.Confidence, m.IsOverride, p.Actor()); err != nil {
+				return err
+			}
+		}
+		const upd = `
+update public.imports
+set status = case when status = 'uploaded' then 'mapping' else status end,
+    schema_key = coalesce(nullif($2, ''), schema_key),
+    updated_at = now()
+where id = $1;
+`
+		if _, err := tx.Exec(ctx, upd, id, in.SchemaKey); err != nil {
+			return err
+		}
+
+		// 別名の学習は確定（commit）したときだけ。保存のたびに学習すると試しに付けた割当まで数える
+		out, err = loadImportMappings(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, p, auditRecord{
+			Action: AuditMappingUpdate, ImportID: &id, TargetType: "import", TargetID: id,
+			Before: mappingSnapshot(before.Mappings), After: mappingSnapshot(out.Mappings),
+		})
+	})
+	switch {
+	case errors.Is(err, errImportNotFound):
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errImportCommitted):
+		http.Error(w, "import already committed", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// loadImportMappings は imports の存在確認をしてから保存済みマッピングを返す（lock なら imports 行をロック）
+func loadImportMappings(ctx context.Context, tx pgx.Tx, id string, lock bool) (ImportMappingsResp, error) {
+	q := `select status, schema_key from public.imports where id = $1`
+	if lock {
+		q += ` for update`
+	}
+	out := ImportMappingsResp{ImportID: id, Mappings: make([]ImportMapping, 0)}
+	if err := tx.QueryRow(ctx, q, id).Scan(&out.Status, &out.SchemaKey); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return out, errImportNotFound
+		}
+		return out, err
+	}
+
+	const mq = `
+select source_col, target_field, suggested_field, confidence, is_override, updated_at
+from public.import_mappings
+where import_id = $1
+order by id;
+`
+	rows, err := tx.Query(ctx, mq, id)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m ImportMapping
+		var at time.Time
+		if err := rows.Scan(&m.Source, &m.Target, &m.Suggested, &m.Confidence, &m.IsOverride, &at); err != nil {
+			return out, err
+		}
+		if out.UpdatedAt == nil || at.After(*out.UpdatedAt) {
+			out.UpdatedAt = &at
+		}
+		out.Mappings = append(out.Mappings, m)
+	}
+	return out, rows.Err()
+}
+
+// validateImportMappings は source の重複・空、target の重複を issues にまとめて返す
+func validateImportMappings(ms []ImportMapping) []RuleIssue {
+	var issues []RuleIssue
+	sources := map[string]int{}
+	targets := map[string]int{}
+	for i, m := range ms {
+		path := fmt.Sprintf("mappings[%d]", i)
+		if strings.TrimSpace(m.Source) == "" {
+			issues = append(issues, RuleIssue{Path: path + ".source", Reason: "is required"})
+		} else if j, dup := sources[m.Source]; dup {
+			issues = append(issues, RuleIssue{Path: path + ".source", Reason: fmt.Sprintf("duplicates mappings[%d]", j)})
+		} else {
+			sources[m.Source] = i
+		}
+		if m.Target != nil {
+			if strings.TrimSpace(*m.Target) == "" {
+				issues = append(issues, RuleIssue{Path: path + ".target", Reason: "must not be empty (use null to leave unmapped)"})
+			} else if j, dup := targets[*m.Target]; dup {
+				issues = append(issues, RuleIssue{Path: path + ".target", Reason: fmt.Sprintf("already mapped from mappings[%d]", j)})
+			} else {
+				targets[*m.Target] = i
+			}
+		}
+		if m.Confidence < 0 || m.Confidence > 1 {
+			issues = append(issues, RuleIssue{Path: path + ".confidence", Reason: "must be between 0 and 1"})
+		}
+	}
+	return issues
+}
+
+func sameField(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// mappingSnapshot は監査ログ用に source -> target の map にする
+func mappingSnapshot(ms []ImportMapping) map[string]interface{} {
+	out := make(map[string]interface{}, len(ms))
+	for _, m := range ms {
+		if m.Target == nil {
+			out[m.Source] = nil
+		} else {
+			out[m.Source] = *m.Target
+		}
+	}
+	return out
+}
+
+// ===== GET /api/mappings/feedback =====
+
+// MappingFeedback はサジェスタ学習用のラベル付きデータ 1 件（上書きされたものだけ）
+type MappingFeedback struct {
+	ImportID     string    `json:"import_id"`
+	Filename     string    `json:"original_filename"`
+	Source       string    `json:"source"`
+	SampleValues []string  `json:"sample_values"` // プレビュー時のその列の値
+	Suggested    *string   `json:"suggested"`
+	Target       *string   `json:"target"`
+	Confidence   float32   `json:"confidence"`
+	Label        string    `json:"label"` // corrected / added / rejected
+	DecidedBy    *string   `json:"decided_by,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// feedbackLabel は suggested と target の組み合わせから学習ラベルを決める
+func feedbackLabel(suggested, target *string) string {
+	switch {
+	case target == nil:
+		return "rejected" // 提案を未割当にした
+	case suggested == nil:
+		return "added" // 提案が無い列にユーザが割り当てた
+	default:
+		return "corrected"
+	}
+}
+
+// GET /api/mappings/feedback?since=&format=csv
+// 既定は NDJSON（1 行 1 件）。committed 以外のインポートも含む
+func (h *MappingHandler) ExportFeedback(w http.ResponseWriter, r *http.Request) {
+	q := `
+select m.import_id, i.original_filename, m.source_col, m.suggested_field, m.target_field,
+       m.confidence, m.decided_by, m.updated_at, i.sample
+from public.import_mappings m
+join public.imports i on i.id = m.import_id
+where m.is_override`
+	var args []interface{}
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		args = append(args, t)
+		q += ` and m.updated_at >= $1`
+	}
+	q += ` order by m.updated_at desc, m.id`
+
+	asCSV := r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	started := false
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var emit func(MappingFeedback)
+		if asCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="mapping-feedback.csv"`)
+			cw := csv.NewWriter(w)
+			defer cw.Flush()
+			_ = cw.Write([]string{"import_id", "original_filename", "source", "sample_values", "suggested", "target", "confidence", "label", "decided_by", "updated_at"})
+			emit = func(f MappingFeedback) {
+				_ = cw.Write([]string{
+					f.ImportID, f.Filename, f.Source, strings.Join(f.SampleValues, "|"),
+					derefString(f.Suggested), derefString(f.Target),
+					strconv.FormatFloat(float64(f.Confidence), 'f', -1, 32),
+					f.Label, derefString(f.DecidedBy), f.UpdatedAt.UTC().Format(time.RFC3339),
+				})
+			}
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			emit = func(f MappingFeedback) { _ = enc.Encode(f) }
+		}
+		started = true
+
+		for rows.Next() {
+			var f MappingFeedback
+			var sample []byte
+			if err := rows.Scan(&f.ImportID, &f.Filename, &f.Source, &f.Suggested, &f.Target,
+				&f.Confidence, &f.DecidedBy, &f.UpdatedAt, &sample); err != nil {
+				return err
+			}
+			f.SampleValues = sampleColumn(sample, f.Source)
+			f.Label = feedbackLabel(f.Suggested, f.Target)
+			emit(f)
+		}
+		return rows.Err()
+	})
+	if err != nil && !started {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+	}
+}
+
+// sampleColumn は imports.sample（プレビュー）から source 列の値を取り出す
+func sampleColumn(sample []byte, source string) []string {
+	out := make([]string, 0)
+	var s struct {
+		Headers    []string   `json:"headers"`
+		SampleRows [][]string `json:"sampleRows"`
+	}
+	if len(sample) == 0 || json.Unmarshal(sample, &s) != nil {
+		return out
+	}
+	col := -1
+	for i, h := range s.Headers {
+		if h == source {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		return out
+	}
+	for _, row := range s.SampleRows {
+		if col < len(row) {
+			out = append(out, row[col])
+		}
+	}
+	return out
+}
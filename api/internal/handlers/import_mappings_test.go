@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"csv-import-kit/api/internal/jobs"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+func strp(s string) *string { return &s }
+
+func TestValidateImportMappings(t *testing.T) {
+	ms := []ImportMapping{
+		{Source: "得意先コード", Target: strp("customer_id"), Suggested: nil, Confidence: 0},
+		{Source: "Order ID", Target: strp("order_id"), Suggested: strp("order_id"), Confidence: 0.9},
+		{Source: "Order ID", Target: nil},
+		{Source: "Cust", Target: strp("customer_id")},
+		{Source: " ", Target: strp(""), Confidence: 2},
+	}
+	var got []string
+	for _, is := range validateImportMappings(ms) {
+		got = append(got, is.Path)
+	}
+	want := []string{"mappings[2].source", "mappings[3].target", "mappings[4].source", "mappings[4].target", "mappings[4].confidence"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if issues := validateImportMappings(ms[:2]); len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+}
+
+func TestFeedbackLabel(t *testing.T) {
+	cases := []struct {
+		suggested, target *string
+		want              string
+	}{
+		{strp("product"), strp("customer_id"), "corrected"},
+		{nil, strp("customer_id"), "added"},
+		{strp("product"), nil, "rejected"},
+	}
+	for _, c := range cases {
+		if got := feedbackLabel(c.suggested, c.target); got != c.want {
+			t.Fatalf("feedbackLabel(%v, %v) = %q, want %q", c.suggested, c.target, got, c.want)
+		}
+	}
+	if sameField(strp("a"), strp("a")) != true || sameField(nil, strp("a")) || !sameField(nil, nil) {
+		t.Fatal("sameField mismatch")
+	}
+}
+
+func TestSampleColumn(t *testing.T) {
+	sample := []byte(`{"headers":["a","得意先コード"],"sampleRows":[["1","C001"],["2"]]}`)
+	if got := sampleColumn(sample, "得意先コード"); !reflect.DeepEqual(got, []string{"C001"}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := sampleColumn(nil, "a"); len(got) != 0 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// 別名は PUT では学習せず、commit で（apply で使ったマッピングから）学習して rollback で取り消す
+func TestAliasesLearnedOnCommitOnly(t *testing.T) {
+	st, ws := testWorkspace(t, "alias-learning")
+	ctx := context.Background()
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `insert into public.imports (status, original_filename) values ('uploaded', 'a.csv') returning id`).Scan(&importID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withID := uploadRequester(ws)
+	countAliases := func() int {
+		t.Helper()
+		var n int
+		err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+			return tx.QueryRow(ctx, `select count(*) from public.mapping_aliases where schema_key = 'orders_v1'`).Scan(&n)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	body := `{"schemaKey":"orders_v1","mappings":[{"source":"得意先コード","target":"customer_id"}]}`
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		(&MappingHandler{Store: st}).PutImportMappings(rec, withID(httptest.NewRequest("PUT", "/api/imports/"+importID+"/mappings", strings.NewReader(body)), importID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("put: %d %s", rec.Code, rec.Body)
+		}
+	}
+	if n := countAliases(); n != 0 {
+		t.Fatalf("aliases after PUT = %d", n)
+	}
+
+	// apply（runApply と同じく jobRules で読んだマッピングを記録）→ validate の後に PUT で変えても、
+	// 学習するのは apply で行に当てたほう
+	h := &ImportHandler{Store: st}
+	_, _, applied, err := h.jobRules(ctx, &jobs.Job{WorkspaceID: ws, ImportID: &importID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `update public.imports set applied_mappings = $2 where id = $1`, importID, applied)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := `{"schemaKey":"orders_v1","mappings":[{"source":"得意先コード","target":"customer_name"}]}`
+	rec := httptest.NewRecorder()
+	(&MappingHandler{Store: st}).PutImportMappings(rec, withID(httptest.NewRequest("PUT", "/api/imports/"+importID+"/mappings", strings.NewReader(later)), importID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put after validate: %d %s", rec.Code, rec.Body)
+	}
+
+	// runCommit と同じく、apply 時点のマッピングを学習する
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		applied, err := loadAppliedMappings(ctx, tx, importID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `update public.imports set status = 'committed' where id = $1`, importID); err != nil {
+			return err
+		}
+		return learnAliases(ctx, tx, applied.SchemaKey, nil, applied.Mappings)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countAliases(); n != 1 {
+		t.Fatalf("aliases after commit = %d", n)
+	}
+	var field string
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `select target_field from public.mapping_aliases where schema_key = 'orders_v1'`).Scan(&field)
+	})
+	if err != nil || field != "customer_id" {
+		t.Fatalf("learned %q (%v), want the applied customer_id", field, err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Rollback(rec, withID(httptest.NewRequest("POST", "/api/imports/"+importID+"/rollback", nil), importID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", rec.Code, rec.Body)
+	}
+	if n := countAliases(); n != 0 {
+		t.Fatalf("aliases after rollback = %d", n)
+	}
+}
+
+// 保存し直しても割当が変わらない列の decided_by / updated_at は残し、送られなかった列は消す
+func TestPutImportMappingsKeepsUnchangedDecisions(t *testing.T) {
+	st, ws := testWorkspace(t, "mapping-upsert")
+	ctx := context.Background()
+	var importID string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `insert into public.imports (status, original_filename) values ('uploaded', 'a.csv') returning id`).Scan(&importID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(name, body string) {
+		t.Helper()
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", importID)
+		req := httptest.NewRequest("PUT", "/api/imports/"+importID+"/mappings", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(withPrincipal(req.Context(), &Principal{WorkspaceID: ws, Name: name}), chi.RouteCtxKey, rctx))
+		rec := httptest.NewRecorder()
+		(&MappingHandler{Store: st}).PutImportMappings(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("put as %s: %d %s", name, rec.Code, rec.Body)
+		}
+	}
+	type decision struct {
+		by string
+		at time.Time
+	}
+	load := func() map[string]decision {
+		t.Helper()
+		out := map[string]decision{}
+		err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `select source_col, decided_by, updated_at from public.import_mappings where import_id = $1`, importID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var src string
+				var d decision
+				if err := rows.Scan(&src, &d.by, &d.at); err != nil {
+					return err
+				}
+				out[src] = d
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	put("alice", `{"mappings":[{"source":"氏名","target":"name"},{"source":"メール","target":"email"},{"source":"備考","target":null}]}`)
+	first := load()
+	put("bob", `{"mappings":[{"source":"氏名","target":"name"},{"source":"メール","target":"phone"}]}`)
+	second := load()
+
+	if second["氏名"] != first["氏名"] {
+		t.Fatalf("unchanged row was touched: %+v -> %+v", first["氏名"], second["氏名"])
+	}
+	if second["メール"].by != "key:bob" || !second["メール"].at.After(first["メール"].at) {
+		t.Fatalf("changed row: %+v -> %+v", first["メール"], second["メール"])
+	}
+	if _, ok := second["備考"]; ok || len(second) != 2 {
+		t.Fatalf("removed column should be deleted: %+v", second)
+	}
+}
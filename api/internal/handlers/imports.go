@@ -1,141 +1,568 @@
 package handlers
 
 import (
-	//"bufio"
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 
 	//"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
+
+	"csv-import-kit/api/internal/blob"
+	"csv-import-kit/api/internal/jobs"
+	"csv-import-kit/api/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/text/unicode/norm"
 )
 
 const maxUploadMB = 20
 const previewRows = 20
 
 type previewResponse struct {
-	Delimiter    string     `json:"delimiter"`
-	HasHeader    bool       `json:"hasHeader"`
-	Headers      []string   `json:"headers"`
-	SampleRows   [][]string `json:"sampleRows"`
-	CountGuessed int        `json:"countGuessed"`
+	ImportID  string `json:"importId,omitempty"` // imports.id（保存した場合）
+	JobID     string `json:"jobId,omitempty"`    // 全行を取り込む parse ジョブ
+	RowCount  int    `json:"rowCount"`           // ヘッダを除いた全データ行数
+	Delimiter string `json:"delimiter"`
+	// DelimiterConfidence は区切り文字の推定の確からしさ（0〜1、明示したときは 1）
+	DelimiterConfidence float64 `json:"delimiterConfidence"`
+	HasHeader           bool    `json:"hasHeader"`
+	// HeaderRow / HeaderRows はヘッダの位置（skipTop の後の何レコード目か）と行数（2 以上なら「グループ_項目」に連結）
+	// Preamble はヘッダの手前で飛ばした表題・空行など
+	HeaderRow  int        `json:"headerRow,omitempty"`
+	HeaderRows int        `json:"headerRows,omitempty"`
+	Preamble   [][]string `json:"preamble,omitempty"`
+	// Format は fixed（固定長）/ json / ods / xls のときだけ入る。FixedColumns は使った列（推定した場合も）
+	Format       string        `json:"format,omitempty"`
+	FixedColumns []FixedColumn `json:"fixedColumns,omitempty"`
+	Headers      []string      `json:"headers"`
+	// HeaderLabels は headerKeys: "ascii" のときの元の表記（Headers と同じ並び）
+	HeaderLabels []string `json:"headerLabels,omitempty"`
+	// Columns は列ごとの元の表記・正規化したキー・推定した型（ルールはどれでも列を指せる）
+	Columns      []ColumnInfo `json:"columns"`
+	SampleRows   [][]string   `json:"sampleRows"`
+	CountGuessed int          `json:"countGuessed"`
+
+	// dataOffset は読み始めから最初のデータ行までのレコード数（parse ジョブと zip の連結で読み飛ばす）
+	dataOffset int
+}
+
+type ImportHandler struct {
+	Store *store.Store
+	// UploadDir は再開可能アップロードの受信途中ファイルの置き場（空なら OS の一時ディレクトリ配下）
+	// Blobs が未設定なら元ファイルもここに置く
+	UploadDir string
+	// Blobs は元ファイルの保存先（ローカルディスク / S3 互換）
+	Blobs blob.Store
+	// MaxResumableBytes は再開可能アップロード 1 件の上限（0 なら 2GB）
+	MaxResumableBytes int64
+	// Events は SSE の起こし通知（nil なら一定間隔で読み直す）
+	Events *EventBroker
 }
 
-func HandleUploadPreview() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// サイズ制限
-		r.Body = http.MaxBytesReader(w, r.Body, int64(maxUploadMB<<20)) // 20MB
+func NewImportHandler(s *store.Store) *ImportHandler {
+	return &ImportHandler{Store: s}
+}
+
+// POST /api/imports
+// プレビューを返しつつ imports 行（status=uploaded）を作る
+func (h *ImportHandler) UploadPreview(w http.ResponseWriter, r *http.Request) {
+	// サイズ制限
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxUploadMB<<20)) // 20MB
+
+	// multipart 取得
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required (multipart/form-data)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// 全体をバッファ（小〜中サイズ前提。大きくなればストリーミングに変更）
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, file); err != nil {
+		http.Error(w, "read error", http.StatusBadRequest)
+		return
+	}
 
-		// multipart 取得
-		file, _, err := r.FormFile("file")
+	// 読み取り設定（固定長など）は parseOptions（JSON）か、保存済みテンプレートの parse_options
+	opts, status, err := h.uploadParseOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// zip は中のファイルごと（または同じヘッダのものをまとめて）取り込む
+	if isArchiveUpload(fh.Filename, fh.Header.Get("Content-Type"), buf.Bytes()) {
+		h.uploadArchive(w, r, fh.Filename, buf.Bytes(), opts)
+		return
+	}
+	if opts == nil {
+		opts = formatFromUpload(fh.Filename, fh.Header.Get("Content-Type"))
+	}
+
+	resp, err := buildPreviewWith(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		http.Error(w, "csv parse error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 保存（Store が無い＝テスト時はプレビューのみ）
+	if h.Store != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		data := buf.Bytes()
+		id, jobID, err := h.createImport(ctx, r, importSource{
+			Filename:    fh.Filename,
+			Size:        int64(len(data)),
+			ContentType: fh.Header.Get("Content-Type"),
+			Options:     opts,
+			open:        func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+		}, &resp)
 		if err != nil {
-			http.Error(w, "file is required (multipart/form-data)", http.StatusBadRequest)
+			http.Error(w, "db insert error", http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
+		resp.ImportID = id
+		resp.JobID = jobID
+	}
 
-		// 全体をバッファ（小〜中サイズ前提。大きくなればストリーミングに変更）
-		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, file); err != nil {
-			http.Error(w, "read error", http.StatusBadRequest)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
 
-		// 文字コード/BOM簡易処理（UTF-8 BOM除去）
-		b := buf.Bytes()
-		if bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}) {
-			b = b[3:]
+// GET /api/imports/{id}/original
+// アップロードされた元ファイルをそのまま返す（ETag は SHA-256）
+func (h *ImportHandler) GetOriginal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var filename, key, sum, contentType string
+	var size int64
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+select original_filename, coalesce(original_key, ''), coalesce(original_sha256, ''),
+       coalesce(original_size, 0), coalesce(original_content_type, '')
+from public.imports where id = $1`, id).Scan(&filename, &key, &sum, &size, &contentType)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+	if key == "" {
+		http.Error(w, "original file is not stored", http.StatusNotFound)
+		return
+	}
+
+	etag := `"` + sum + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// 本文の転送は DB の 5 秒に縛らない
+	rc, err := h.blobs().Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.Error(w, "original file is missing", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "blob read error", http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+
+	if contentType == "" {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-SHA256", sum)
+	// アップロードされた Content-Type のままなので、ブラウザに中身から推測させない（HTML として開かせない）
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// 大きな元ファイルはサーバ全体の WriteTimeout（30 秒）では送り切れない
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(uploadCompleteTimeout))
+	_, _ = io.Copy(w, rc)
+}
+
+// uploadParseOptions はアップロードのフォーム項目 parseOptions / templateId から読み取り設定を作る（どちらも無ければ nil = 推定）
+func (h *ImportHandler) uploadParseOptions(r *http.Request) (*ParseOptions, int, error) {
+	raw, templateID := r.FormValue("parseOptions"), r.FormValue("templateId")
+	switch {
+	case raw != "" && templateID != "":
+		return nil, http.StatusBadRequest, errors.New("specify either parseOptions or templateId, not both")
+	case raw != "":
+		var opts ParseOptions
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&opts); err != nil {
+			return nil, http.StatusBadRequest, errors.New("parseOptions must be a JSON object")
+		}
+		if err := opts.validate(); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		return &opts, 0, nil
+	case templateID != "" && h.Store != nil:
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		var opts *ParseOptions
+		err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+			return tx.QueryRow(ctx, `select parse_options from public.mapping_templates where id = $1 and deleted_at is null`,
+				templateID).Scan(&opts)
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, http.StatusNotFound, errors.New("template not found")
 		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("db query error")
+		}
+		return opts, 0, nil
+	}
+	return nil, 0, nil
+}
+
+// buildPreview は CSV 全体から区切り文字・ヘッダを推定し、先頭 previewRows 行と総行数を返す
+func buildPreview(b []byte) (previewResponse, error) {
+	return buildPreviewFrom(bytes.NewReader(b))
+}
 
-		// 区切り文字推定
-		del := guessDelimiter(b)
+// buildPreviewFrom は buildPreview のストリーム版（大きなファイルを全部メモリに載せない）
+func buildPreviewFrom(src io.Reader) (previewResponse, error) {
+	return buildPreviewWith(src, nil)
+}
 
-		// CSVパーサ
-		reader := csv.NewReader(bytes.NewReader(b))
-		reader.Comma = rune(del[0])
-		reader.FieldsPerRecord = -1 // 可変長対応
-		reader.LazyQuotes = true    // 厳密なクオートチェックをしない
+// buildPreviewWith は読み取り設定つきの buildPreviewFrom（opts が nil なら推定）
+func buildPreviewWith(src io.Reader, opts *ParseOptions) (previewResponse, error) {
+	reader, guess, err := openRecords(src, opts)
+	if err != nil {
+		return previewResponse{}, err
+	}
 
-		// 先頭行をpeek
-		all := make([][]string, 0, previewRows+1)
-		for i := 0; i < previewRows+1; i++ {
-			rec, err := reader.Read()
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				http.Error(w, "csv parse error: "+err.Error(), http.StatusBadRequest)
-				return
-			}
+	// 先頭行をpeek（前置き行・複数行ヘッダの分も持っておく）
+	const keep = previewRows + headerScanRows + maxHeaderRows
+	all := make([][]string, 0, keep)
+	total := 0
+	for {
+		rec, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return previewResponse{}, err
+		}
+		// 残りは数えるだけ
+		if len(all) < keep {
 			all = append(all, rec)
 		}
+		total++
+	}
 
-		var headers []string
-		hasHeader := false
-		rows := all
-		// ヘッダー判定
-		if len(all) > 0 {
-			var next []string
-			if len(all) > 1 {
-				next = all[1]
+	var headers, originals []string
+	hasHeader := false
+	rows := all
+	// JSON は読み終えた時点の全キーがヘッダ（途中から増えた列は前の行では空）
+	if jr, ok := reader.(*jsonReader); ok {
+		originals = jr.Columns()
+		headers = normalizeHeaders(originals)
+		rows = all[:min(len(all), previewRows)]
+		for i, row := range rows {
+			if len(row) < len(headers) {
+				rows[i] = append(row, make([]string, len(headers)-len(row))...)
+			}
+		}
+		all = nil
+	}
+	// ヘッダー判定（推定なら表題・空行を飛ばした先の項目行を探す）
+	var preamble [][]string
+	headerRow, headerRows, offset := 0, 0, 0
+	if len(all) > 0 {
+		var hg headerGuess
+		switch mode := opts.headerMode(); {
+		case mode >= 0:
+			hg = headerGuess{Rows: max(opts.headerRowCount(), 1)}
+			headerRow = mode
+		case mode == -2:
+			hg = detectHeader(all)
+			if n := opts.headerRowCount(); n > 0 {
+				hg.Rows = n
 			}
-			if looksLikeHeader(all[0], next) {
-				hasHeader = true
-				headers = normalizeHeaders(all[0])
-				rows = all[1:]
+			headerRow = hg.Row
+		}
+		hg.Rows = min(hg.Rows, len(all)-hg.Row)
+		if hg.Rows > 0 {
+			hasHeader = true
+			headerRows = hg.Rows
+			if hg.Rows == 1 {
+				originals = all[hg.Row]
 			} else {
-				// ヘッダーなしならカラム名を自動生成
-				headers = make([]string, len(all[0]))
-				for i := range headers {
-					headers[i] = "col_" + strconv.Itoa(i+1)
+				originals = mergeHeaderRows(all[hg.Row : hg.Row+hg.Rows])
+			}
+			headers = normalizeHeaders(originals)
+			preamble = all[:hg.Row]
+			offset = hg.Row + hg.Rows
+			rows = all[offset:min(len(all), offset+previewRows)]
+			total -= offset
+		} else {
+			// ヘッダーなしならカラム名を自動生成
+			rows = all[:min(len(all), previewRows)]
+			headers = make([]string, len(all[0]))
+			for i := range headers {
+				headers[i] = "col_" + strconv.Itoa(i+1)
+			}
+		}
+	}
+
+	// 固定長で列に名前を付けていればそちらを使う
+	if names := fixedColumnNames(guess.Columns); names != nil {
+		labels := make([]string, len(names))
+		for i, n := range names {
+			labels[i] = n
+			if n == "" && i < len(headers) {
+				names[i] = headers[i]
+				if i < len(originals) {
+					labels[i] = originals[i]
 				}
 			}
 		}
+		originals = labels
+		headers = normalizeHeaders(names)
+	}
 
-		// レスポンス
-		resp := previewResponse{
-			Delimiter:    del,
-			HasHeader:    hasHeader,
-			Headers:      headers,
-			SampleRows:   rows,
-			CountGuessed: len(rows),
+	// 英数字のキーにするときは、元の表記（正規化済み）を headerLabels に残す
+	var labels []string
+	if opts.asciiHeaderKeys() {
+		labels = headers
+		keys := make([]string, len(headers))
+		for i, h := range headers {
+			keys[i] = asciiHeaderKey(h)
 		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		json.NewEncoder(w).Encode(resp)
+		headers = normalizeHeaders(keys)
+	}
+
+	// レスポンス
+	var format string
+	switch {
+	case opts.isJSON():
+		format = "json"
+	case opts.isSpreadsheet(), opts != nil && opts.Format == "fixed":
+		format = opts.Format
 	}
+	return previewResponse{
+		Format:              format,
+		FixedColumns:        guess.Columns,
+		RowCount:            total,
+		Delimiter:           guess.Delimiter,
+		DelimiterConfidence: guess.Confidence,
+		HasHeader:           hasHeader,
+		HeaderRow:           headerRow,
+		HeaderRows:          headerRows,
+		Preamble:            preamble,
+		Headers:             headers,
+		HeaderLabels:        labels,
+		Columns:             buildColumns(originals, headers, rows),
+		SampleRows:          rows,
+		CountGuessed:        len(rows),
+		dataOffset:          offset,
+	}, nil
 }
 
-// Utility functions
+// stripBOM は文字コード/BOM簡易処理（UTF-8 BOM除去）
+func stripBOM(b []byte) []byte {
+	return bytes.TrimPrefix(b, utf8BOM)
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
 
-func guessDelimiter(b []byte) string {
-	// 先頭1KBから候補文字の出現数を数える
-	candidates := []byte{',', '\t', ';', '|'}
-	end := len(b)
-	if end > 1024 {
-		end = 1024
+// skipBOM は stripBOM のストリーム版
+func skipBOM(br *bufio.Reader) {
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		_, _ = br.Discard(len(utf8BOM))
 	}
-	snipet := b[:end]
-	counts := make(map[byte]int)
-	for _, c := range candidates {
-		counts[c] = bytes.Count(snipet, []byte{c})
+}
+
+// newCSVReader はプレビューと取り込みジョブで同じ設定の CSV パーサを作る
+func newCSVReader(src io.Reader, del string) *csv.Reader {
+	reader := csv.NewReader(src)
+	reader.Comma = rune(del[0])
+	reader.FieldsPerRecord = -1 // 可変長対応
+	reader.LazyQuotes = true    // 厳密なクオートチェックをしない
+	return reader
+}
+
+// importSource は imports 行の元になったファイル
+type importSource struct {
+	Filename    string
+	Size        int64
+	ContentType string
+	UploadID    string                        // 再開可能アップロード（POST /api/uploads）から作った場合
+	Options     *ParseOptions                 // 読み取り設定（nil = 推定）
+	Archive     string                        // zip から作った場合の zip のファイル名
+	Entries     []string                      // そのとき元になったエントリ（merge なら複数）
+	open        func() (io.ReadCloser, error) // 元ファイルの中身（BlobStore に保存する）
+}
+
+// createImport は元ファイルを BlobStore に置いてから imports 行を作り、
+// 同じトランザクションで import.upload の監査ログと parse ジョブを書く
+// 大きなファイルの転送中に DB のトランザクションを開けたままにしないよう、ID を先に決めて置き場を作る
+func (h *ImportHandler) createImport(ctx context.Context, r *http.Request, src importSource, p *previewResponse) (string, string, error) {
+	sample, err := previewSample(p)
+	if err != nil {
+		return "", "", err
+	}
+
+	const q = `
+insert into public.imports (id, status, original_filename, row_count, sample, parse_options,
+                            original_key, original_sha256, original_size, original_content_type)
+values ($1, 'uploaded', $2, $3, $4::jsonb, $5, $6, $7, $8, nullif($9, ''));
+`
+	pr := PrincipalFrom(r.Context())
+	ws := workspaceID(r)
+	var id, jobID string
+	if err := h.Store.Pool.QueryRow(ctx, `select gen_random_uuid()::text`).Scan(&id); err != nil {
+		return "", "", err
 	}
-	best := byte(',')
-	bestScore := -1
-	for c, n := range counts {
-		if n > bestScore {
-			best = c
-			bestScore = n
+	// コミット前にファイルを置く（ジョブが見えた時点で必ず読める）
+	key := originalKey(ws, id)
+	sum, size, err := h.putOriginal(ctx, key, src)
+	if err != nil {
+		return "", "", err
+	}
+	err = h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, q, id, src.Filename, p.RowCount, string(sample), src.Options, key, sum, size, src.ContentType); err != nil {
+			return err
+		}
+		if src.UploadID != "" {
+			// 同時の complete は 1 つだけ通す（残りはロールバックして先に通った方を返す）
+			const done = `update public.uploads set status = 'completed', import_id = $2 where id = $1 and status = 'uploading'`
+			tag, err := tx.Exec(ctx, done, src.UploadID, id)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return errUploadNotOpen
+			}
 		}
+		jobID, err = jobs.Enqueue(ctx, tx, jobs.Spec{
+			Type: JobParse, ImportID: id, Payload: parsePayload{Key: key, Options: src.Options}, CreatedBy: pr.Actor(),
+		})
+		if err != nil {
+			return err
+		}
+		extra := map[string]interface{}{"size": size, "sha256": sum, "delimiter": p.Delimiter, "hasHeader": p.HasHeader, "job_id": jobID}
+		if src.UploadID != "" {
+			extra["upload_id"] = src.UploadID
+		}
+		if src.Archive != "" {
+			extra["archive"] = src.Archive
+			extra["archive_entries"] = src.Entries
+		}
+		return writeAudit(ctx, tx, pr, auditRecord{
+			Action: AuditImportUpload, ImportID: &id, TargetType: "import", TargetID: id,
+			After: map[string]interface{}{"status": "uploaded", "original_filename": src.Filename, "row_count": p.RowCount},
+			Extra: extra,
+		})
+	})
+	if err != nil {
+		// 行ができなかったので置いたファイルは誰も参照しない
+		dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		_ = h.blobs().Delete(dctx, key)
+		cancel()
+		return "", "", err
+	}
+	return id, jobID, nil
+}
+
+// previewSample は imports.sample に入れる JSON
+func previewSample(p *previewResponse) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"delimiter":           p.Delimiter,
+		"delimiterConfidence": p.DelimiterConfidence,
+		"hasHeader":           p.HasHeader,
+		"headerRow":           p.HeaderRow,
+		"headerRows":          p.HeaderRows,
+		"preamble":            p.Preamble,
+		"format":              p.Format,
+		"fixedColumns":        p.FixedColumns,
+		"headers":             p.Headers,
+		"columns":             p.Columns,
+		"sampleRows":          p.SampleRows,
+	})
+}
+
+// putOriginal は元ファイルを保存しつつ SHA-256 とサイズを数える
+func (h *ImportHandler) putOriginal(ctx context.Context, key string, src importSource) (string, int64, error) {
+	rc, err := src.open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+	hw := sha256.New()
+	cr := &countingReader{r: io.TeeReader(rc, hw)}
+	if err := h.blobs().Put(ctx, key, cr, src.Size); err != nil {
+		return "", 0, err
+	}
+	if src.Size >= 0 && cr.n != src.Size {
+		return "", 0, fmt.Errorf("original size mismatch: read %d of %d bytes", cr.n, src.Size)
+	}
+	return hex.EncodeToString(hw.Sum(nil)), cr.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// originalKey は元ファイルの BlobStore キー
+func originalKey(workspaceID, importID string) string {
+	return workspaceID + "/imports/" + importID + "/original"
+}
+
+// blobs は元ファイルの保存先（未設定なら UploadDir のローカルディスク）
+func (h *ImportHandler) blobs() blob.Store {
+	if h.Blobs != nil {
+		return h.Blobs
+	}
+	return blob.NewLocal(h.uploadRoot())
+}
+
+// uploadRoot は UploadDir（空なら OS の一時ディレクトリ配下）
+func (h *ImportHandler) uploadRoot() string {
+	if h.UploadDir != "" {
+		return h.UploadDir
 	}
-	return string([]byte{best})
+	return filepath.Join(os.TempDir(), "csv-import-kit", "uploads")
 }
 
+// Utility functions
+
 // 先頭行がヘッダらしいか？ 2行目(next)を見てコントラスト判定も行う
 func looksLikeHeader(first []string, next []string) bool {
 	if len(first) == 0 {
@@ -189,7 +616,8 @@ func rowStats(cols []string) rowStat {
 	alpha, numeric, dt, kv, empty := 0, 0, 0, 0, 0
 
 	for _, raw := range cols {
-		s := strings.TrimSpace(raw)
+		// 全角英数・全角空白もそろえてから見る
+		s := strings.TrimSpace(norm.NFKC.String(raw))
 		if s == "" {
 			empty++
 			continue
@@ -226,7 +654,7 @@ func rowStats(cols []string) rowStat {
 }
 
 func isAlphaWord(s string) bool {
-	// 英字・空白・アンダースコアのみ（数字/記号/=.:- を含んだら除外）
+	// 文字（英字に限らず漢字・かなも語とみなす）・空白・アンダースコアのみ（数字/記号/=.:- を含んだら除外）
 	if s == "" {
 		return false
 	}
@@ -234,7 +662,7 @@ func isAlphaWord(s string) bool {
 		if r == ' ' || r == '_' {
 			continue
 		}
-		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+		if isWordRune(r) {
 			continue
 		}
 		// 数字やよくある記号が混ざっていたら英字主体とはみなさない
@@ -309,14 +737,11 @@ func normalizeHeaders(rec []string) []string {
 	out := make([]string, len(rec))
 	used := map[string]int{}
 	for i, v := range rec {
-		name := strings.TrimSpace(v)
+		// 正規化（NFKC・注記の除去・小文字・空白とハイフンを _）
+		name := headerKey(v)
 		if name == "" {
 			name = "col_" + strconv.Itoa(i+1)
 		}
-		// 正規化
-		name = strings.ToLower(name)
-		name = strings.ReplaceAll(name, " ", "_")
-		name = strings.ReplaceAll(name, "-", "_")
 		if !utf8.ValidString(name) {
 			name = "col_" + strconv.Itoa(i+1)
 		}
@@ -353,7 +778,7 @@ func CORSMiddleware() func(next http.Handler) http.Handler {
 	}
 
 	// 固定で許可するメソッド（DELETE/PUT/PATCH を追加）
-	const allowMethods = "GET,POST,DELETE,PUT,PATCH,OPTIONS"
+	const allowMethods = "GET,HEAD,POST,DELETE,PUT,PATCH,OPTIONS"
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -374,8 +799,10 @@ func CORSMiddleware() func(next http.Handler) http.Handler {
 			if allowed != "" {
 				w.Header().Set("Vary", "Origin")
 				w.Header().Set("Access-Control-Allow-Origin", allowed)
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
-				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,PUT,PATCH,OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, Authorization, Last-Event-ID, Upload-Offset, Upload-Checksum")
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				// 再開可能アップロードはレスポンスヘッダで位置を返す
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Upload-Offset, Upload-Length, Upload-Expires")
 			}
 
 			// プリフライトは許可が決まった時だけ 204 を返す
@@ -0,0 +1,274 @@
+// api/internal/handlers/jsonsource.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"csv-import-kit/api/internal/spreadsheet"
+)
+
+// JSON を平らにするときの上限（深すぎる入れ子・列の爆発・行の爆発を止める）
+const (
+	maxJSONDepth        = 32
+	maxJSONColumns      = 2000
+	maxJSONExplodedRows = 10000
+)
+
+// jsonField は順序つきオブジェクトの 1 項目
+type jsonField struct {
+	key string
+	val interface{}
+}
+
+// jsonObject はキーの順序を保ったオブジェクト（列の並びを元ファイルどおりにするため map にしない）
+type jsonObject []jsonField
+
+// formatFromUpload はファイル名・Content-Type から読み取り設定を決める（CSV なら nil = 推定）
+func formatFromUpload(filename, contentType string) *ParseOptions {
+	ct := strings.ToLower(contentType)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".ndjson", ".jsonl":
+		return &ParseOptions{Format: "json"}
+	case ".ods":
+		return &ParseOptions{Format: "ods"}
+	case ".xls":
+		return &ParseOptions{Format: "xls"}
+	}
+	switch {
+	case strings.HasPrefix(ct, "application/json"), strings.HasPrefix(ct, "application/x-ndjson"):
+		return &ParseOptions{Format: "json"}
+	case strings.HasPrefix(ct, spreadsheet.ODSMimeType):
+		return &ParseOptions{Format: "ods"}
+	}
+	// application/vnd.ms-excel は CSV にも付くので Content-Type では .xls と決めない
+	return nil
+}
+
+// jsonReader は JSON 配列 / NDJSON を 1 オブジェクト 1 行（explode なら配列の要素ごとに複数行）で読む
+// 列は入れ子をドットでつないだパス（customer.address.city）。見つけた順に増え、以前の列の位置は変わらない
+type jsonReader struct {
+	dec     *json.Decoder
+	explode bool
+	started bool
+	inArray bool // トップレベルが配列
+
+	keys    []string
+	index   map[string]int
+	pending [][]string
+}
+
+func newJSONReader(src io.Reader, opts *ParseOptions) *jsonReader {
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	return &jsonReader{dec: dec, explode: opts.Arrays == "explode", index: map[string]int{}}
+}
+
+// Columns は今までに見つかった列（読み終えた後なら全列）
+func (j *jsonReader) Columns() []string { return j.keys }
+
+func (j *jsonReader) Read() ([]string, error) {
+	for len(j.pending) == 0 {
+		v, err := j.next()
+		if err != nil {
+			return nil, err
+		}
+		rows, err := j.flatten(v)
+		if err != nil {
+			return nil, err
+		}
+		j.pending = rows
+	}
+	rec := j.pending[0]
+	j.pending = j.pending[1:]
+	return rec, nil
+}
+
+// next はトップレベルの次の値（配列なら要素、NDJSON なら 1 行）
+func (j *jsonReader) next() (interface{}, error) {
+	if !j.started {
+		j.started = true
+		tok, err := j.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); ok && d == '[' {
+			j.inArray = true
+		} else {
+			return decodeJSONValue(j.dec, tok, 0)
+		}
+	}
+	if j.inArray && !j.dec.More() {
+		if _, err := j.dec.Token(); err != nil { // ']'
+			return nil, err
+		}
+		if _, err := j.dec.Token(); !errors.Is(err, io.EOF) {
+			return nil, errors.New("unexpected data after the top-level JSON array")
+		}
+		return nil, io.EOF
+	}
+	tok, err := j.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONValue(j.dec, tok, 0)
+}
+
+// decodeJSONValue は tok から始まる値をキー順を保って読む
+func decodeJSONValue(dec *json.Decoder, tok json.Token, depth int) (interface{}, error) {
+	if depth > maxJSONDepth {
+		return nil, fmt.Errorf("JSON is nested deeper than %d levels", maxJSONDepth)
+	}
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch d {
+	case '{':
+		obj := jsonObject{}
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			vt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSONValue(dec, vt, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{key: kt.(string), val: v})
+		}
+		_, err := dec.Token() // '}'
+		return obj, err
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			vt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSONValue(dec, vt, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token() // ']'
+		return arr, err
+	}
+	return nil, fmt.Errorf("unexpected %v", d)
+}
+
+// flatten は 1 つの値を行にする（explode なら配列の要素の組み合わせごとに 1 行）
+func (j *jsonReader) flatten(v interface{}) ([][]string, error) {
+	// 行ごとの (列, 値)。トップレベルがスカラーなら value 列
+	rows := [][]jsonField{{}}
+	prefix := ""
+	if _, ok := v.(jsonObject); !ok {
+		if _, isArr := v.([]interface{}); !isArr {
+			prefix = "value"
+		}
+	}
+	rows, err := j.walk(prefix, v, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][]string, 0, len(rows))
+	for _, fields := range rows {
+		for _, f := range fields {
+			if _, ok := j.index[f.key]; !ok {
+				if len(j.keys) >= maxJSONColumns {
+					return nil, fmt.Errorf("JSON has more than %d columns", maxJSONColumns)
+				}
+				j.index[f.key] = len(j.keys)
+				j.keys = append(j.keys, f.key)
+			}
+		}
+	}
+	for _, fields := range rows {
+		rec := make([]string, len(j.keys))
+		for _, f := range fields {
+			rec[j.index[f.key]] = f.val.(string)
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// walk は v を path 以下の列として rows のそれぞれに足す
+func (j *jsonReader) walk(path string, v interface{}, rows [][]jsonField) ([][]jsonField, error) {
+	join := func(k string) string {
+		if path == "" {
+			return k
+		}
+		return path + "." + k
+	}
+	var err error
+	switch t := v.(type) {
+	case jsonObject:
+		for _, f := range t {
+			if rows, err = j.walk(join(f.key), f.val, rows); err != nil {
+				return nil, err
+			}
+		}
+		return rows, nil
+	case []interface{}:
+		if !j.explode || len(t) == 0 {
+			for i, e := range t {
+				if rows, err = j.walk(join(strconv.Itoa(i)), e, rows); err != nil {
+					return nil, err
+				}
+			}
+			return rows, nil
+		}
+		// 要素ごとに行を分ける（複数の配列があれば組み合わせ）
+		if len(rows)*len(t) > maxJSONExplodedRows {
+			return nil, fmt.Errorf("exploding arrays produces more than %d rows from one record", maxJSONExplodedRows)
+		}
+		var out [][]jsonField
+		for _, e := range t {
+			branch := make([][]jsonField, len(rows))
+			for i, r := range rows {
+				branch[i] = append([]jsonField(nil), r...)
+			}
+			if branch, err = j.walk(path, e, branch); err != nil {
+				return nil, err
+			}
+			out = append(out, branch...)
+		}
+		return out, nil
+	}
+
+	if path == "" {
+		path = "value"
+	}
+	s := jsonScalar(v)
+	for i := range rows {
+		rows[i] = append(rows[i], jsonField{key: path, val: s})
+	}
+	return rows, nil
+}
+
+// jsonScalar は文字列・数値（元の表記のまま）・真偽値を文字列にする（null は空）
+func jsonScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPreviewJSONArray(t *testing.T) {
+	src := `[
+  {"id": 1, "customer": {"name": "Taro", "address": {"city": "Tokyo"}}, "tags": ["a", "b"], "vip": true},
+  {"id": 2, "customer": {"name": "Hanako", "address": {"city": "Osaka", "zip": "530-0001"}}, "note": null}
+]`
+	pv, err := buildPreviewWith(strings.NewReader(src), formatFromUpload("orders.json", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeaders := []string{"id", "customer.name", "customer.address.city", "tags.0", "tags.1", "vip", "customer.address.zip", "note"}
+	if pv.Format != "json" || pv.HasHeader || pv.RowCount != 2 || !reflect.DeepEqual(pv.Headers, wantHeaders) {
+		t.Fatalf("preview = %+v", pv)
+	}
+	want := [][]string{
+		{"1", "Taro", "Tokyo", "a", "b", "true", "", ""},
+		{"2", "Hanako", "Osaka", "", "", "", "530-0001", ""},
+	}
+	if !reflect.DeepEqual(pv.SampleRows, want) {
+		t.Fatalf("rows = %q", pv.SampleRows)
+	}
+}
+
+func TestBuildPreviewNDJSONExplode(t *testing.T) {
+	src := `{"order": "A1", "items": [{"sku": "X", "qty": 2}, {"sku": "Y", "qty": 1.50}]}
+
+{"order": "A2", "items": []}
+{"order": "A3", "items": [{"sku": "Z", "qty": 3}]}
+`
+	opts := &ParseOptions{Format: "ndjson", Arrays: "explode"}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	pv, err := buildPreviewWith(strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"order", "items.sku", "items.qty"}) {
+		t.Fatalf("headers = %q", pv.Headers)
+	}
+	want := [][]string{{"A1", "X", "2"}, {"A1", "Y", "1.50"}, {"A2", "", ""}, {"A3", "Z", "3"}}
+	if pv.RowCount != 4 || !reflect.DeepEqual(pv.SampleRows, want) {
+		t.Fatalf("rows = %q", pv.SampleRows)
+	}
+}
+
+func TestJSONReaderErrors(t *testing.T) {
+	cases := map[string]string{
+		"trailing data": `[{"a": 1}] {"b": 2}`,
+		"broken":        `[{"a": 1}, {"b": }]`,
+		"too deep":      strings.Repeat(`{"a":`, maxJSONDepth+2) + "1" + strings.Repeat("}", maxJSONDepth+2),
+	}
+	for name, src := range cases {
+		if _, err := buildPreviewWith(strings.NewReader(src), &ParseOptions{Format: "json"}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFormatFromUpload(t *testing.T) {
+	if formatFromUpload("a.csv", "text/csv") != nil {
+		t.Fatal("csv should be sniffed")
+	}
+	for _, c := range [][2]string{{"a.JSONL", ""}, {"a.ndjson", ""}, {"export", "application/json; charset=utf-8"}} {
+		if o := formatFromUpload(c[0], c[1]); !o.isJSON() {
+			t.Fatalf("%v: %+v", c, o)
+		}
+	}
+	if err := (&ParseOptions{Arrays: "explode"}).validate(); err == nil {
+		t.Fatal("arrays without json should be rejected")
+	}
+}
@@ -0,0 +1,398 @@
+// api/internal/handlers/jwt.go
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supabase Auth 互換の JWT 検証（HS256 / RS256 / ES256）
+// 鍵は HS256 の共有シークレット、または JWKS（ローカルファイル or URL）から読む
+
+var errInvalidToken = errors.New("invalid token")
+
+// TokenClaims は JWT から取り出す項目
+type TokenClaims struct {
+	Subject     string
+	Role        string // Supabase の "role"（authenticated など）
+	WorkspaceID string // "workspace_id" または "app_metadata.workspace_id"
+	// ワークスペース内ロール（"workspace_role" / "app_metadata.workspace_role"）。workspace_members が優先
+	WorkspaceRole string
+	Email         string
+}
+
+type JWTVerifier struct {
+	HS256Secret []byte
+	JWKS        *JWKSCache
+	Issuer      string // 空なら検証しない
+	Audience    string // 空なら検証しない
+	Leeway      time.Duration
+
+	now func() time.Time
+}
+
+// NewJWTVerifierFromEnv は JWT_HS256_SECRET / JWT_JWKS_URL が無ければ nil を返す（Bearer 認証なし）
+func NewJWTVerifierFromEnv() *JWTVerifier {
+	secret := os.Getenv("JWT_HS256_SECRET")
+	jwksURL := os.Getenv("JWT_JWKS_URL")
+	if secret == "" && jwksURL == "" {
+		return nil
+	}
+	v := &JWTVerifier{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   30 * time.Second,
+	}
+	if secret != "" {
+		v.HS256Secret = []byte(secret)
+	}
+	if jwksURL != "" {
+		v.JWKS = NewJWKSCache(jwksURL, 10*time.Minute)
+	}
+	return v
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify は署名と exp/nbf/iss/aud を検証してクレームを返す
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := v.verifySignature(ctx, hdr, signed, sig); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, errInvalidToken
+	}
+	if err := v.validateClaims(raw); err != nil {
+		return nil, err
+	}
+	c := extractClaims(raw)
+	// ワークスペースは RLS の設定値に使うので、DB に渡す前に形を確かめる（不正なら 500 ではなく 401）
+	if c.WorkspaceID != "" && !isUUID(c.WorkspaceID) {
+		return nil, fmt.Errorf("%w: workspace_id must be a UUID", errInvalidToken)
+	}
+	return c, nil
+}
+
+func (v *JWTVerifier) verifySignature(ctx context.Context, hdr jwtHeader, signed, sig []byte) error {
+	switch hdr.Alg {
+	case "HS256":
+		if len(v.HS256Secret) == 0 {
+			return fmt.Errorf("%w: HS256 is not configured", errInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.HS256Secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("%w: bad signature", errInvalidToken)
+		}
+		return nil
+	case "RS256", "ES256":
+		if v.JWKS == nil {
+			return fmt.Errorf("%w: %s is not configured", errInvalidToken, hdr.Alg)
+		}
+		key, err := v.JWKS.Key(ctx, hdr.Kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(signed)
+		switch pub := key.(type) {
+		case *rsa.PublicKey:
+			if hdr.Alg != "RS256" || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+				return fmt.Errorf("%w: bad signature", errInvalidToken)
+			}
+		case *ecdsa.PublicKey:
+			// JWS の ES256 署名は r||s（各 32byte）
+			if hdr.Alg != "ES256" || len(sig) != 64 {
+				return fmt.Errorf("%w: bad signature", errInvalidToken)
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if !ecdsa.Verify(pub, digest[:], r, s) {
+				return fmt.Errorf("%w: bad signature", errInvalidToken)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported key type", errInvalidToken)
+		}
+		return nil
+	default:
+		// "none" を含め、想定外のアルゴリズムは受け付けない
+		return fmt.Errorf("%w: unsupported alg %q", errInvalidToken, hdr.Alg)
+	}
+}
+
+func (v *JWTVerifier) validateClaims(c map[string]interface{}) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	exp, ok := numericClaim(c, "exp")
+	if !ok {
+		return fmt.Errorf("%w: exp is required", errInvalidToken)
+	}
+	if now.After(time.Unix(exp, 0).Add(v.Leeway)) {
+		return fmt.Errorf("%w: token expired", errInvalidToken)
+	}
+	if nbf, ok := numericClaim(c, "nbf"); ok && now.Add(v.Leeway).Before(time.Unix(nbf, 0)) {
+		return fmt.Errorf("%w: token not yet valid", errInvalidToken)
+	}
+	if v.Issuer != "" {
+		if iss, _ := c["iss"].(string); iss != v.Issuer {
+			return fmt.Errorf("%w: bad issuer", errInvalidToken)
+		}
+	}
+	if v.Audience != "" && !audienceContains(c["aud"], v.Audience) {
+		return fmt.Errorf("%w: bad audience", errInvalidToken)
+	}
+	return nil
+}
+
+func extractClaims(c map[string]interface{}) *TokenClaims {
+	out := &TokenClaims{}
+	out.Subject, _ = c["sub"].(string)
+	out.Role, _ = c["role"].(string)
+	out.Email, _ = c["email"].(string)
+
+	// ワークスペースはトップレベル優先、無ければ app_metadata（Supabase のカスタムクレーム置き場）
+	out.WorkspaceID, _ = c["workspace_id"].(string)
+	out.WorkspaceRole, _ = c["workspace_role"].(string)
+	if md, ok := c["app_metadata"].(map[string]interface{}); ok {
+		if out.WorkspaceID == "" {
+			out.WorkspaceID, _ = md["workspace_id"].(string)
+		}
+		if out.WorkspaceRole == "" {
+			out.WorkspaceRole, _ = md["workspace_role"].(string)
+		}
+	}
+	return out
+}
+
+func numericClaim(c map[string]interface{}, name string) (int64, bool) {
+	f, ok := c[name].(float64)
+	return int64(f), ok
+}
+
+func audienceContains(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// ===== JWKS =====
+
+// JWKSCache は JWKS を TTL 付きでキャッシュし、未知の kid が来たら再取得する（鍵ローテーション対応）
+type JWKSCache struct {
+	Source string // https://... / file:///... / ローカルパス
+	TTL    time.Duration
+	// 未知 kid による再取得の最短間隔（不正トークンで取得元を叩かせないため）
+	MinRefresh time.Duration
+	Client     *http.Client
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	refreshing chan struct{} // 取得中は非 nil（終わったら閉じる）
+}
+
+func NewJWKSCache(source string, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		Source:     source,
+		TTL:        ttl,
+		MinRefresh: 30 * time.Second,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Key は kid に対応する公開鍵を返す
+// 取得はロックの外で 1 本だけ行う（遅い取得元で、キャッシュにある鍵のリクエストまで待たせない）
+func (c *JWKSCache) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	stale := c.keys == nil || time.Since(c.fetchedAt) > c.TTL
+	if !stale {
+		if k, ok := c.keys[kid]; ok {
+			c.mu.Unlock()
+			return k, nil
+		}
+		if time.Since(c.fetchedAt) < c.MinRefresh {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("%w: unknown kid %q", errInvalidToken, kid)
+		}
+	}
+	if wait := c.refreshing; wait != nil {
+		// 他のリクエストが取得中。古いキャッシュにあればそれを使い、無ければ取得を待つ
+		if k, ok := c.keys[kid]; ok {
+			c.mu.Unlock()
+			return k, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if k, ok := c.keys[kid]; ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("%w: unknown kid %q", errInvalidToken, kid)
+	}
+	done := make(chan struct{})
+	c.refreshing = done
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = nil
+	close(done)
+	if err == nil {
+		c.keys = keys
+		c.fetchedAt = time.Now()
+	}
+	// 取得に失敗しても、古いキャッシュに kid があればそれを使う
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: unknown kid %q", errInvalidToken, kid)
+}
+
+// fetch は JWKS を読み込んで鍵にする（ロックは持たない）
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	b, err := c.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	return keys, nil
+}
+
+func (c *JWKSCache) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(c.Source, "http://") && !strings.HasPrefix(c.Source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(c.Source, "file://"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+	out := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("kid %q: bad RSA key", k.Kid)
+			}
+			out[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("kid %q: bad EC key", k.Kid)
+			}
+			if len(x) != 32 || len(y) != 32 {
+				return nil, fmt.Errorf("kid %q: bad EC key", k.Kid)
+			}
+			// 曲線上の点かどうかは crypto/ecdh に検証させる
+			if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+				return nil, fmt.Errorf("kid %q: %w", k.Kid, err)
+			}
+			out[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return out, nil
+}
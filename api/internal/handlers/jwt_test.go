@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const jwtWorkspaceID = "7d9f3c1e-2b4a-4f6e-8a1d-5c3b2e1f0a9d"
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// signJWT はテスト用にトークンを作る（key は *rsa.PrivateKey / *ecdsa.PrivateKey / []byte）
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signing := b64(hdr) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signing))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signing))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signing + "." + b64(sig)
+}
+
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.PublicKey) {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, k := range keys {
+		switch pub := k.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig",
+				"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			x, y := make([]byte, 32), make([]byte, 32)
+			pub.X.FillBytes(x)
+			pub.Y.FillBytes(y)
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "EC", "kid": kid, "use": "sig", "crv": "P-256", "x": b64(x), "y": b64(y),
+			})
+		}
+	}
+	b, _ := json.Marshal(set)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("super-secret-jwt-token-with-at-least-32-characters")
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, map[string]crypto.PublicKey{"rsa1": &rsaKey.PublicKey, "ec1": &ecKey.PublicKey})
+
+	jwks := NewJWKSCache(jwksPath, time.Hour)
+	jwks.MinRefresh = 0
+	v := &JWTVerifier{HS256Secret: secret, JWKS: jwks, Audience: "authenticated", Leeway: time.Second}
+
+	now := time.Now()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":          "user-1",
+			"role":         "authenticated",
+			"aud":          "authenticated",
+			"exp":          now.Add(time.Hour).Unix(),
+			"app_metadata": map[string]interface{}{"workspace_id": jwtWorkspaceID},
+		}
+		for k, val := range extra {
+			c[k] = val
+		}
+		return c
+	}
+	ctx := context.Background()
+
+	for name, tok := range map[string]string{
+		"RS256": signJWT(t, "RS256", "rsa1", rsaKey, claims(nil)),
+		"ES256": signJWT(t, "ES256", "ec1", ecKey, claims(nil)),
+		"HS256": signJWT(t, "HS256", "", secret, claims(nil)),
+	} {
+		c, err := v.Verify(ctx, tok)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Subject != "user-1" || c.Role != "authenticated" || c.WorkspaceID != jwtWorkspaceID {
+			t.Fatalf("%s: unexpected claims %+v", name, c)
+		}
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	bad := map[string]string{
+		"expired":       signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+		"wrong aud":     signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"aud": "anon"})),
+		"wrong key":     signJWT(t, "RS256", "rsa1", otherKey, claims(nil)),
+		"unknown kid":   signJWT(t, "RS256", "nope", rsaKey, claims(nil)),
+		"wrong secret":  signJWT(t, "HS256", "", []byte("other"), claims(nil)),
+		"alg confusion": signJWT(t, "ES256", "rsa1", ecKey, claims(nil)),
+		"alg none":      signJWT(t, "none", "", []byte{}, claims(nil)),
+		"bad workspace": signJWT(t, "RS256", "rsa1", rsaKey, claims(map[string]interface{}{"workspace_id": "ws-1"})),
+	}
+	for name, tok := range bad {
+		if _, err := v.Verify(ctx, tok); !errors.Is(err, errInvalidToken) {
+			t.Fatalf("%s: got %v, want errInvalidToken", name, err)
+		}
+	}
+
+	// 鍵ローテーション: JWKS に新しい kid が増えたら再取得して受け付ける
+	rotated, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeJWKS(t, jwksPath, map[string]crypto.PublicKey{"rsa2": &rotated.PublicKey})
+	if _, err := v.Verify(ctx, signJWT(t, "RS256", "rsa2", rotated, claims(nil))); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+}
+
+func TestAuthenticatorBearer(t *testing.T) {
+	secret := []byte("local-test-secret")
+	a := &Authenticator{JWT: &JWTVerifier{HS256Secret: secret}}
+
+	var got *Principal
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFrom(r.Context())
+	}))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	cases := []struct {
+		claims map[string]interface{}
+		want   int
+	}{
+		{map[string]interface{}{"sub": "u1", "role": "authenticated", "workspace_id": jwtWorkspaceID, "exp": exp}, http.StatusOK},
+		{map[string]interface{}{"sub": "u1", "exp": exp}, http.StatusForbidden},                            // ワークスペースなし
+		{map[string]interface{}{"sub": "u1", "workspace_id": jwtWorkspaceID}, http.StatusUnauthorized},     // exp なし
+		{map[string]interface{}{"sub": "u1", "workspace_id": "ws-1", "exp": exp}, http.StatusUnauthorized}, // UUID でない
+	}
+	for i, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/templates", nil)
+		req.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "", secret, c.claims))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Fatalf("case %d: got %d, want %d (%s)", i, w.Code, c.want, w.Body.String())
+		}
+	}
+
+	got = nil
+	req := httptest.NewRequest(http.MethodGet, "/api/templates", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "", secret, cases[0].claims))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.WorkspaceID != jwtWorkspaceID || got.AuthRole != "authenticated" || got.Actor() != "user:u1" {
+		t.Fatalf("unexpected principal: %+v", got)
+	}
+}
+
+// 取得元が遅くても、キャッシュにある鍵のリクエストは取得を待たない
+func TestJWKSCacheFetchOutsideLock(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, map[string]crypto.PublicKey{"rsa1": &rsaKey.PublicKey})
+	body, err := os.ReadFile(jwksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			close(started)
+			<-release
+		}
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := NewJWKSCache(srv.URL, time.Hour)
+	c.MinRefresh = 0
+	ctx := context.Background()
+	if _, err := c.Key(ctx, "rsa1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知の kid で再取得が止まっている間に
+	unknown := make(chan error, 1)
+	go func() {
+		_, err := c.Key(ctx, "nope")
+		unknown <- err
+	}()
+	<-started
+	// 他の未知 kid は同じ取得を待ち、キャッシュにある kid はすぐ返る
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := c.Key(ctx, "other")
+		waiting <- err
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Key(ctx, "rsa1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cached key lookup blocked behind the JWKS fetch")
+	}
+	close(release)
+	for _, ch := range []chan error{unknown, waiting} {
+		if err := <-ch; !errors.Is(err, errInvalidToken) {
+			t.Fatalf("unknown kid: got %v", err)
+		}
+	}
+}
@@ -2,57 +2,177 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"sort"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type ApplyRequest struct {
-	Headers []string           `json:"headers"`
-	Rows    [][]string         `json:"rows"`
-	Rules   map[string]*string `json:"rules"` // dest -> source (null 可)
+	Headers []string `json:"headers"`
+	// Columns はプレビューの columns（あれば元の表記・列番号でもルールが当たる。省略時は headers から作る）
+	Columns []ColumnInfo    `json:"columns,omitempty"`
+	Rows    [][]string      `json:"rows"`
+	Rules   json.RawMessage `json:"rules,omitempty"` // dest -> source (null 可)。RuleSet として検証する
+
+	// rules の代わりに保存済みテンプレートを参照する（常に最新版が使われる）
+	TemplateID string `json:"templateId,omitempty"`
+	// テンプレートのルールを dest 単位で上書き（templateId 指定時のみ）
+	Overrides json.RawMessage `json:"overrides,omitempty"`
 }
 
 type ApplyResponse struct {
 	NormalizedHeaders []string   `json:"normalizedHeaders"`
 	NormalizedRows    [][]string `json:"normalizedRows"`
+	TemplateID        string     `json:"templateId,omitempty"`
+	// Resolved はこのファイルで各項目が取り出した列番号（1 始まり、見つからなければ null）
+	Resolved map[string]*int `json:"resolved"`
+}
+
+type MappingHandler struct {
+	Store *store.Store
+}
+
+func NewMappingHandler(s *store.Store) *MappingHandler {
+	return &MappingHandler{Store: s}
+}
+
+var errTemplateNotFound = errors.New("template not found")
+
+// checkColumnCount は列番号で書いたテンプレート（columnCount > 0）が、この列数のファイルに当てられるか
+func checkColumnCount(columnCount, got int) error {
+	if columnCount > 0 && got != columnCount {
+		return fmt.Errorf("positional template expects %d columns, file has %d", columnCount, got)
+	}
+	return nil
 }
 
 // POST /api/mappings/apply
-func ApplyMapping(w http.ResponseWriter, r *http.Request) {
+func (h *MappingHandler) ApplyMapping(w http.ResponseWriter, r *http.Request) {
 	var in ApplyRequest
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
-	// source header -> index
-	idx := make(map[string]int, len(in.Headers))
-	for i, h := range in.Headers {
-		idx[h] = i
+	var rules RuleSet
+	var issues []RuleIssue
+	columnCount := 0
+	switch {
+	case in.TemplateID != "" && hasRules(in.Rules):
+		http.Error(w, "specify either rules or templateId, not both", http.StatusBadRequest)
+		return
+	case in.TemplateID != "":
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		rules, columnCount, issues, err = h.loadTemplateRules(ctx, workspaceID(r), in.TemplateID)
+		if errors.Is(err, errTemplateNotFound) {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db query error", http.StatusInternalServerError)
+			return
+		}
+		if len(issues) == 0 && hasRules(in.Overrides) {
+			var ov RuleSet
+			ov, issues = parseRulesAt(in.Overrides, "overrides")
+			rules = rules.Patch(ov)
+		}
+	case hasRules(in.Overrides):
+		http.Error(w, "overrides require templateId", http.StatusBadRequest)
+		return
+	default:
+		rules, issues = parseRules(in.Rules)
+	}
+	if len(issues) > 0 {
+		writeRuleIssues(w, issues)
+		return
 	}
 
-	// スキーマは rules のキー順（安定化）
-	schema := make([]string, 0, len(in.Rules))
-	for k := range in.Rules {
-		schema = append(schema, k)
+	cols := in.Columns
+	if len(cols) == 0 {
+		cols = columnsFromHeaders(in.Headers)
+	}
+	if err := checkColumnCount(columnCount, len(cols)); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
 	}
-	sort.Strings(schema)
+	out := applyRules(rules, cols, in.Rows)
+	out.TemplateID = in.TemplateID
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// loadTemplateRules は mapping_templates からルールを読み、RuleSet として解釈する
+// 列番号で書いたテンプレート（positional）なら前提の列数も返す（それ以外は 0）
+// 保存時に検証済みだが、検証導入前の古い行もあるので issues は "template.rules" 起点で返す
+func (h *MappingHandler) loadTemplateRules(ctx context.Context, workspaceID, id string) (RuleSet, int, []RuleIssue, error) {
+	const q = `
+select rules, case when positional then column_count else 0 end
+from public.mapping_templates
+where id = $1 and deleted_at is null
+limit 1;
+`
+	var raw []byte
+	var columnCount int
+	err := h.Store.InWorkspace(ctx, workspaceID, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, q, id).Scan(&raw, &columnCount)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, nil, errTemplateNotFound
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	rules, issues := parseRulesAt(raw, "template.rules")
+	return rules, columnCount, issues, nil
+}
+
+// applyRules は rows をスキーマ（rules のキー順）に並べ替える
+func applyRules(rules RuleSet, cols []ColumnInfo, rows [][]string) ApplyResponse {
+	// dest -> source の列位置（見つからない列は -1）
+	idx := make(map[string]int, len(rules))
+	for dest, src := range rules {
+		idx[dest] = -1
+		if src == nil {
+			continue
+		}
+		if i, ok := resolveColumn(src, cols); ok {
+			idx[dest] = i
+		}
+	}
+
+	// スキーマは rules のキー順（安定化）
+	schema := rules.Dests()
 
 	out := ApplyResponse{
 		NormalizedHeaders: schema,
-		NormalizedRows:    make([][]string, 0, len(in.Rows)),
+		NormalizedRows:    make([][]string, 0, len(rows)),
+		Resolved:          make(map[string]*int, len(schema)),
+	}
+	for _, dest := range schema {
+		if i := idx[dest]; i >= 0 {
+			n := cols[i].Index
+			out.Resolved[dest] = &n
+		} else {
+			out.Resolved[dest] = nil
+		}
 	}
 
-	for _, row := range in.Rows {
+	for _, row := range rows {
 		dest := make([]string, len(schema))
 		for j, col := range schema {
-			src := in.Rules[col]
-			if src == nil {
-				dest[j] = ""
-				continue
-			}
-			if i, ok := idx[*src]; ok && i < len(row) {
+			if i := idx[col]; i >= 0 && i < len(row) {
 				dest[j] = row[i]
 			} else {
 				dest[j] = ""
@@ -60,7 +180,5 @@ func ApplyMapping(w http.ResponseWriter, r *http.Request) {
 		}
 		out.NormalizedRows = append(out.NormalizedRows, dest)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(out)
+	return out
 }
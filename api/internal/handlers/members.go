@@ -0,0 +1,151 @@
+// api/internal/handlers/members.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type Member struct {
+	UserID    string    `json:"user_id"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type MemberHandler struct {
+	Store *store.Store
+}
+
+func NewMemberHandler(s *store.Store) *MemberHandler {
+	return &MemberHandler{Store: s}
+}
+
+// GET /api/members
+func (h *MemberHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	const q = `
+select user_id, role, created_at, updated_at
+from public.workspace_members
+order by created_at;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := make([]Member, 0)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m Member
+			if err := rows.Scan(&m.UserID, &m.Role, &m.CreatedAt, &m.UpdatedAt); err != nil {
+				return err
+			}
+			out = append(out, m)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PUT /api/members/{userID}  {"role":"editor"}
+func (h *MemberHandler) PutMember(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	var in struct {
+		Role Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if userID == "" || !in.Role.Valid() {
+		http.Error(w, "user id and role (viewer/editor/admin) are required", http.StatusBadRequest)
+		return
+	}
+
+	const q = `
+insert into public.workspace_members (user_id, role)
+values ($1, $2)
+on conflict (workspace_id, user_id) do update set role = excluded.role
+returning user_id, role, created_at, updated_at;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var m Member
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotMember(ctx, tx, userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err := tx.QueryRow(ctx, q, userID, in.Role).Scan(&m.UserID, &m.Role, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return err
+		}
+		after, err := snapshotMember(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditMemberUpsert, TargetType: "member", TargetID: userID, Before: before, After: after,
+		})
+	})
+	if err != nil {
+		http.Error(w, "db upsert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// DELETE /api/members/{userID}
+func (h *MemberHandler) DeleteMember(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotMember(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from public.workspace_members where user_id = $1`, userID); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditMemberDelete, TargetType: "member", TargetID: userID, Before: before,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db delete error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snapshotMember は監査ログ用に行をロックして取る（無ければ pgx.ErrNoRows）
+func snapshotMember(ctx context.Context, tx pgx.Tx, userID string) (map[string]interface{}, error) {
+	return snapshotRow(ctx, tx, `select to_jsonb(m) from public.workspace_members m where user_id = $1 for update`, userID)
+}
@@ -0,0 +1,429 @@
+// api/internal/handlers/parse_options.go
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// ParseOptions は推定に任せず明示する読み取り設定
+// （POST /api/imports/{id}/reparse、アップロード時の parseOptions、テンプレートの parse_options）
+// 使った設定は imports.parse_options に残し、以後の parse も同じ設定で読む
+type ParseOptions struct {
+	Format        string        `json:"format,omitempty"`        // csv（既定）/ fixed（固定長）/ json（JSON 配列・NDJSON）/ ods / xls（Excel 97-2003）
+	Sheet         string        `json:"sheet,omitempty"`         // ods / xls のシート名か 0 始まりの番号。省略で先頭のワークシート
+	Columns       []FixedColumn `json:"columns,omitempty"`       // fixed の列。省略で空白の位置から推定
+	Arrays        string        `json:"arrays,omitempty"`        // json の配列の扱い。index（既定、items.0.sku）/ explode（要素ごとに行を分ける）
+	Delimiter     string        `json:"delimiter,omitempty"`     // 1 文字（タブは "\t"、" " は桁そろえの空白区切り）。空なら推定
+	Quote         string        `json:"quote,omitempty"`         // 囲み文字。空なら `"`、"none" で囲みなし
+	Escape        string        `json:"escape,omitempty"`        // double（既定、"" で "）/ backslash（\" \\）
+	Encoding      string        `json:"encoding,omitempty"`      // utf-8（既定）/ shift_jis / euc-jp / utf-16le など WHATWG のラベル
+	HeaderRow     *int          `json:"headerRow,omitempty"`     // skipTop の後の何レコード目がヘッダか（0 始まり）。-1 でヘッダなし、省略で推定
+	HeaderKeys    string        `json:"headerKeys,omitempty"`    // label（既定、元の文字のまま正規化）/ ascii（英訳・ローマ字の英数字キー）
+	HeaderRows    int           `json:"headerRows,omitempty"`    // ヘッダの行数（2 以上は「グループ_項目」に連結）。省略で 1（推定時は 2 行ヘッダも探す）
+	SkipTop       int           `json:"skipTop,omitempty"`       // 先頭で読み飛ばす行数（表題など CSV でない行）
+	SkipBottom    int           `json:"skipBottom,omitempty"`    // 末尾で捨てるレコード数（合計行など）
+	CommentPrefix string        `json:"commentPrefix,omitempty"` // この文字列で始まる行は読み飛ばす
+	Trim          string        `json:"trim,omitempty"`          // none（既定、fixed は both）/ both / left / right
+}
+
+// 読み飛ばし・ヘッダ位置の上限（巨大な値で全件読み捨てるのを防ぐ）
+const maxParseSkip = 10000
+
+// validate は設定の誤りを返す（422 の本文）
+func (o *ParseOptions) validate() error {
+	switch o.Format {
+	case "", "csv":
+		if len(o.Columns) > 0 {
+			return errors.New(`columns requires format "fixed"`)
+		}
+	case "fixed":
+		if err := validateFixedColumns(o.Columns); err != nil {
+			return err
+		}
+	case "json", "ndjson":
+		if len(o.Columns) > 0 {
+			return errors.New(`columns requires format "fixed"`)
+		}
+		if o.HeaderRow != nil || o.HeaderRows != 0 {
+			return errors.New("headerRow is not used for JSON (keys become headers)")
+		}
+	case "ods", "xls":
+		if len(o.Columns) > 0 {
+			return errors.New(`columns requires format "fixed"`)
+		}
+	default:
+		return errors.New("format must be csv, fixed, json, ods or xls")
+	}
+	if o.Sheet != "" && !o.isSpreadsheet() {
+		return errors.New(`sheet requires format "ods" or "xls"`)
+	}
+	switch o.Arrays {
+	case "":
+	case "index", "explode":
+		if !o.isJSON() {
+			return errors.New(`arrays requires format "json"`)
+		}
+	default:
+		return errors.New("arrays must be index or explode")
+	}
+	if o.Delimiter != "" {
+		d, n := utf8.DecodeRuneInString(o.Delimiter)
+		if n != len(o.Delimiter) || d == utf8.RuneError || d == '\r' || d == '\n' {
+			return errors.New("delimiter must be a single character")
+		}
+	}
+	if q := o.quoteRune(); o.Quote != "" && o.Quote != "none" {
+		if utf8.RuneCountInString(o.Quote) != 1 || q == '\r' || q == '\n' {
+			return errors.New(`quote must be a single character or "none"`)
+		}
+		if o.Delimiter != "" && q == o.delimiterRune() {
+			return errors.New("quote and delimiter must differ")
+		}
+	}
+	switch o.Escape {
+	case "", "double", "backslash":
+	default:
+		return errors.New("escape must be double or backslash")
+	}
+	if _, err := o.encoding(); err != nil {
+		return err
+	}
+	if o.HeaderRow != nil && (*o.HeaderRow < -1 || *o.HeaderRow > maxParseSkip) {
+		return fmt.Errorf("headerRow must be between -1 and %d", maxParseSkip)
+	}
+	switch o.HeaderKeys {
+	case "", "label", "ascii":
+	default:
+		return errors.New("headerKeys must be label or ascii")
+	}
+	if o.HeaderRows < 0 || o.HeaderRows > maxHeaderRows {
+		return fmt.Errorf("headerRows must be between 0 (default) and %d", maxHeaderRows)
+	}
+	if o.HeaderRows > 0 && o.headerMode() == -1 {
+		return errors.New("headerRows cannot be used with headerRow -1")
+	}
+	if o.SkipTop < 0 || o.SkipTop > maxParseSkip || o.SkipBottom < 0 || o.SkipBottom > maxParseSkip {
+		return fmt.Errorf("skipTop and skipBottom must be between 0 and %d", maxParseSkip)
+	}
+	switch o.Trim {
+	case "", "none", "both", "left", "right":
+	default:
+		return errors.New("trim must be none, both, left or right")
+	}
+	return nil
+}
+
+// isJSON は JSON 配列 / NDJSON として読むか（どちらも同じリーダで読める）
+func (o *ParseOptions) isJSON() bool {
+	return o != nil && (o.Format == "json" || o.Format == "ndjson")
+}
+
+// isSpreadsheet は表計算ファイル（.ods / .xls）として読むか
+func (o *ParseOptions) isSpreadsheet() bool {
+	return o != nil && (o.Format == "ods" || o.Format == "xls")
+}
+
+func (o *ParseOptions) delimiterRune() rune {
+	r, _ := utf8.DecodeRuneInString(o.Delimiter)
+	return r
+}
+
+// quoteRune は囲み文字（0 = 囲みなし）
+func (o *ParseOptions) quoteRune() rune {
+	switch o.Quote {
+	case "":
+		return '"'
+	case "none":
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(o.Quote)
+	return r
+}
+
+// encoding は文字コード（nil = UTF-8）
+func (o *ParseOptions) encoding() (encoding.Encoding, error) {
+	switch strings.ToLower(o.Encoding) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(o.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding %q", o.Encoding)
+	}
+	return enc, nil
+}
+
+// headerMode は -2 = 推定 / -1 = ヘッダなし / 0 以上 = その位置
+func (o *ParseOptions) headerMode() int {
+	if o == nil || o.HeaderRow == nil {
+		return -2
+	}
+	return *o.HeaderRow
+}
+
+// asciiHeaderKeys はヘッダを英数字のキーにするか
+func (o *ParseOptions) asciiHeaderKeys() bool {
+	return o != nil && o.HeaderKeys == "ascii"
+}
+
+// headerRowCount はヘッダの行数の指定（0 = 指定なし）
+func (o *ParseOptions) headerRowCount() int {
+	if o == nil {
+		return 0
+	}
+	return o.HeaderRows
+}
+
+// recordReader は csv.Reader と dialectReader の共通部分
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// openRecords は元ファイルをレコード単位で読めるようにし、使う区切り文字を返す
+// opts が nil なら従来どおり推定（encoding/csv）。ヘッダ位置の指定があれば、その手前までは読み捨て済み
+// 区切り文字が空白のときは桁そろえのテキストとみなし、連続した空白を 1 つの区切りとして読む
+func openRecords(src io.Reader, opts *ParseOptions) (recordReader, delimiterGuess, error) {
+	if opts == nil {
+		br := bufio.NewReaderSize(src, 64<<10)
+		skipBOM(br)
+		head, _ := br.Peek(sniffBytes)
+		guess := sniffDelimiter(head)
+		if guess.Delimiter == " " {
+			return &dialectReader{r: br, comma: ' ', quote: '"', collapse: true}, guess, nil
+		}
+		return newCSVReader(br, guess.Delimiter), guess, nil
+	}
+
+	if opts.isSpreadsheet() {
+		// 区切り文字・文字コードは使わない。skipTop は空行を除いたシートの行で数える
+		rows, err := readSpreadsheet(src, opts)
+		if err != nil {
+			return nil, delimiterGuess{}, err
+		}
+		rows = rows[min(opts.SkipTop, len(rows)):]
+		rr, err := skipRecords(&rowsReader{rows: rows, trim: opts.Trim}, opts)
+		return rr, delimiterGuess{Confidence: 1}, err
+	}
+
+	enc, err := opts.encoding()
+	if err != nil {
+		return nil, delimiterGuess{}, err
+	}
+	if enc != nil {
+		// UTF-16 などは BOM があればそちらを優先
+		src = transform.NewReader(src, xunicode.BOMOverride(enc.NewDecoder()))
+	}
+	br := bufio.NewReaderSize(src, 64<<10)
+	skipBOM(br)
+	for i := 0; i < opts.SkipTop; i++ {
+		if _, err := br.ReadString('\n'); err != nil {
+			break
+		}
+	}
+	guess := delimiterGuess{Delimiter: opts.Delimiter, Confidence: 1}
+	if guess.Delimiter == "" && opts.Format != "fixed" && !opts.isJSON() {
+		head, _ := br.Peek(sniffBytes)
+		guess = sniffDelimiter(head)
+	}
+
+	var rr recordReader
+	if opts.isJSON() {
+		// キーがヘッダになるので、ヘッダ行・末尾の読み捨ては無い
+		return newJSONReader(br, opts), guess, nil
+	}
+	if opts.Format == "fixed" {
+		// 固定長は区切り文字を使わない
+		guess = delimiterGuess{Columns: opts.Columns, Confidence: 1}
+		if len(guess.Columns) == 0 {
+			head, _ := br.Peek(sniffBytes)
+			lines := fixedSampleLines(head, opts.CommentPrefix)
+			guess.Columns = detectFixedColumns(lines)
+			if len(lines) > 0 && len(guess.Columns) == 0 {
+				return nil, delimiterGuess{}, errNoFixedColumns
+			}
+			if len(guess.Columns) < 2 {
+				guess.Confidence = 0
+			}
+		}
+		rr = &fixedReader{r: br, cols: guess.Columns, comment: opts.CommentPrefix, trim: opts.Trim}
+	} else {
+		d, _ := utf8.DecodeRuneInString(guess.Delimiter)
+		rr = &dialectReader{
+			r:        br,
+			comma:    d,
+			quote:    opts.quoteRune(),
+			escape:   opts.Escape,
+			comment:  opts.CommentPrefix,
+			trim:     opts.Trim,
+			collapse: d == ' ',
+		}
+	}
+	rr, err = skipRecords(rr, opts)
+	return rr, guess, err
+}
+
+// skipRecords は末尾 skipBottom 件を落とし、ヘッダ位置の手前まで読み捨てる
+func skipRecords(rr recordReader, opts *ParseOptions) (recordReader, error) {
+	if opts.SkipBottom > 0 {
+		rr = &dropLastReader{r: rr, n: opts.SkipBottom}
+	}
+	for i := 0; i < opts.headerMode(); i++ {
+		if _, err := rr.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+	return rr, nil
+}
+
+// dialectReader は囲み文字・エスケープ・コメント行を指定できる CSV リーダ
+// encoding/csv と同じく空行は飛ばし、閉じていない囲みは次の行へ続ける
+type dialectReader struct {
+	r       *bufio.Reader
+	comma   rune
+	quote   rune // 0 = 囲みなし
+	escape  string
+	comment string
+	trim    string
+	// collapse は連続した区切り文字を 1 つとみなし、行頭・行末の区切り文字を無視する（空白区切り）
+	collapse bool
+	line     int
+}
+
+func (d *dialectReader) Read() ([]string, error) {
+	for {
+		line, err := d.r.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		d.line++
+		body := strings.TrimRight(line, "\r\n")
+		if body == "" || (d.comment != "" && strings.HasPrefix(body, d.comment)) {
+			continue
+		}
+		rec, perr := d.parse(line)
+		if perr != nil {
+			return nil, perr
+		}
+		return rec, nil
+	}
+}
+
+// parse は 1 レコードを読む（囲みの中の改行では次の行を読み足す）
+func (d *dialectReader) parse(line string) ([]string, error) {
+	start := d.line
+	if d.collapse {
+		line = strings.TrimLeft(line, string(d.comma))
+	}
+	var fields []string
+	var field strings.Builder
+	inQuote, atStart := false, true
+	backslash := d.escape == "backslash"
+	for {
+		for i := 0; i < len(line); {
+			c, size := utf8.DecodeRuneInString(line[i:])
+			i += size
+			switch {
+			case inQuote && backslash && c == '\\' && i < len(line):
+				n, nsize := utf8.DecodeRuneInString(line[i:])
+				field.WriteRune(n)
+				i += nsize
+			case inQuote && c == d.quote:
+				if !backslash && strings.HasPrefix(line[i:], string(d.quote)) {
+					field.WriteRune(d.quote)
+					i += size
+				} else {
+					inQuote = false
+				}
+			case inQuote && c == '\r' && line[i:] == "\n":
+				// 囲みの中の CRLF は LF にそろえる
+			case inQuote:
+				field.WriteRune(c)
+			case c == d.comma:
+				if d.collapse {
+					for strings.HasPrefix(line[i:], string(d.comma)) {
+						i += size
+					}
+					if strings.TrimRight(line[i:], "\r\n") == "" {
+						continue // 行末の区切り文字
+					}
+				}
+				fields = append(fields, d.trimField(field.String()))
+				field.Reset()
+				atStart = true
+				continue
+			case c == '\r' || c == '\n':
+				// 行末
+			case d.quote != 0 && c == d.quote && atStart:
+				inQuote = true
+			case backslash && c == '\\' && i < len(line) && line[i] != '\r' && line[i] != '\n':
+				n, nsize := utf8.DecodeRuneInString(line[i:])
+				field.WriteRune(n)
+				i += nsize
+			default:
+				field.WriteRune(c)
+			}
+			atStart = false
+		}
+		if !inQuote {
+			break
+		}
+		next, err := d.r.ReadString('\n')
+		if next == "" && err != nil {
+			return nil, fmt.Errorf("line %d: unterminated quoted field", start)
+		}
+		d.line++
+		line = next
+	}
+	return append(fields, d.trimField(field.String())), nil
+}
+
+func (d *dialectReader) trimField(s string) string {
+	return trimValue(s, d.trim)
+}
+
+// trimValue は trim の設定どおりに前後の空白（全角空白を含む）を落とす
+func trimValue(s, mode string) string {
+	switch mode {
+	case "both":
+		return strings.TrimSpace(s)
+	case "left":
+		return strings.TrimLeftFunc(s, unicode.IsSpace)
+	case "right":
+		return strings.TrimRightFunc(s, unicode.IsSpace)
+	}
+	return s
+}
+
+// dropLastReader は末尾 n レコードを返さない（n 件先読みしておく）
+type dropLastReader struct {
+	r   recordReader
+	n   int
+	buf [][]string
+}
+
+func (l *dropLastReader) Read() ([]string, error) {
+	for len(l.buf) <= l.n {
+		rec, err := l.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		l.buf = append(l.buf, rec)
+	}
+	rec := l.buf[0]
+	l.buf = l.buf[1:]
+	return rec, nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func intp(n int) *int { return &n }
+
+// readAll は openRecords で読めるレコードを全部返す
+func readAll(t *testing.T, src string, opts *ParseOptions) [][]string {
+	t.Helper()
+	rr, _, err := openRecords(strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out [][]string
+	for {
+		rec, err := rr.Read()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+}
+
+func TestDialectReader(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		opts ParseOptions
+		want [][]string
+	}{
+		{
+			name: "double quote escape and embedded newline",
+			src:  "a,b\r\n\"x \"\"y\"\"\",\"l1\r\nl2\"\r\n",
+			opts: ParseOptions{Delimiter: ","},
+			want: [][]string{{"a", "b"}, {`x "y"`, "l1\nl2"}},
+		},
+		{
+			name: "single quote with backslash escape",
+			src:  "a;b\n'it\\'s';'c\\\\d'\n",
+			opts: ParseOptions{Delimiter: ";", Quote: "'", Escape: "backslash"},
+			want: [][]string{{"a", "b"}, {"it's", `c\d`}},
+		},
+		{
+			name: "no quoting keeps quote characters",
+			src:  "\"a\"|b\n",
+			opts: ParseOptions{Delimiter: "|", Quote: "none"},
+			want: [][]string{{`"a"`, "b"}},
+		},
+		{
+			name: "skip top, comments, skip bottom, trim",
+			src:  "売上レポート\n出力日 2025-01-01\n# comment\nname , qty\n apple , 3 \n\n合計,3\n",
+			opts: ParseOptions{Delimiter: ",", SkipTop: 2, SkipBottom: 1, CommentPrefix: "#", Trim: "both"},
+			want: [][]string{{"name", "qty"}, {"apple", "3"}},
+		},
+		{
+			name: "header row drops preceding records",
+			src:  "x,x\ny,y\nid,name\n1,a\n",
+			opts: ParseOptions{Delimiter: ",", HeaderRow: intp(2)},
+			want: [][]string{{"id", "name"}, {"1", "a"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.opts.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, c.src, &c.opts); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDialectReaderUnterminatedQuote(t *testing.T) {
+	rr, _, err := openRecords(strings.NewReader("a,\"b\n"), &ParseOptions{Delimiter: ","})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.Read(); err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestBuildPreviewWithOptions(t *testing.T) {
+	src, err := japanese.ShiftJIS.NewEncoder().String("氏名\tメール\n山田\tyamada@example.com\n佐藤\tsato@example.com\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pv, err := buildPreviewWith(strings.NewReader(src), &ParseOptions{Encoding: "shift_jis", HeaderRow: intp(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.Delimiter != "\t" || !pv.HasHeader || pv.RowCount != 2 {
+		t.Fatalf("preview = %+v", pv)
+	}
+	if !reflect.DeepEqual(pv.Headers, []string{"氏名", "メール"}) || pv.SampleRows[0][0] != "山田" {
+		t.Fatalf("headers = %q rows = %q", pv.Headers, pv.SampleRows)
+	}
+
+	// ヘッダなしを明示すると 1 行目もデータ
+	pv, err = buildPreviewWith(strings.NewReader(src), &ParseOptions{Encoding: "shift_jis", HeaderRow: intp(-1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.HasHeader || pv.RowCount != 3 || pv.Headers[0] != "col_1" {
+		t.Fatalf("preview = %+v", pv)
+	}
+}
+
+func TestParseOptionsValidate(t *testing.T) {
+	bad := []ParseOptions{
+		{Delimiter: ",,"},
+		{Delimiter: "\n"},
+		{Quote: "''"},
+		{Delimiter: ";", Quote: ";"},
+		{Escape: "html"},
+		{Encoding: "klingon"},
+		{HeaderRow: intp(-2)},
+		{SkipTop: -1},
+		{SkipBottom: maxParseSkip + 1},
+		{Trim: "middle"},
+	}
+	for _, o := range bad {
+		if err := o.validate(); err == nil {
+			t.Errorf("%+v should be rejected", o)
+		}
+	}
+	ok := []ParseOptions{{}, {Delimiter: "\t", Quote: "none", Encoding: "EUC-JP", Trim: "right"}, {Encoding: "utf-16le", HeaderRow: intp(-1)}}
+	for _, o := range ok {
+		if err := o.validate(); err != nil {
+			t.Errorf("%+v: %v", o, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// api/internal/handlers/policy.go
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Role はワークスペース内のユーザロール（viewer < editor < admin）
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Valid は既知のロールかどうか
+func (r Role) Valid() bool { return r.rank() > 0 }
+
+// AtLeast は r が min 以上の権限を持つか
+func (r Role) AtLeast(min Role) bool { return r.Valid() && r.rank() >= min.rank() }
+
+// Action は認可の単位。ルートはすべていずれかの Action に対応づける
+type Action string
+
+const (
+	ActionImportUpload    Action = "imports.upload"
+	ActionImportRead      Action = "imports.read"
+	ActionMappingApply    Action = "mappings.apply"
+	ActionMappingRead     Action = "mappings.read"
+	ActionMappingSave     Action = "mappings.save"
+	ActionMappingFeedback Action = "mappings.feedback"
+	ActionMappingSuggest  Action = "mappings.suggest"
+	ActionAliasRead       Action = "aliases.read"
+	ActionAliasWrite      Action = "aliases.write"
+	ActionImportRun       Action = "imports.run"
+	ActionImportCommit    Action = "imports.commit"
+	ActionJobRead         Action = "jobs.read"
+	ActionTemplateRead    Action = "templates.read"
+	ActionTemplateWrite   Action = "templates.write"
+	ActionTemplateDelete  Action = "templates.delete"
+	ActionMembersManage   Action = "members.manage"
+	ActionKeysManage      Action = "keys.manage"
+	ActionAuditRead       Action = "audit.read"
+	ActionWebhooksManage  Action = "webhooks.manage"
+	ActionWorkspaceCreate Action = "workspaces.create"
+)
+
+// actionRule は「ユーザなら最低ロール」「API キーなら必要スコープ」
+type actionRule struct {
+	MinRole Role
+	Scope   string
+	// ブートストラップキー専用（ワークスペース横断の操作）
+	BootstrapOnly bool
+}
+
+// policy はロール/スコープの唯一の定義。ハンドラ側で個別に権限判定しないこと
+var policy = map[Action]actionRule{
+	ActionImportUpload:    {MinRole: RoleEditor, Scope: ScopeImportsWrite},
+	ActionImportRead:      {MinRole: RoleViewer, Scope: ScopeImportsWrite},
+	ActionMappingApply:    {MinRole: RoleViewer, Scope: ScopeImportsWrite},
+	ActionMappingRead:     {MinRole: RoleViewer, Scope: ScopeImportsWrite},
+	ActionMappingSave:     {MinRole: RoleEditor, Scope: ScopeImportsWrite},
+	ActionMappingFeedback: {MinRole: RoleAdmin, Scope: ScopeFeedbackRead},
+	ActionMappingSuggest:  {MinRole: RoleViewer, Scope: ScopeImportsWrite},
+	ActionAliasRead:       {MinRole: RoleViewer, Scope: ScopeTemplatesRead},
+	ActionAliasWrite:      {MinRole: RoleEditor, Scope: ScopeTemplatesWrite},
+	ActionImportRun:       {MinRole: RoleEditor, Scope: ScopeImportsWrite},
+	ActionImportCommit:    {MinRole: RoleAdmin, Scope: ScopeImportsCommit},
+	ActionJobRead:         {MinRole: RoleViewer, Scope: ScopeImportsWrite},
+	ActionTemplateRead:    {MinRole: RoleViewer, Scope: ScopeTemplatesRead},
+	ActionTemplateWrite:   {MinRole: RoleEditor, Scope: ScopeTemplatesWrite},
+	ActionTemplateDelete:  {MinRole: RoleAdmin, Scope: ScopeTemplatesWrite},
+	ActionMembersManage:   {MinRole: RoleAdmin, Scope: ScopeKeysAdmin},
+	ActionKeysManage:      {MinRole: RoleAdmin, Scope: ScopeKeysAdmin},
+	ActionAuditRead:       {MinRole: RoleAdmin, Scope: ScopeAuditRead},
+	ActionWebhooksManage:  {MinRole: RoleAdmin, Scope: ScopeWebhooksAdmin},
+	ActionWorkspaceCreate: {BootstrapOnly: true},
+}
+
+// Denial は拒否理由（403 のレスポンスボディ）
+type Denial struct {
+	Error    string `json:"error"`  // 常に "forbidden"
+	Reason   string `json:"reason"` // missing_scope / insufficient_role / not_a_member / bootstrap_only / unauthenticated / unknown_action
+	Action   Action `json:"action"`
+	Required string `json:"required,omitempty"` // 必要なロール or スコープ
+	Role     Role   `json:"role,omitempty"`     // 呼び出し元のロール（ユーザのみ）
+}
+
+// Authorize は p が a を実行できるか判定する（許可なら nil）
+func Authorize(p *Principal, a Action) *Denial {
+	if p == nil {
+		return &Denial{Error: "forbidden", Reason: "unauthenticated", Action: a}
+	}
+	rule, ok := policy[a]
+	if !ok {
+		return &Denial{Error: "forbidden", Reason: "unknown_action", Action: a}
+	}
+	if rule.BootstrapOnly {
+		if !p.Bootstrap {
+			return &Denial{Error: "forbidden", Reason: "bootstrap_only", Action: a}
+		}
+		return nil
+	}
+
+	// API キーはスコープで判定
+	if p.UserID == "" {
+		if !p.HasScope(rule.Scope) {
+			return &Denial{Error: "forbidden", Reason: "missing_scope", Action: a, Required: rule.Scope}
+		}
+		return nil
+	}
+
+	// ユーザはワークスペース内ロールで判定
+	if !p.Role.Valid() {
+		return &Denial{Error: "forbidden", Reason: "not_a_member", Action: a, Required: string(rule.MinRole)}
+	}
+	if !p.Role.AtLeast(rule.MinRole) {
+		return &Denial{Error: "forbidden", Reason: "insufficient_role", Action: a, Required: string(rule.MinRole), Role: p.Role}
+	}
+	return nil
+}
+
+// Require はルートに Action を対応づけるミドルウェア（認証ミドルウェアの後に置く）
+func Require(a Action) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := PrincipalFrom(r.Context())
+			if p == nil {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			if d := Authorize(p, a); d != nil {
+				writeDenial(w, d)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeDenial(w http.ResponseWriter, d *Denial) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(d)
+}
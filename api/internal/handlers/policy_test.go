@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ルート × ロールの認可マトリクス（API.Routes が登録する実際のルートを表と突き合わせる）
+func TestPolicyMatrix(t *testing.T) {
+	const (
+		v = RoleViewer
+		e = RoleEditor
+		a = RoleAdmin
+	)
+	routes := []struct {
+		method, path string
+		action       Action
+		allowed      []Role
+	}{
+		{"POST", "/api/imports", ActionImportUpload, []Role{e, a}},
+		{"POST", "/api/mappings/apply", ActionMappingApply, []Role{v, e, a}},
+		{"GET", "/api/imports/{id}/mappings", ActionMappingRead, []Role{v, e, a}},
+		{"PUT", "/api/imports/{id}/mappings", ActionMappingSave, []Role{e, a}},
+		{"GET", "/api/mappings/feedback", ActionMappingFeedback, []Role{a}},
+		{"POST", "/api/mappings/suggest", ActionMappingSuggest, []Role{v, e, a}},
+		{"POST", "/api/uploads", ActionImportUpload, []Role{e, a}},
+		{"GET", "/api/uploads/{id}", ActionImportUpload, []Role{e, a}},
+		{"HEAD", "/api/uploads/{id}", ActionImportUpload, []Role{e, a}},
+		{"PATCH", "/api/uploads/{id}", ActionImportUpload, []Role{e, a}},
+		{"POST", "/api/uploads/{id}/complete", ActionImportUpload, []Role{e, a}},
+		{"DELETE", "/api/uploads/{id}", ActionImportUpload, []Role{e, a}},
+		{"POST", "/api/imports/{id}/parse", ActionImportRun, []Role{e, a}},
+		{"POST", "/api/imports/{id}/reparse", ActionImportRun, []Role{e, a}},
+		{"POST", "/api/imports/{id}/apply", ActionImportRun, []Role{e, a}},
+		{"POST", "/api/imports/{id}/validate", ActionImportRun, []Role{e, a}},
+		{"POST", "/api/imports/{id}/commit", ActionImportCommit, []Role{a}},
+		{"POST", "/api/imports/{id}/rollback", ActionImportCommit, []Role{a}},
+		{"GET", "/api/imports/{id}/original", ActionImportRead, []Role{v, e, a}},
+		{"GET", "/api/imports/{id}/jobs", ActionJobRead, []Role{v, e, a}},
+		{"GET", "/api/imports/{id}/events", ActionJobRead, []Role{v, e, a}},
+		{"GET", "/api/jobs/{id}", ActionJobRead, []Role{v, e, a}},
+		{"POST", "/api/jobs/{id}/cancel", ActionImportRun, []Role{e, a}},
+		{"GET", "/api/aliases", ActionAliasRead, []Role{v, e, a}},
+		{"POST", "/api/aliases", ActionAliasWrite, []Role{e, a}},
+		{"PUT", "/api/aliases/{id}", ActionAliasWrite, []Role{e, a}},
+		{"DELETE", "/api/aliases/{id}", ActionAliasWrite, []Role{e, a}},
+		{"GET", "/api/templates", ActionTemplateRead, []Role{v, e, a}},
+		{"GET", "/api/templates/{id}", ActionTemplateRead, []Role{v, e, a}},
+		{"POST", "/api/templates", ActionTemplateWrite, []Role{e, a}},
+		{"PUT", "/api/templates/{id}", ActionTemplateWrite, []Role{e, a}},
+		{"DELETE", "/api/templates/{id}", ActionTemplateDelete, []Role{a}},
+		{"POST", "/api/templates/{id}/restore", ActionTemplateDelete, []Role{a}},
+		{"GET", "/api/members", ActionMembersManage, []Role{a}},
+		{"PUT", "/api/members/{userID}", ActionMembersManage, []Role{a}},
+		{"DELETE", "/api/members/{userID}", ActionMembersManage, []Role{a}},
+		{"POST", "/api/keys", ActionKeysManage, []Role{a}},
+		{"GET", "/api/keys", ActionKeysManage, []Role{a}},
+		{"DELETE", "/api/keys/{id}", ActionKeysManage, []Role{a}},
+		{"GET", "/api/audit", ActionAuditRead, []Role{a}},
+		{"GET", "/api/webhooks", ActionWebhooksManage, []Role{a}},
+		{"POST", "/api/webhooks", ActionWebhooksManage, []Role{a}},
+		{"GET", "/api/webhooks/{id}", ActionWebhooksManage, []Role{a}},
+		{"PUT", "/api/webhooks/{id}", ActionWebhooksManage, []Role{a}},
+		{"DELETE", "/api/webhooks/{id}", ActionWebhooksManage, []Role{a}},
+		{"GET", "/api/webhooks/{id}/deliveries", ActionWebhooksManage, []Role{a}},
+		{"POST", "/api/webhooks/{id}/deliveries/{deliveryID}/redeliver", ActionWebhooksManage, []Role{a}},
+		{"POST", "/api/webhooks/{id}/ping", ActionWebhooksManage, []Role{a}},
+		{"POST", "/api/workspaces", ActionWorkspaceCreate, nil},
+	}
+
+	// main.go と同じ Routes で組み立て、各ルートのミドルウェア（Require）だけを取り出す
+	// ハンドラ本体は呼ばない（store なしで作る）
+	api := &API{
+		Imports: NewImportHandler(nil), Mappings: NewMappingHandler(nil), Aliases: NewAliasHandler(nil),
+		Templates: NewTemplateHandler(nil), Members: NewMemberHandler(nil), Keys: NewAPIKeyHandler(nil),
+		Audit: NewAuditHandler(nil), Webhooks: NewWebhookHandler(nil), Workspaces: NewWorkspaceHandler(nil),
+	}
+	root := chi.NewRouter()
+	root.Route("/api", api.Routes)
+	registered := map[string][]func(http.Handler) http.Handler{}
+	err := chi.Walk(root, func(method, route string, _ http.Handler, mws ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = mws
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != len(routes) {
+		t.Fatalf("routes: %d registered, %d in table", len(registered), len(routes))
+	}
+
+	for _, rt := range routes {
+		mws, ok := registered[rt.method+" "+rt.path]
+		if !ok {
+			t.Fatalf("%s %s is not registered", rt.method, rt.path)
+		}
+		for _, role := range []Role{v, e, a, ""} {
+			p := &Principal{UserID: "u1", Role: role, WorkspaceID: "ws-1"}
+			h := chi.Chain(mws...).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			req := httptest.NewRequest(rt.method, rt.path, nil)
+			req = req.WithContext(withPrincipal(req.Context(), p))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			want := http.StatusForbidden
+			for _, ok := range rt.allowed {
+				if ok == role {
+					want = http.StatusOK
+				}
+			}
+			if w.Code != want {
+				t.Fatalf("%s %s as %q: got %d, want %d", rt.method, rt.path, role, w.Code, want)
+			}
+			if want == http.StatusForbidden {
+				var d Denial
+				if err := json.NewDecoder(w.Body).Decode(&d); err != nil || d.Reason == "" || d.Action != rt.action {
+					t.Fatalf("%s %s as %q: bad denial body: %+v (%v)", rt.method, rt.path, role, d, err)
+				}
+			}
+		}
+	}
+}
+
+func TestAuthorizeReasons(t *testing.T) {
+	cases := []struct {
+		p      *Principal
+		action Action
+		reason string
+	}{
+		{&Principal{UserID: "u1", Role: RoleViewer}, ActionTemplateDelete, "insufficient_role"},
+		{&Principal{UserID: "u1", Role: RoleViewer}, ActionImportUpload, "insufficient_role"},
+		{&Principal{UserID: "u1"}, ActionTemplateRead, "not_a_member"},
+		{&Principal{KeyID: "k1", Scopes: []string{ScopeTemplatesRead}}, ActionTemplateWrite, "missing_scope"},
+		{&Principal{KeyID: "k1", Scopes: AllScopes}, ActionWorkspaceCreate, "bootstrap_only"},
+		{&Principal{Bootstrap: true, Scopes: AllScopes}, ActionWorkspaceCreate, ""},
+		{&Principal{KeyID: "k1", Scopes: []string{ScopeImportsCommit}}, ActionImportCommit, ""},
+	}
+	for _, c := range cases {
+		d := Authorize(c.p, c.action)
+		got := ""
+		if d != nil {
+			got = d.Reason
+		}
+		if got != c.reason {
+			t.Fatalf("%+v %s: got %q, want %q", c.p, c.action, got, c.reason)
+		}
+	}
+}
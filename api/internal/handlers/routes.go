@@ -0,0 +1,96 @@
+// api/internal/handlers/routes.go
+package handlers
+
+import (
+	"github.com/go-chi/chi/v5"
+)
+
+// API は /api 配下のハンドラ一式
+type API struct {
+	Imports    *ImportHandler
+	Mappings   *MappingHandler
+	Aliases    *AliasHandler
+	Templates  *TemplateHandler
+	Members    *MemberHandler
+	Keys       *APIKeyHandler
+	Audit      *AuditHandler
+	Webhooks   *WebhookHandler
+	Workspaces *WorkspaceHandler
+}
+
+// Routes は /api 配下のルートを r に登録する（認証のミドルウェアは呼び出し側で先に付ける）
+func (a *API) Routes(r chi.Router) {
+	// 認可はすべて Require(Action) → handlers/policy.go の表で判定する
+	can := Require
+
+	// アップロード→プレビュー
+	r.With(can(ActionImportUpload)).Post("/imports", a.Imports.UploadPreview)
+
+	// 再開可能アップロード（大きなファイル・不安定な回線向け。complete で /imports と同じ処理になる）
+	r.With(can(ActionImportUpload)).Post("/uploads", a.Imports.CreateUpload)
+	r.With(can(ActionImportUpload)).Get("/uploads/{id}", a.Imports.GetUpload)
+	r.With(can(ActionImportUpload)).Head("/uploads/{id}", a.Imports.GetUpload)
+	r.With(can(ActionImportUpload)).Patch("/uploads/{id}", a.Imports.PatchUpload)
+	r.With(can(ActionImportUpload)).Post("/uploads/{id}/complete", a.Imports.CompleteUpload)
+	r.With(can(ActionImportUpload)).Delete("/uploads/{id}", a.Imports.AbortUpload)
+
+	// 取り込みジョブ（非同期。202 + ジョブを返し、GET /jobs/{id} で進捗を見る）
+	r.With(can(ActionImportRun)).Post("/imports/{id}/parse", a.Imports.EnqueueJob(JobParse))
+	r.With(can(ActionImportRun)).Post("/imports/{id}/reparse", a.Imports.Reparse) // 読み取り設定を明示して読み直す
+	r.With(can(ActionImportRun)).Post("/imports/{id}/apply", a.Imports.EnqueueJob(JobApply))
+	r.With(can(ActionImportRun)).Post("/imports/{id}/validate", a.Imports.EnqueueJob(JobValidate))
+	r.With(can(ActionImportCommit)).Post("/imports/{id}/commit", a.Imports.EnqueueJob(JobCommit))
+	r.With(can(ActionImportCommit)).Post("/imports/{id}/rollback", a.Imports.Rollback) // 確定した行を取り消す
+	r.With(can(ActionImportRead)).Get("/imports/{id}/original", a.Imports.GetOriginal)
+	r.With(can(ActionJobRead)).Get("/imports/{id}/jobs", a.Imports.ListImportJobs)
+	r.With(can(ActionJobRead)).Get("/imports/{id}/events", a.Imports.StreamEvents) // SSE
+	r.With(can(ActionJobRead)).Get("/jobs/{id}", a.Imports.GetJob)
+	r.With(can(ActionImportRun)).Post("/jobs/{id}/cancel", a.Imports.CancelJob)
+
+	// マッピング適用（サーバ側）
+	r.With(can(ActionMappingApply)).Post("/mappings/apply", a.Mappings.ApplyMapping)
+	r.With(can(ActionMappingRead)).Get("/imports/{id}/mappings", a.Mappings.GetImportMappings)
+	r.With(can(ActionMappingSave)).Put("/imports/{id}/mappings", a.Mappings.PutImportMappings)
+	r.With(can(ActionMappingFeedback)).Get("/mappings/feedback", a.Mappings.ExportFeedback)
+	r.With(can(ActionMappingSuggest)).Post("/mappings/suggest", a.Mappings.SuggestMapping)
+
+	// 学習した別名
+	r.With(can(ActionAliasRead)).Get("/aliases", a.Aliases.ListAliases)
+	r.With(can(ActionAliasWrite)).Post("/aliases", a.Aliases.CreateAlias)
+	r.With(can(ActionAliasWrite)).Put("/aliases/{id}", a.Aliases.UpdateAlias)
+	r.With(can(ActionAliasWrite)).Delete("/aliases/{id}", a.Aliases.DeleteAlias)
+
+	// テンプレート保存/一覧
+	r.With(can(ActionTemplateWrite)).Post("/templates", a.Templates.CreateTemplate)
+	r.With(can(ActionTemplateRead)).Get("/templates", a.Templates.ListTemplates)
+	r.With(can(ActionTemplateRead)).Get("/templates/{id}", a.Templates.GetTemplateByID)
+	r.With(can(ActionTemplateWrite)).Put("/templates/{id}", a.Templates.UpdateTemplate)
+	r.With(can(ActionTemplateDelete)).Delete("/templates/{id}", a.Templates.DeleteTemplate)
+	r.With(can(ActionTemplateDelete)).Post("/templates/{id}/restore", a.Templates.RestoreTemplate)
+
+	// メンバー（ワークスペース内ロール）
+	r.With(can(ActionMembersManage)).Get("/members", a.Members.ListMembers)
+	r.With(can(ActionMembersManage)).Put("/members/{userID}", a.Members.PutMember)
+	r.With(can(ActionMembersManage)).Delete("/members/{userID}", a.Members.DeleteMember)
+
+	// API キー管理
+	r.With(can(ActionKeysManage)).Post("/keys", a.Keys.CreateKey)
+	r.With(can(ActionKeysManage)).Get("/keys", a.Keys.ListKeys)
+	r.With(can(ActionKeysManage)).Delete("/keys/{id}", a.Keys.RevokeKey)
+
+	// 監査ログ
+	r.With(can(ActionAuditRead)).Get("/audit", a.Audit.ListAudit)
+
+	// Webhook（取り込みの検証・確定・失敗を外部に通知）
+	r.With(can(ActionWebhooksManage)).Get("/webhooks", a.Webhooks.ListWebhooks)
+	r.With(can(ActionWebhooksManage)).Post("/webhooks", a.Webhooks.CreateWebhook)
+	r.With(can(ActionWebhooksManage)).Get("/webhooks/{id}", a.Webhooks.GetWebhook)
+	r.With(can(ActionWebhooksManage)).Put("/webhooks/{id}", a.Webhooks.UpdateWebhook)
+	r.With(can(ActionWebhooksManage)).Delete("/webhooks/{id}", a.Webhooks.DeleteWebhook)
+	r.With(can(ActionWebhooksManage)).Get("/webhooks/{id}/deliveries", a.Webhooks.ListDeliveries)
+	r.With(can(ActionWebhooksManage)).Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", a.Webhooks.Redeliver)
+	r.With(can(ActionWebhooksManage)).Post("/webhooks/{id}/ping", a.Webhooks.PingWebhook)
+
+	// ワークスペース（テナント）作成
+	r.With(can(ActionWorkspaceCreate)).Post("/workspaces", a.Workspaces.CreateWorkspace)
+}
@@ -0,0 +1,229 @@
+// api/internal/handlers/rules.go
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RuleSource はマッピング先 1 項目の取り出し元（どれか 1 つだけ入る。列の探し方は resolveColumn）
+type RuleSource struct {
+	Column     string // ソース列名（ヘッダ名。正規化したキーでも元の表記でもよい）
+	Original   string // {"original": ...} ファイルに書かれていた表記
+	Normalized string // {"normalized": ...} 正規化したキー
+	Index      int    // {"index": ...} 列番号（1 始まり。ヘッダの無いファイルはこれで指す）
+	Pattern    string // {"pattern": ...} ヘッダ（元の表記か正規化したキー）に当てる正規表現。最初に当たった列
+
+	re *regexp.Regexp // Pattern をコンパイルしたもの
+}
+
+// ruleSourceObject はオブジェクトで書いたルールの形
+type ruleSourceObject struct {
+	Original   string `json:"original,omitempty"`
+	Normalized string `json:"normalized,omitempty"`
+	Index      int    `json:"index,omitempty"`
+	Pattern    string `json:"pattern,omitempty"`
+}
+
+// MarshalJSON は列名だけなら従来どおり文字列、それ以外はオブジェクトにする
+func (s RuleSource) MarshalJSON() ([]byte, error) {
+	if s.Column != "" {
+		return json.Marshal(s.Column)
+	}
+	return json.Marshal(ruleSourceObject{Original: s.Original, Normalized: s.Normalized, Index: s.Index, Pattern: s.Pattern})
+}
+
+// RuleSet は dest -> source のマッピング（nil は「未マッピング」）
+// CreateTemplate / ApplyMapping の両方がこの型で解釈するので、保存できたルールは必ず適用できる
+type RuleSet map[string]*RuleSource
+
+// Dests は出力スキーマ（キー順で安定化）
+func (rs RuleSet) Dests() []string {
+	out := make([]string, 0, len(rs))
+	for k := range rs {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// RuleIssue は不正なルール 1 件（path は "rules.<dest>" 形式）
+type RuleIssue struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// parseRules は rules の生 JSON を検証しながら RuleSet に変換する
+// 不正な項目は最初の 1 件で止めず、すべて issues に積んで返す
+func parseRules(raw json.RawMessage) (RuleSet, []RuleIssue) {
+	return parseRulesAt(raw, "rules")
+}
+
+// hasRules は rules / overrides が指定されたか（null は省略と同じ）
+func hasRules(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && !bytes.Equal(raw, []byte("null"))
+}
+
+// parseRulesAt は issues の path を root 起点にする版（overrides など rules 以外の入力用）
+func parseRulesAt(raw json.RawMessage, root string) (RuleSet, []RuleIssue) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, []RuleIssue{{Path: root, Reason: "is required"}}
+	}
+	if raw[0] != '{' {
+		return nil, []RuleIssue{{Path: root, Reason: "must be an object of destination -> source column"}}
+	}
+
+	// キー順と重複を見たいので map ではなくトークンで読む
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil { // '{'
+		return nil, []RuleIssue{{Path: root, Reason: "invalid JSON"}}
+	}
+
+	rs := RuleSet{}
+	var issues []RuleIssue
+	seen := map[string]bool{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, append(issues, RuleIssue{Path: root, Reason: "invalid JSON"})
+		}
+		dest, _ := tok.(string)
+		path := root + "." + dest
+
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, append(issues, RuleIssue{Path: path, Reason: "invalid JSON"})
+		}
+
+		if strings.TrimSpace(dest) == "" {
+			issues = append(issues, RuleIssue{Path: path, Reason: "destination name must not be empty"})
+			continue
+		}
+		if seen[dest] {
+			issues = append(issues, RuleIssue{Path: path, Reason: "duplicate destination"})
+			continue
+		}
+		seen[dest] = true
+
+		src, reason := parseRuleSource(v)
+		if reason != "" {
+			issues = append(issues, RuleIssue{Path: path, Reason: reason})
+			continue
+		}
+		rs[dest] = src
+	}
+	if len(issues) > 0 {
+		return nil, issues
+	}
+	return rs, nil
+}
+
+// Patch は overrides で dest 単位に上書きした新しい RuleSet を返す（元は変更しない）
+func (rs RuleSet) Patch(overrides RuleSet) RuleSet {
+	out := make(RuleSet, len(rs)+len(overrides))
+	for k, v := range rs {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
+
+// parseRuleSource は 1 項目分の値を解釈する（不正なら理由を返す）
+func parseRuleSource(v json.RawMessage) (*RuleSource, string) {
+	switch jsonKind(v) {
+	case "null":
+		return nil, ""
+	case "string":
+		var col string
+		if err := json.Unmarshal(v, &col); err != nil {
+			return nil, "invalid string"
+		}
+		if strings.TrimSpace(col) == "" {
+			return nil, "source column must not be empty (use null to leave unmapped)"
+		}
+		return &RuleSource{Column: col}, ""
+	case "object":
+		return parseRuleSourceObject(v)
+	default:
+		return nil, fmt.Sprintf("must be a source column name (string), an object (original / normalized / index / pattern) or null, got %s", jsonKind(v))
+	}
+}
+
+// parseRuleSourceObject は {"original": "Unit Price (JPY)"} / {"normalized": "unit_price"} / {"index": 3} / {"pattern": "(?i)price"} を解釈する
+func parseRuleSourceObject(v json.RawMessage) (*RuleSource, string) {
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.DisallowUnknownFields()
+	var o ruleSourceObject
+	if err := dec.Decode(&o); err != nil {
+		return nil, "object must have exactly one of original (string), normalized (string), index (integer >= 1), pattern (string)"
+	}
+	n := 0
+	for _, set := range []bool{o.Original != "", o.Normalized != "", o.Index != 0, o.Pattern != ""} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n != 1:
+		return nil, "object must have exactly one of original, normalized, index, pattern"
+	case o.Index < 0:
+		return nil, "index must be 1 or greater"
+	case o.Original != "" && strings.TrimSpace(o.Original) == "", o.Normalized != "" && strings.TrimSpace(o.Normalized) == "",
+		o.Pattern != "" && strings.TrimSpace(o.Pattern) == "":
+		return nil, "source column must not be empty (use null to leave unmapped)"
+	}
+	src := &RuleSource{Original: o.Original, Normalized: o.Normalized, Index: o.Index, Pattern: o.Pattern}
+	if o.Pattern != "" {
+		re, err := regexp.Compile(o.Pattern)
+		if err != nil {
+			return nil, "invalid pattern: " + err.Error()
+		}
+		// 空文字に当たる（".*" など）とどの列にも当たり、黙って先頭の列を使ってしまう
+		if re.MatchString("") {
+			return nil, "pattern must not match an empty header (it would match every column)"
+		}
+		src.re = re
+	}
+	return src, ""
+}
+
+// jsonKind は JSON 値の種類名を返す（エラーメッセージ用）
+func jsonKind(v json.RawMessage) string {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return "empty"
+	}
+	switch v[0] {
+	case 'n':
+		return "null"
+	case 't', 'f':
+		return "boolean"
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	default:
+		return "number"
+	}
+}
+
+// writeRuleIssues は 422 で不正ルールの一覧を返す
+func writeRuleIssues(w http.ResponseWriter, issues []RuleIssue) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "invalid_rules",
+		"issues": issues,
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestParseRules(t *testing.T) {
+	rs, issues := parseRules(json.RawMessage(`{"order_id":"Order ID","memo":null}`))
+	if len(issues) > 0 {
+		t.Fatalf("unexpected issues: %+v", issues)
+	}
+	if rs["order_id"] == nil || rs["order_id"].Column != "Order ID" || rs["memo"] != nil {
+		t.Fatalf("unexpected rules: %+v", rs)
+	}
+
+	// 不正な項目はすべて列挙される
+	_, issues = parseRules(json.RawMessage(`{"a":1,"b":{"x":"y"},"c":"","d":"ok","a":"dup"}`))
+	got := map[string]bool{}
+	for _, is := range issues {
+		got[is.Path] = true
+	}
+	for _, p := range []string{"rules.a", "rules.b", "rules.c"} {
+		if !got[p] {
+			t.Fatalf("expected issue for %s, got %+v", p, issues)
+		}
+	}
+	if got["rules.d"] {
+		t.Fatalf("rules.d should be valid: %+v", issues)
+	}
+
+	for _, raw := range []string{`null`, `[]`, `"x"`} {
+		if _, issues := parseRules(json.RawMessage(raw)); len(issues) != 1 || issues[0].Path != "rules" {
+			t.Fatalf("%s: expected a single top-level issue, got %+v", raw, issues)
+		}
+	}
+}
+
+func TestApplyMappingRejectsInvalidRules(t *testing.T) {
+	body := `{"headers":["A"],"rows":[["1"]],"rules":{"x":42}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/mappings/apply", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	(&MappingHandler{}).ApplyMapping(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want 422", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"rules.x"`) {
+		t.Fatalf("missing issue path: %s", w.Body.String())
+	}
+}
+
+func TestValidateTemplatePositional(t *testing.T) {
+	cases := []struct {
+		body string
+		ok   bool
+		path string
+	}{
+		{`{"name":"n","schema_key":"s","positional":true,"column_count":3,"rules":{"a":{"index":1},"b":null}}`, true, ""},
+		{`{"name":"n","schema_key":"s","positional":true,"rules":{"a":{"index":1}}}`, false, "column_count"},
+		{`{"name":"n","schema_key":"s","column_count":3,"rules":{"a":"A"}}`, false, "column_count"},
+		{`{"name":"n","schema_key":"s","positional":true,"column_count":3,"rules":{"a":"col_1"}}`, false, "rules.a"},
+		{`{"name":"n","schema_key":"s","positional":true,"column_count":3,"rules":{"a":{"index":4}}}`, false, "rules.a"},
+	}
+	for _, c := range cases {
+		var in TemplateCreateReq
+		if err := json.Unmarshal([]byte(c.body), &in); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		_, ok := validateTemplateReq(w, &in)
+		if ok != c.ok {
+			t.Errorf("%s: ok = %v (%d %s)", c.body, ok, w.Code, w.Body.String())
+			continue
+		}
+		if !ok && (w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"`+c.path+`"`)) {
+			t.Errorf("%s: %d %s", c.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHasRules(t *testing.T) {
+	for raw, want := range map[string]bool{``: false, `null`: false, ` null `: false, `{}`: true, `{"a":"A"}`: true} {
+		if got := hasRules(json.RawMessage(raw)); got != want {
+			t.Errorf("hasRules(%q) = %v, want %v", raw, got, want)
+		}
+	}
+
+	// templateId と rules の両方は 400（rules: null の場合は TestApplyMappingNullRulesWithTemplate）
+	body := `{"headers":["A"],"rows":[["1"]],"templateId":"t","rules":{"x":"A"}}`
+	w := httptest.NewRecorder()
+	(&MappingHandler{}).ApplyMapping(w, httptest.NewRequest(http.MethodPost, "/api/mappings/apply", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", w.Code)
+	}
+}
+
+// rules: null は省略と同じ扱いなので、templateId と一緒に送ってもテンプレートで適用される
+func TestApplyMappingNullRulesWithTemplate(t *testing.T) {
+	st, ws := testWorkspace(t, "apply-null-rules")
+	ctx := context.Background()
+	var id string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `insert into public.mapping_templates (name, schema_key, rules) values ('orders', 'orders_v1', '{"order_id":"Order ID"}') returning id`).Scan(&id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"headers":["Order ID"],"rows":[["1"]],"templateId":"` + id + `","rules":null}`
+	w := httptest.NewRecorder()
+	(&MappingHandler{Store: st}).ApplyMapping(w, uploadRequester(ws)(httptest.NewRequest(http.MethodPost, "/api/mappings/apply", strings.NewReader(body)), ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+}
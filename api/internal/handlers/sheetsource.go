@@ -0,0 +1,46 @@
+// api/internal/handlers/sheetsource.go
+package handlers
+
+import (
+	"fmt"
+	"io"
+
+	"csv-import-kit/api/internal/spreadsheet"
+)
+
+// 表計算ファイルは全体を読んでから開く（zip / CFB は先頭から流して読めない）
+const maxSpreadsheetBytes = 100 << 20
+
+// readSpreadsheet は .ods / .xls の指定シートを行の配列にする（空行は除く）
+func readSpreadsheet(src io.Reader, opts *ParseOptions) ([][]string, error) {
+	b, err := io.ReadAll(io.LimitReader(src, maxSpreadsheetBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxSpreadsheetBytes {
+		return nil, fmt.Errorf("spreadsheet is larger than %d MB", maxSpreadsheetBytes>>20)
+	}
+	so := spreadsheet.Options{Sheet: opts.Sheet}
+	if opts.Format == "xls" {
+		return spreadsheet.ReadXLS(b, so)
+	}
+	return spreadsheet.ReadODS(b, so)
+}
+
+// rowsReader は読み終えた行を 1 件ずつ返す
+type rowsReader struct {
+	rows [][]string
+	trim string
+}
+
+func (r *rowsReader) Read() ([]string, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	rec := r.rows[0]
+	r.rows = r.rows[1:]
+	for i, v := range rec {
+		rec[i] = trimValue(v, r.trim)
+	}
+	return rec, nil
+}
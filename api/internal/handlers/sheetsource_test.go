@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"csv-import-kit/api/internal/spreadsheet"
+)
+
+func TestBuildPreviewODS(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	_, _ = w.Write([]byte(spreadsheet.ODSMimeType))
+	w, _ = zw.Create("content.xml")
+	cell := func(v string) string {
+		return `<table:table-cell office:value-type="string"><text:p>` + v + `</text:p></table:table-cell>`
+	}
+	num := func(v string) string {
+		return `<table:table-cell office:value-type="float" office:value="` + v + `"><text:p>` + v + `</text:p></table:table-cell>`
+	}
+	row := func(cells ...string) string {
+		out := "<table:table-row>"
+		for _, c := range cells {
+			out += c
+		}
+		return out + "</table:table-row>"
+	}
+	_, _ = w.Write([]byte(`<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:spreadsheet>` +
+		`<table:table table:name="表紙">` + row(cell("cover")) + `</table:table>` +
+		`<table:table table:name="明細">` +
+		row(cell("2024年1月 売上明細")) +
+		row(cell("商品名"), cell("数量")) +
+		row(cell(" りんご "), num("3")) +
+		row(cell("みかん"), num("12")) +
+		row(cell("合計"), num("15")) +
+		`</table:table></office:spreadsheet></office:body></office:document-content>`))
+	_ = zw.Close()
+
+	opts := formatFromUpload("sales.ods", "")
+	opts.Sheet = "明細"
+	opts.SkipTop = 1
+	opts.SkipBottom = 1
+	opts.Trim = "both"
+	opts.HeaderRow = intp(0)
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	pv, err := buildPreviewWith(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.Format != "ods" || !pv.HasHeader || pv.RowCount != 2 {
+		t.Fatalf("preview = %+v", pv)
+	}
+	if !reflect.DeepEqual(pv.SampleRows, [][]string{{"りんご", "3"}, {"みかん", "12"}}) {
+		t.Fatalf("rows = %q", pv.SampleRows)
+	}
+
+	if err := (&ParseOptions{Sheet: "明細"}).validate(); err == nil {
+		t.Fatal("sheet without ods/xls should be rejected")
+	}
+	if o := formatFromUpload("legacy.csv", "application/vnd.ms-excel"); o != nil {
+		t.Fatalf("csv with the Excel content type = %+v", o)
+	}
+}
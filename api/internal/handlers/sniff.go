@@ -0,0 +1,158 @@
+// api/internal/handlers/sniff.go
+package handlers
+
+import (
+	"bytes"
+	"math"
+)
+
+// 区切り文字の推定に使う先頭部分
+const (
+	sniffBytes = 16 << 10
+	sniffLines = 50
+)
+
+// sniffCandidates は区切り文字の候補。並びは同点のときの優先順
+// 空白はよくある値（氏名・文章）にも含まれるので、他の候補が全部外れたときだけ採る
+var sniffCandidates = []struct {
+	c      byte
+	weight float64
+}{
+	{',', 1}, {'\t', 1}, {';', 1}, {'|', 1},
+	{':', 0.9}, {'^', 0.9}, {'~', 0.9},
+	{' ', 0.8},
+}
+
+// delimiterGuess は区切り文字の推定結果
+type delimiterGuess struct {
+	Delimiter  string
+	Confidence float64       // 0〜1。区切り文字を明示したときは 1
+	Columns    []FixedColumn // 固定長のときの列（Delimiter は空）
+}
+
+// sniffDelimiter は先頭の数十行を候補ごとに（囲みを考慮して）区切り、
+// 列数がそろっているほど・列数が多いほど・ばらつきが小さいほど高く採点する（Python の csv.Sniffer の考え方）
+// 空白区切りは連続した空白を 1 つとみなす（桁そろえのテキスト）
+func sniffDelimiter(b []byte) delimiterGuess {
+	sample := sniffSample(b)
+
+	best := delimiterGuess{Delimiter: ",", Confidence: 0}
+	bestScore, secondScore := 0.0, 0.0
+	bestConsistency := 0.0
+	for _, cand := range sniffCandidates {
+		if cand.c == ' ' && bestScore > 0 {
+			break
+		}
+		counts := fieldCounts(sample, cand.c)
+		score, consistency := scoreCounts(counts)
+		score *= cand.weight
+		switch {
+		case score > bestScore:
+			secondScore = bestScore
+			bestScore, bestConsistency = score, consistency
+			best.Delimiter = string(cand.c)
+		case score > secondScore:
+			secondScore = score
+		}
+	}
+	if bestScore > 0 {
+		// 2 位との差が小さいほど自信は下がる
+		margin := 1 - secondScore/bestScore
+		best.Confidence = math.Round(bestConsistency*(0.5+0.5*margin)*100) / 100
+	}
+	return best
+}
+
+// sniffSample は先頭 sniffLines 行まで（途中で切れた最終行は捨てる）
+func sniffSample(b []byte) []byte {
+	if len(b) > sniffBytes {
+		b = b[:sniffBytes]
+	}
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 && i < len(b)-1 && len(b) == sniffBytes {
+		b = b[:i+1]
+	}
+	n := 0
+	for i, c := range b {
+		if c == '\n' {
+			n++
+			if n == sniffLines {
+				return b[:i+1]
+			}
+		}
+	}
+	return b
+}
+
+// fieldCounts はレコードごとの列数（" の囲みの中の区切り文字・改行は数えない、空行は飛ばす）
+func fieldCounts(sample []byte, c byte) []int {
+	var counts []int
+	fields, inQuote, empty := 1, false, true
+	prev := byte('\n')
+	for _, ch := range sample {
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+			empty = false
+		case inQuote:
+		case ch == '\n':
+			if !empty {
+				if c == ' ' && prev == ' ' {
+					fields-- // 行末の空白
+				}
+				counts = append(counts, fields)
+			}
+			fields, empty = 1, true
+		case ch == '\r':
+			continue
+		case ch == c:
+			// 空白区切りは連続・行頭の空白を 1 つ / 0 とみなす
+			if c != ' ' || (!empty && prev != ' ') {
+				fields++
+			}
+		default:
+			empty = false
+		}
+		prev = ch
+	}
+	if !empty {
+		if c == ' ' && prev == ' ' {
+			fields--
+		}
+		counts = append(counts, fields)
+	}
+	return counts
+}
+
+// scoreCounts は列数の並びを採点する（1 列しか無ければ 0）
+// score = 最頻の列数にそろっている割合 × 列数の多さ ÷ (1 + 分散)
+func scoreCounts(counts []int) (score, consistency float64) {
+	if len(counts) == 0 {
+		return 0, 0
+	}
+	freq := map[int]int{}
+	sum := 0
+	for _, n := range counts {
+		freq[n]++
+		sum += n
+	}
+	mode, modeN := 0, 0
+	for n, f := range freq {
+		if f > modeN || (f == modeN && n > mode) {
+			mode, modeN = n, f
+		}
+	}
+	if mode < 2 {
+		return 0, 0
+	}
+	mean := float64(sum) / float64(len(counts))
+	variance := 0.0
+	for _, n := range counts {
+		d := float64(n) - mean
+		variance += d * d
+	}
+	variance /= float64(len(counts))
+
+	consistency = float64(modeN) / float64(len(counts))
+	score = consistency * float64(mode) / float64(mode+1) / (1 + variance)
+	return score, consistency
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/sniff/<name>.<区切り文字名>.<拡張子> の区切り文字を当てられるか
+var sniffNames = map[string]string{
+	"comma": ",", "tab": "\t", "semicolon": ";", "pipe": "|",
+	"colon": ":", "caret": "^", "tilde": "~", "space": " ",
+}
+
+func TestSniffDelimiterCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "sniff", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus: %v", err)
+	}
+	for _, path := range files {
+		name := filepath.Base(path)
+		parts := strings.Split(name, ".")
+		if len(parts) < 3 {
+			t.Fatalf("%s: name must be <name>.<delimiter>.<ext>", name)
+		}
+		want, ok := sniffNames[parts[len(parts)-2]]
+		if !ok {
+			t.Fatalf("%s: name must be <name>.<delimiter>.<ext>", name)
+		}
+		t.Run(name, func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := sniffDelimiter(b)
+			if got.Delimiter != want {
+				t.Fatalf("delimiter = %q (confidence %.2f), want %q", got.Delimiter, got.Confidence, want)
+			}
+			// 1 列しかないファイルは区切り文字が無いので自信 0
+			if strings.HasPrefix(name, "single_column") {
+				if got.Confidence != 0 {
+					t.Fatalf("confidence = %.2f, want 0", got.Confidence)
+				}
+			} else if got.Confidence <= 0 || got.Confidence > 1 {
+				t.Fatalf("confidence = %.2f", got.Confidence)
+			}
+		})
+	}
+}
+
+func TestSniffDelimiterDeterministic(t *testing.T) {
+	// 同点（どちらも 1 行に 1 つ）のときは候補の優先順で決まる
+	b := []byte("a,b;c\nd,e;f\n")
+	for i := 0; i < 50; i++ {
+		if got := sniffDelimiter(b).Delimiter; got != "," {
+			t.Fatalf("run %d: %q", i, got)
+		}
+	}
+}
+
+func TestSniffConfidence(t *testing.T) {
+	clear := sniffDelimiter([]byte("a;b;c\n1;2;3\n4;5;6\n"))
+	ambiguous := sniffDelimiter([]byte("a;b,c\n1;2,3\n4;5,6\n"))
+	if clear.Confidence != 1 {
+		t.Fatalf("clear = %+v", clear)
+	}
+	if ambiguous.Confidence >= clear.Confidence {
+		t.Fatalf("ambiguous %+v should be less confident than %+v", ambiguous, clear)
+	}
+}
+
+func TestFieldCountsSpaceAligned(t *testing.T) {
+	got := fieldCounts([]byte("  ID   NAME  \n1  apple\n\n"), ' ')
+	if len(got) != 2 || got[0] != 2 || got[1] != 2 {
+		t.Fatalf("counts = %v", got)
+	}
+}
+
+func TestOpenRecordsSpaceAligned(t *testing.T) {
+	got := readAll(t, "ID    NAME        QTY\n1     apple       3\n2     \"red bean\"  12\n", nil)
+	want := [][]string{{"ID", "NAME", "QTY"}, {"1", "apple", "3"}, {"2", "red bean", "12"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %q", got)
+	}
+	for i := range want {
+		if strings.Join(got[i], "|") != strings.Join(want[i], "|") {
+			t.Fatalf("row %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
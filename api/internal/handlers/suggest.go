@@ -0,0 +1,158 @@
+// api/internal/handlers/suggest.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type SuggestReq struct {
+	SchemaKey string   `json:"schemaKey"`
+	Fields    []string `json:"fields"`  // スキーマ項目（この順で返す）
+	Headers   []string `json:"headers"` // 入力ヘッダ
+}
+
+// Suggestion はスキーマ項目 1 つ分の提案
+type Suggestion struct {
+	Field      string  `json:"field"`
+	Source     *string `json:"source"` // null = 候補なし
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"` // alias / exact / partial / none
+	AliasID    string  `json:"aliasId,omitempty"`
+}
+
+type SuggestResp struct {
+	Suggestions []Suggestion       `json:"suggestions"`
+	Rules       map[string]*string `json:"rules"` // dest -> source（MappingUI の rules と同じ形）
+}
+
+// POST /api/mappings/suggest
+// 学習した別名（mapping_aliases）を先に当て、残りをヘッダ名の一致で埋める
+func (h *MappingHandler) SuggestMapping(w http.ResponseWriter, r *http.Request) {
+	var in SuggestReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(in.Fields) == 0 {
+		http.Error(w, "fields are required", http.StatusBadRequest)
+		return
+	}
+
+	var aliases []Alias
+	if in.SchemaKey != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+			var err error
+			aliases, err = listAliases(ctx, tx, in.SchemaKey, "")
+			return err
+		})
+		if err != nil {
+			http.Error(w, "db query error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	out := SuggestResp{Suggestions: suggestMapping(in.Fields, in.Headers, aliases, time.Now())}
+	out.Rules = make(map[string]*string, len(out.Suggestions))
+	for _, s := range out.Suggestions {
+		out.Rules[s.Field] = s.Source
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// suggestMapping は項目ごとに 1 列を選ぶ（1 つの列は 1 項目にしか使わない）
+//  1. 別名: スコアの高い順に割り当て（confidence = score / (score + 1)）
+//  2. 完全一致: 正規化したヘッダと項目名が同じ（0.9）
+//  3. 部分一致: ヘッダが項目名を含む（0.5）
+func suggestMapping(fields, headers []string, aliases []Alias, now time.Time) []Suggestion {
+	out := make([]Suggestion, len(fields))
+	fieldIdx := make(map[string]int, len(fields))
+	for i, f := range fields {
+		out[i] = Suggestion{Field: f, Reason: "none"}
+		fieldIdx[f] = i
+	}
+	keys := make([]string, len(headers))
+	headerIdx := map[string]int{}
+	for i, h := range headers {
+		keys[i] = aliasKey(h)
+		if _, dup := headerIdx[keys[i]]; !dup {
+			headerIdx[keys[i]] = i
+		}
+	}
+	// 以前の正規化で学習した別名（unit_price_(jpy) など）も同じ列に当てる
+	for i, h := range headers {
+		if k := legacyHeaderKey(h); k != "" {
+			if _, dup := headerIdx[k]; !dup {
+				headerIdx[k] = i
+			}
+		}
+	}
+	usedHeader := make([]bool, len(headers))
+	assign := func(fi, hi int, conf float64, reason, aliasID string) {
+		src := headers[hi]
+		out[fi] = Suggestion{Field: fields[fi], Source: &src, Confidence: conf, Reason: reason, AliasID: aliasID}
+		usedHeader[hi] = true
+	}
+
+	// 1) 別名
+	type cand struct {
+		fi, hi int
+		score  float64
+		id     string
+	}
+	var cands []cand
+	for _, a := range aliases {
+		fi, ok := fieldIdx[a.TargetField]
+		if !ok {
+			continue
+		}
+		hi, ok := headerIdx[a.Alias]
+		if !ok {
+			continue
+		}
+		if s := a.score(now); s > 0 {
+			cands = append(cands, cand{fi, hi, s, a.ID})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].score > cands[j].score })
+	for _, c := range cands {
+		if out[c.fi].Source != nil || usedHeader[c.hi] {
+			continue
+		}
+		assign(c.fi, c.hi, c.score/(c.score+1), "alias", c.id)
+	}
+
+	// 2) 完全一致 → 3) 部分一致
+	for _, pass := range []struct {
+		reason string
+		conf   float64
+		match  func(key, field string) bool
+	}{
+		{"exact", 0.9, func(k, f string) bool { return k == f }},
+		{"partial", 0.5, strings.Contains},
+	} {
+		for fi, f := range fields {
+			if out[fi].Source != nil {
+				continue
+			}
+			fk := aliasKey(f)
+			for hi, k := range keys {
+				if !usedHeader[hi] && fk != "" && pass.match(k, fk) {
+					assign(fi, hi, pass.conf, pass.reason, "")
+					break
+				}
+			}
+		}
+	}
+	return out
+}
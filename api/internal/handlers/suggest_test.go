@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuggestMapping(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-365 * 24 * time.Hour)
+
+	fields := []string{"order_id", "customer_id", "product", "unit_price"}
+	headers := []string{"Order ID", "得意先コード", "Customer Name", "Product", "Price"}
+	aliases := []Alias{
+		{ID: "a1", TargetField: "customer_id", Alias: "得意先コード", Hits: 3, Weight: 1, LastSeenAt: &recent},
+		// 古くて使われた回数の少ない別名でも名前の一致（Product）より優先する。確信度は新しい別名より低い
+		{ID: "a2", TargetField: "product", Alias: "customer_name", Hits: 1, Weight: 1, LastSeenAt: &old},
+		{ID: "a3", TargetField: "unit_price", Alias: "price", Hits: 0, Weight: 1, Manual: true, UpdatedAt: recent},
+		// weight 0 は無効
+		{ID: "a4", TargetField: "order_id", Alias: "product", Hits: 10, Weight: 0, LastSeenAt: &recent},
+	}
+
+	got := suggestMapping(fields, headers, aliases, now)
+	want := map[string]struct{ source, reason string }{
+		"order_id":    {"Order ID", "exact"},
+		"customer_id": {"得意先コード", "alias"},
+		"product":     {"Customer Name", "alias"},
+		"unit_price":  {"Price", "alias"},
+	}
+	for _, s := range got {
+		w := want[s.Field]
+		if s.Source == nil || *s.Source != w.source || s.Reason != w.reason {
+			t.Fatalf("%s: got %v/%s, want %s/%s", s.Field, s.Source, s.Reason, w.source, w.reason)
+		}
+	}
+	if got[1].Confidence <= got[2].Confidence {
+		t.Fatalf("frequent recent alias should be more confident: %v vs %v", got[1].Confidence, got[2].Confidence)
+	}
+
+	// 別名が無ければ名前の一致だけで埋める（列は 1 回しか使わない）
+	got = suggestMapping([]string{"order_id", "order"}, []string{"order-id"}, nil, now)
+	if got[0].Reason != "exact" || got[1].Source != nil {
+		t.Fatalf("unexpected: %+v", got)
+	}
+}
+
+func TestOverridePairs(t *testing.T) {
+	ms := []ImportMapping{
+		{Source: "得意先 コード", Target: strp("customer_id"), IsOverride: true},
+		{Source: "Order ID", Target: strp("order_id")},
+		{Source: "Memo", Target: nil, Suggested: strp("product"), IsOverride: true},
+	}
+	got := overridePairs(ms)
+	if len(got) != 1 || got[aliasPair{Field: "customer_id", Key: "得意先_コード"}] != "得意先 コード" {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"csv-import-kit/api/internal/store"
@@ -15,20 +19,30 @@ import (
 )
 
 type Template struct {
-	ID          string                 `json:"id"`
-	Name        string                 `json:"name"`
-	SchemaKey   string                 `json:"schema_key"`
-	Rules       map[string]interface{} `json:"rules"`
-	Description *string                `json:"description,omitempty"`
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	SchemaKey string                 `json:"schema_key"`
+	Rules     map[string]interface{} `json:"rules"`
+	// ParseOptions はこのテンプレートを使うファイルの読み取り設定（固定長の列など）
+	ParseOptions *ParseOptions `json:"parse_options,omitempty"`
+	// Positional はヘッダの無いファイル向けに列番号（{"index": n}）だけでルールを書いたテンプレート
+	// ColumnCount と列数が同じファイルにだけ当てる
+	Positional  bool       `json:"positional"`
+	ColumnCount *int       `json:"column_count,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
 type TemplateCreateReq struct {
-	Name        string                 `json:"name"`
-	SchemaKey   string                 `json:"schema_key"`
-	Rules       map[string]interface{} `json:"rules"`
-	Description *string                `json:"description,omitempty"`
+	Name         string          `json:"name"`
+	SchemaKey    string          `json:"schema_key"`
+	Rules        json.RawMessage `json:"rules"` // RuleSet として検証してから保存
+	ParseOptions *ParseOptions   `json:"parse_options,omitempty"`
+	Positional   bool            `json:"positional,omitempty"`
+	ColumnCount  *int            `json:"column_count,omitempty"` // positional のとき必須
+	Description  *string         `json:"description,omitempty"`
 }
 
 type TemplateCreateResp struct {
@@ -50,28 +64,80 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	if in.Name == "" || in.SchemaKey == "" || in.Rules == nil {
-		http.Error(w, "name, schema_key, rules are required", http.StatusBadRequest)
+	b, ok := validateTemplateReq(w, &in)
+	if !ok {
 		return
 	}
 
-	b, err := json.Marshal(in.Rules)
+	const q = `
+insert into public.mapping_templates (name, schema_key, rules, description, parse_options, positional, column_count)
+values ($1, $2, $3::jsonb, $4, $5, $6, $7)
+returning id;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var id string
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, q, in.Name, in.SchemaKey, string(b), in.Description, in.ParseOptions, in.Positional, in.ColumnCount).Scan(&id); err != nil {
+			return err
+		}
+		after, err := snapshotTemplate(ctx, tx, id, "true")
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditTemplateCreate, TargetType: "template", TargetID: id, After: after,
+		})
+	})
 	if err != nil {
-		http.Error(w, "invalid rules", http.StatusBadRequest)
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(TemplateCreateResp{ID: id})
+}
+
+// PUT /api/templates/{id}
+// 全項目置き換え。ゴミ箱内のテンプレートは 404（先に restore する）
+func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	var in TemplateCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	b, ok := validateTemplateReq(w, &in)
+	if !ok {
 		return
 	}
 
 	const q = `
-insert into public.mapping_templates (name, schema_key, rules, description)
-values ($1, $2, $3::jsonb, $4)
-returning id;
+update public.mapping_templates
+set name = $2, schema_key = $3, rules = $4::jsonb, description = $5, parse_options = $6,
+    positional = $7, column_count = $8
+where id = $1 and deleted_at is null;
 `
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	var id string
-	if err := h.Store.Pool.QueryRow(ctx, q, in.Name, in.SchemaKey, string(b), in.Description).Scan(&id); err != nil {
-		http.Error(w, "db insert error", http.StatusInternalServerError)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return h.mutateWithAudit(ctx, tx, r, id, AuditTemplateUpdate, "deleted_at is null", func() error {
+			_, err := tx.Exec(ctx, q, id, in.Name, in.SchemaKey, string(b), in.Description, in.ParseOptions, in.Positional, in.ColumnCount)
+			return err
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
 		return
 	}
 
@@ -79,43 +145,120 @@ returning id;
 	_ = json.NewEncoder(w).Encode(TemplateCreateResp{ID: id})
 }
 
+// validateTemplateReq は必須項目とルールを検証し、保存用に正規化したルール JSON を返す
+// 不正ならレスポンスを書いて false
+func validateTemplateReq(w http.ResponseWriter, in *TemplateCreateReq) ([]byte, bool) {
+	if in.Name == "" || in.SchemaKey == "" || len(in.Rules) == 0 {
+		http.Error(w, "name, schema_key, rules are required", http.StatusBadRequest)
+		return nil, false
+	}
+	rules, issues := parseRules(in.Rules)
+	if len(issues) == 0 && len(rules) == 0 {
+		issues = []RuleIssue{{Path: "rules", Reason: "must contain at least one destination"}}
+	}
+	if len(issues) == 0 {
+		issues = positionalIssues(in, rules)
+	}
+	if len(issues) > 0 {
+		writeRuleIssues(w, issues)
+		return nil, false
+	}
+	if in.ParseOptions != nil {
+		if err := in.ParseOptions.validate(); err != nil {
+			http.Error(w, "parse_options: "+err.Error(), http.StatusUnprocessableEntity)
+			return nil, false
+		}
+	}
+
+	// 正規化した形で保存する
+	b, err := json.Marshal(rules)
+	if err != nil {
+		http.Error(w, "invalid rules", http.StatusBadRequest)
+		return nil, false
+	}
+	return b, true
+}
+
+// positionalIssues は列番号で書いたテンプレートの検証（column_count が必須、ルールは列数以内の index だけ）
+func positionalIssues(in *TemplateCreateReq, rules RuleSet) []RuleIssue {
+	if !in.Positional {
+		if in.ColumnCount != nil {
+			return []RuleIssue{{Path: "column_count", Reason: "requires positional: true"}}
+		}
+		return nil
+	}
+	if in.ColumnCount == nil || *in.ColumnCount < 1 {
+		return []RuleIssue{{Path: "column_count", Reason: "is required for positional templates (1 or greater)"}}
+	}
+	var issues []RuleIssue
+	for _, dest := range rules.Dests() {
+		src := rules[dest]
+		switch {
+		case src == nil:
+		case src.Index == 0:
+			issues = append(issues, RuleIssue{Path: "rules." + dest, Reason: `positional templates must reference columns by {"index": n}`})
+		case src.Index > *in.ColumnCount:
+			issues = append(issues, RuleIssue{Path: "rules." + dest, Reason: fmt.Sprintf("index %d is beyond column_count %d", src.Index, *in.ColumnCount)})
+		}
+	}
+	return issues
+}
+
 // GET /api/templates  （最新20件）
+// ?include=deleted でゴミ箱内のテンプレートも含める
+// ?columns=N でその列数のファイルに当てられるものだけにする（列数の違う positional テンプレートを除く）
 func (h *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
 	const q = `
-select id, name, schema_key, rules, description, created_at, updated_at
+select id, name, schema_key, rules, parse_options, positional, column_count, description, created_at, updated_at, deleted_at
 from public.mapping_templates
+where ($1 or deleted_at is null)
+  and ($2::int is null or not positional or column_count = $2)
 order by created_at desc
 limit 20;
 `
+	var columns *int
+	if v := r.URL.Query().Get("columns"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "columns must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		columns = &n
+	}
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	rows, err := h.Store.Pool.Query(ctx, q)
-	if err != nil {
+	out := make([]Template, 0, 20)
+	raws := make([][]byte, 0, 20)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, q, includeDeleted(r), columns)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t Template
+			var rawRules []byte
+			if err := rows.Scan(&t.ID, &t.Name, &t.SchemaKey, &rawRules, &t.ParseOptions, &t.Positional, &t.ColumnCount, &t.Description, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt); err != nil {
+				return err
+			}
+			out = append(out, t)
+			raws = append(raws, rawRules)
+		}
+		return rows.Err()
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		http.Error(w, "db query error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	out := make([]Template, 0, 20)
-	for rows.Next() {
-		var t Template
-		var rawRules []byte
-		if err := rows.Scan(&t.ID, &t.Name, &t.SchemaKey, &rawRules, &t.Description, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			http.Error(w, "db scan error", http.StatusInternalServerError)
-			return
-		}
-		if len(rawRules) > 0 {
-			if err := json.Unmarshal(rawRules, &t.Rules); err != nil {
+	for i := range out {
+		if len(raws[i]) > 0 {
+			if err := json.Unmarshal(raws[i], &out[i].Rules); err != nil {
 				http.Error(w, "rules unmarshal error", http.StatusInternalServerError)
 				return
 			}
 		}
-		out = append(out, t)
-	}
-	if err := rows.Err(); err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		http.Error(w, "db rows error", http.StatusInternalServerError)
-		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -123,6 +266,7 @@ limit 20;
 }
 
 // GET /api/templates/{id}
+// 削除済みは 404（?include=deleted なら返す）
 func (h *TemplateHandler) GetTemplateByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
@@ -131,9 +275,10 @@ func (h *TemplateHandler) GetTemplateByID(w http.ResponseWriter, r *http.Request
 	}
 
 	const q = `
-select id, name, schema_key, rules, description, created_at, updated_at
+select id, name, schema_key, rules, parse_options, positional, column_count, description, created_at, updated_at, deleted_at
 from public.mapping_templates
 where id = $1
+  and ($2 or deleted_at is null)
 limit 1;
 `
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -141,9 +286,11 @@ limit 1;
 
 	var t Template
 	var rawRules []byte
-	err := h.Store.Pool.QueryRow(ctx, q, id).Scan(
-		&t.ID, &t.Name, &t.SchemaKey, &rawRules, &t.Description, &t.CreatedAt, &t.UpdatedAt,
-	)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, q, id, includeDeleted(r)).Scan(
+			&t.ID, &t.Name, &t.SchemaKey, &rawRules, &t.ParseOptions, &t.Positional, &t.ColumnCount, &t.Description, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
+		)
+	})
 	if errors.Is(err, pgx.ErrNoRows) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
@@ -164,6 +311,7 @@ limit 1;
 }
 
 // DELETE /api/templates/{id}
+// 物理削除ではなくゴミ箱へ移動（deleted_at を立てる）
 func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
@@ -171,20 +319,138 @@ func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	const q = `delete from public.mapping_templates where id = $1;`
-
+	const q = `
+update public.mapping_templates
+set deleted_at = now()
+where id = $1 and deleted_at is null;
+`
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	ct, err := h.Store.Pool.Exec(ctx, q, id)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return h.mutateWithAudit(ctx, tx, r, id, AuditTemplateDelete, "deleted_at is null", func() error {
+			_, err := tx.Exec(ctx, q, id)
+			return err
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "db delete error", http.StatusInternalServerError)
 		return
 	}
-	if ct.RowsAffected() == 0 {
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/templates/{id}/restore
+// ゴミ箱から戻す（削除されていないものは 404）
+func (h *TemplateHandler) RestoreTemplate(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	const q = `
+update public.mapping_templates
+set deleted_at = null
+where id = $1 and deleted_at is not null;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return h.mutateWithAudit(ctx, tx, r, id, AuditTemplateRestore, "deleted_at is not null", func() error {
+			_, err := tx.Exec(ctx, q, id)
+			return err
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, "db restore error", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// mutateWithAudit は対象行をロックして変更前後のスナップショットを取り、監査ログを書く
+// cond に合う行が無ければ pgx.ErrNoRows
+func (h *TemplateHandler) mutateWithAudit(ctx context.Context, tx pgx.Tx, r *http.Request, id, action, cond string, mutate func() error) error {
+	before, err := snapshotTemplate(ctx, tx, id, cond)
+	if err != nil {
+		return err
+	}
+	if err := mutate(); err != nil {
+		return err
+	}
+	after, err := snapshotTemplate(ctx, tx, id, "true")
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+		Action: action, TargetType: "template", TargetID: id, Before: before, After: after,
+	})
+}
+
+// snapshotTemplate はテンプレート 1 行を JSON で取る（for update で行ロック）
+func snapshotTemplate(ctx context.Context, tx pgx.Tx, id, cond string) (map[string]interface{}, error) {
+	return snapshotRow(ctx, tx, `
+select to_jsonb(t)
+from public.mapping_templates t
+where t.id = $1 and `+cond+`
+for update;
+`, id)
+}
+
+// PurgeDeleted はゴミ箱に入ってから retention 以上経過したテンプレートを物理削除する
+// 全ワークスペース横断のメンテナンス処理なので、テナントロールには切り替えない
+func (h *TemplateHandler) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	const q = `
+delete from public.mapping_templates
+where deleted_at is not null and deleted_at < $1;
+`
+	ct, err := h.Store.Pool.Exec(ctx, q, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return ct.RowsAffected(), nil
+}
+
+// RunTrashPurger は ctx が終わるまで interval ごとに PurgeDeleted を実行する
+func (h *TemplateHandler) RunTrashPurger(ctx context.Context, retention, interval time.Duration, logger *slog.Logger) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		n, err := h.PurgeDeleted(pctx, retention)
+		cancel()
+		if err != nil {
+			logger.Error("template purge failed", "err", err)
+		} else if n > 0 {
+			logger.Info("purged deleted templates", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ?include=deleted
+func includeDeleted(r *http.Request) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(v) == "deleted" {
+			return true
+		}
+	}
+	return false
+}
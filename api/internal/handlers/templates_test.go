@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestIncludeDeleted(t *testing.T) {
+	for q, want := range map[string]bool{
+		"":                         false,
+		"include=deleted":          true,
+		"include=rules,%20deleted": true,
+		"include=deleted_at":       false,
+	} {
+		r := httptest.NewRequest("GET", "/api/templates?"+q, nil)
+		if got := includeDeleted(r); got != want {
+			t.Errorf("%q: got %v", q, got)
+		}
+	}
+}
+
+// 削除でゴミ箱へ（一覧・取得から消え、?include=deleted なら見える）→ restore で戻る
+func TestTemplateTrash(t *testing.T) {
+	st, ws := testWorkspace(t, "template-trash")
+	ctx := context.Background()
+	var id string
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `insert into public.mapping_templates (name, schema_key, rules) values ('orders', 'orders_v1', '{"order_id":"Order ID"}') returning id`).Scan(&id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewTemplateHandler(st)
+	withID := uploadRequester(ws)
+	call := func(fn http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		fn(rec, withID(httptest.NewRequest(method, target, nil), id))
+		return rec
+	}
+	list := func(query string) []Template {
+		t.Helper()
+		rec := call(h.ListTemplates, "GET", "/api/templates"+query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list%s: %d %s", query, rec.Code, rec.Body)
+		}
+		var out []Template
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// 削除されていないものの restore は 404
+	if rec := call(h.RestoreTemplate, "POST", "/api/templates/"+id+"/restore"); rec.Code != http.StatusNotFound {
+		t.Fatalf("restore before delete: %d", rec.Code)
+	}
+
+	if rec := call(h.DeleteTemplate, "DELETE", "/api/templates/"+id); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if got := list(""); len(got) != 0 {
+		t.Fatalf("deleted template should be hidden from list: %+v", got)
+	}
+	if rec := call(h.GetTemplateByID, "GET", "/api/templates/"+id); rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: %d", rec.Code)
+	}
+	if got := list("?include=deleted"); len(got) != 1 || got[0].ID != id || got[0].DeletedAt == nil {
+		t.Fatalf("include=deleted: %+v", got)
+	}
+	if rec := call(h.GetTemplateByID, "GET", "/api/templates/"+id+"?include=deleted"); rec.Code != http.StatusOK {
+		t.Fatalf("get deleted with include=deleted: %d", rec.Code)
+	}
+	// 2 回目の削除も 404
+	if rec := call(h.DeleteTemplate, "DELETE", "/api/templates/"+id); rec.Code != http.StatusNotFound {
+		t.Fatalf("second delete: %d", rec.Code)
+	}
+
+	if rec := call(h.RestoreTemplate, "POST", "/api/templates/"+id+"/restore"); rec.Code != http.StatusNoContent {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body)
+	}
+	if got := list(""); len(got) != 1 || got[0].ID != id || got[0].DeletedAt != nil {
+		t.Fatalf("restored template should be listed: %+v", got)
+	}
+	if rec := call(h.GetTemplateByID, "GET", "/api/templates/"+id); rec.Code != http.StatusOK {
+		t.Fatalf("get restored: %d", rec.Code)
+	}
+}
+
+// purge は保持期間を過ぎたゴミ箱内のテンプレートだけを消す
+func TestPurgeDeleted(t *testing.T) {
+	st, ws := testWorkspace(t, "template-purge")
+	ctx := context.Background()
+	err := st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		for name, deletedAt := range map[string]string{
+			"expired": "now() - interval '31 days'",
+			"recent":  "now() - interval '1 day'",
+			"active":  "null",
+		} {
+			q := `insert into public.mapping_templates (name, schema_key, rules, deleted_at) values ($1, 'orders_v1', '{}', ` + deletedAt + `)`
+			if _, err := tx.Exec(ctx, q, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewTemplateHandler(st).PurgeDeleted(ctx, 30*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	left := map[string]bool{}
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `select name from public.mapping_templates`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			left[name] = true
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left["expired"] || !left["recent"] || !left["active"] || len(left) != 2 {
+		t.Fatalf("left after purge: %v", left)
+	}
+}
@@ -0,0 +1,696 @@
+// api/internal/handlers/uploads.go
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// 再開可能アップロード
+//
+//	POST   /api/uploads                {filename, size, checksum?} → 201（Location, Upload-Offset: 0）
+//	HEAD   /api/uploads/{id}           Upload-Offset（どこまで受け取ったか）
+//	PATCH  /api/uploads/{id}           Upload-Offset: <n> + チャンク本体（途中で切れても受け取った分は残る）
+//	POST   /api/uploads/{id}/complete  checksum を検証して imports を作り、parse ジョブを積む
+//	DELETE /api/uploads/{id}           中止
+const (
+	defaultResumableMaxMB = 2048
+	uploadChunkMaxMB      = 16 // PATCH 1 回の上限（推奨チャンクサイズとして返す）
+	uploadChunkTimeout    = 5 * time.Minute
+	uploadCompleteTimeout = 15 * time.Minute // complete（2GB の SHA-256・プレビュー・BlobStore への転送）
+	uploadTTL             = 24 * time.Hour   // 最後のチャンクからこの時間で期限切れ
+)
+
+var errUploadChecksum = errors.New("checksum mismatch")
+
+// errUploadNotOpen は complete の間に別の complete・中止・期限切れで uploading でなくなった
+var errUploadNotOpen = errors.New("upload is no longer uploading")
+
+type Upload struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Checksum  *string   `json:"checksum,omitempty"`
+	Status    string    `json:"status"` // uploading / completed / aborted
+	ImportID  *string   `json:"import_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	ChunkSize int       `json:"chunk_size"` // PATCH 1 回で送れる上限
+}
+
+type UploadCreateReq struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"` // sha256:<hex>
+}
+
+const uploadColumns = `id, filename, size, upload_offset, checksum, status, import_id, expires_at, created_at`
+
+func scanUpload(row pgx.Row) (Upload, error) {
+	var u Upload
+	err := row.Scan(&u.ID, &u.Filename, &u.Size, &u.Offset, &u.Checksum, &u.Status, &u.ImportID, &u.ExpiresAt, &u.CreatedAt)
+	u.ChunkSize = uploadChunkMaxMB << 20
+	return u, err
+}
+
+func (h *ImportHandler) maxResumableBytes() int64 {
+	if h.MaxResumableBytes > 0 {
+		return h.MaxResumableBytes
+	}
+	return defaultResumableMaxMB << 20
+}
+
+// partPath は受信途中のファイル UploadDir/<workspace>/uploads/<id>.part
+func (h *ImportHandler) partPath(workspaceID, uploadID string) string {
+	return filepath.Join(h.uploadRoot(), workspaceID, "uploads", uploadID+".part")
+}
+
+func writeUploadHeaders(w http.ResponseWriter, u Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// POST /api/uploads
+func (h *ImportHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	var in UploadCreateReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	in.Filename = strings.TrimSpace(filepath.Base(in.Filename))
+	if in.Filename == "" || in.Filename == "." || in.Size <= 0 {
+		http.Error(w, "filename, size are required", http.StatusBadRequest)
+		return
+	}
+	// zip は展開の上限を先に確かめるので POST /api/imports だけで受ける
+	if strings.EqualFold(filepath.Ext(in.Filename), ".zip") {
+		http.Error(w, "zip archives must be uploaded to POST /api/imports", http.StatusUnsupportedMediaType)
+		return
+	}
+	if in.Size > h.maxResumableBytes() {
+		http.Error(w, fmt.Sprintf("size exceeds limit (%d bytes)", h.maxResumableBytes()), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if in.Checksum != "" {
+		if _, err := parseChecksum(in.Checksum); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	const q = `
+insert into public.uploads (filename, size, checksum, created_by, expires_at)
+values ($1, $2, nullif($3, ''), nullif($4, ''), now() + make_interval(secs => $5))
+returning ` + uploadColumns + `;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ws := workspaceID(r)
+	var out Upload
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var err error
+		out, err = scanUpload(tx.QueryRow(ctx, q, in.Filename, in.Size, strings.ToLower(in.Checksum), PrincipalFrom(r.Context()).Actor(), uploadTTL.Seconds()))
+		if err != nil {
+			return err
+		}
+		path := h.partPath(ws, out.ID)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		return os.WriteFile(path, nil, 0o600)
+	})
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	writeUploadHeaders(w, out)
+	w.Header().Set("Location", "/api/uploads/"+out.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET / HEAD /api/uploads/{id}
+func (h *ImportHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out Upload
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = scanUpload(tx.QueryRow(ctx, `select `+uploadColumns+` from public.uploads where id = $1`, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	writeUploadHeaders(w, out)
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PATCH /api/uploads/{id}
+// Upload-Offset はクライアントが送り始める位置（サーバの受信済みサイズと一致しないと 409）
+// Upload-Checksum: sha256 <base64> を付けるとチャンク単位で検証し、不一致なら捨てて 422
+func (h *ImportHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset < 0 {
+		http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+	var chunkSum []byte
+	if v := r.Header.Get("Upload-Checksum"); v != "" {
+		algo, b64, _ := strings.Cut(v, " ")
+		chunkSum, err = base64.StdEncoding.DecodeString(b64)
+		if !strings.EqualFold(algo, "sha256") || err != nil || len(chunkSum) != sha256.Size {
+			http.Error(w, "Upload-Checksum must be 'sha256 <base64>'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 遅い回線でもチャンク 1 つ分は読み切れるように（サーバ全体の ReadTimeout を延ばす）
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(uploadChunkTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(uploadChunkTimeout + 10*time.Second))
+	body := http.MaxBytesReader(w, r.Body, int64(uploadChunkMaxMB<<20))
+
+	// 接続が切れても受け取れた分の offset は記録したいので、リクエストのキャンセルは引き継がない
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), uploadChunkTimeout)
+	defer cancel()
+
+	ws := workspaceID(r)
+	var out Upload
+	var status int
+	var readErr error
+	// 1. 状態と offset を確かめるだけ（ロックは取らない）
+	err = h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var err error
+		out, err = scanUpload(tx.QueryRow(ctx, `select `+uploadColumns+` from public.uploads where id = $1`, id))
+		return err
+	})
+	if err == nil {
+		status = uploadPatchStatus(out, clientOffset)
+	}
+
+	// 2. チャンクはトランザクションの外で一時ファイルに受ける（遅い回線でも DB の接続と行ロックを持たない）
+	var tmp string
+	var n int64
+	if err == nil && status == 0 {
+		tmp, n, readErr = h.receiveChunk(ws, id, out.Size-out.Offset, body, chunkSum)
+		if tmp != "" {
+			defer os.Remove(tmp)
+		}
+		switch {
+		case errors.Is(readErr, errUploadChecksum):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(readErr, errChunkTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case tmp == "":
+			err = readErr
+		}
+	}
+
+	// 3. offset が読んだときのままなら進める（compare-and-set）。同じ offset への PATCH が並んでも 1 つだけ通る
+	// 行を更新してロックを持っている間に .part へ移すので、.part への書き込みも直列になる
+	// 読み取りが途中で切れても、書けた分は受け取り済みにする（次はそこから再開）
+	if err == nil && status == 0 {
+		const q = `
+update public.uploads
+set upload_offset = $3, expires_at = now() + make_interval(secs => $4)
+where id = $1 and upload_offset = $2 and status = 'uploading'
+returning ` + uploadColumns + `;
+`
+		err = h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+			next, err := scanUpload(tx.QueryRow(ctx, q, id, clientOffset, clientOffset+n, uploadTTL.Seconds()))
+			if errors.Is(err, pgx.ErrNoRows) {
+				// 先に別の PATCH（または complete / 中止）が通った
+				out, err = scanUpload(tx.QueryRow(ctx, `select `+uploadColumns+` from public.uploads where id = $1`, id))
+				if err == nil {
+					status = http.StatusConflict
+				}
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			out = next
+			return moveChunk(tmp, h.partPath(ws, id), clientOffset, n)
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	writeUploadHeaders(w, out)
+	switch status {
+	case http.StatusConflict:
+		msg := "upload is " + out.Status
+		if out.Status == "uploading" {
+			msg = fmt.Sprintf("offset mismatch: server has %d bytes", out.Offset)
+		}
+		http.Error(w, msg, status)
+		return
+	case http.StatusGone:
+		http.Error(w, "upload expired", status)
+		return
+	case http.StatusUnprocessableEntity:
+		http.Error(w, "chunk checksum mismatch", status)
+		return
+	case http.StatusRequestEntityTooLarge:
+		http.Error(w, "chunk exceeds declared size or chunk limit", status)
+		return
+	}
+	if readErr != nil {
+		// クライアントには届かないことが多いが、届く場合は受け取れた位置を返す
+		http.Error(w, "incomplete chunk: "+readErr.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadPatchStatus は PATCH を受けられない理由（受けられるなら 0）
+func uploadPatchStatus(u Upload, clientOffset int64) int {
+	switch {
+	case u.Status != "uploading":
+		return http.StatusConflict
+	case time.Now().After(u.ExpiresAt):
+		return http.StatusGone
+	case clientOffset != u.Offset:
+		return http.StatusConflict
+	}
+	return 0
+}
+
+// receiveChunk はチャンクを .part の隣の一時ファイルに受け、そのパスと書けたバイト数を返す
+// 一時ファイルを作れなかったときだけパスが空
+func (h *ImportHandler) receiveChunk(ws, id string, remaining int64, body io.Reader, sum []byte) (string, int64, error) {
+	part := h.partPath(ws, id)
+	f, err := os.CreateTemp(filepath.Dir(part), filepath.Base(part)+".*.chunk")
+	if err != nil {
+		return "", 0, err
+	}
+	tmp := f.Name()
+	f.Close()
+	n, err := appendChunk(tmp, 0, remaining, body, sum)
+	return tmp, n, err
+}
+
+// moveChunk は受けたチャンク（n バイト）を .part の offset の位置に書く
+func moveChunk(tmp, part string, offset, n int64) error {
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	written, err := appendChunk(part, offset, n, f, nil)
+	if err == nil && written != n {
+		err = fmt.Errorf("chunk moved %d of %d bytes", written, n)
+	}
+	return err
+}
+
+var errChunkTooLarge = errors.New("chunk too large")
+
+// appendChunk は path の offset から最大 remaining バイトを書き、書けたバイト数を返す
+// sum があれば全体を読み終えてから照合し、不一致なら書いた分を取り消す
+// 読み取りエラー（接続断など）の場合も書けた分は残す
+func appendChunk(path string, offset, remaining int64, body io.Reader, sum []byte) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	// 前回 DB 更新前に落ちた等で offset より後ろにゴミがあれば捨てる
+	if err := f.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var hw hash.Hash
+	dst := io.Writer(f)
+	if sum != nil {
+		hw = sha256.New()
+		dst = io.MultiWriter(f, hw)
+	}
+	// 宣言サイズを超える分は 1 バイトだけ読んで検出する
+	n, readErr := io.Copy(dst, io.LimitReader(body, remaining+1))
+	rollback := func(e error) (int64, error) {
+		_ = f.Truncate(offset)
+		return 0, e
+	}
+	switch {
+	case n > remaining:
+		return rollback(errChunkTooLarge)
+	case errors.As(readErr, new(*http.MaxBytesError)):
+		return rollback(errChunkTooLarge)
+	case hw != nil && readErr != nil:
+		return rollback(readErr) // 照合できないので全部捨てる
+	case hw != nil && !bytes.Equal(hw.Sum(nil), sum):
+		return rollback(errUploadChecksum)
+	}
+	if err := f.Sync(); err != nil {
+		return rollback(err)
+	}
+	return n, readErr
+}
+
+// POST /api/uploads/{id}/complete  {checksum?}
+// 全バイト受信済みなら SHA-256 を照合してプレビューを作り、通常のアップロードと同じく imports + parse ジョブにする
+// checksum 不一致なら受信済みを破棄して 0 からやり直させる（422）
+// 既に complete が通っていれば（応答を受け取れなかった再送・同時の complete）新しく作らず、その取り込みを返す
+func (h *ImportHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		Checksum string `json:"checksum"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if in.Checksum != "" {
+		if _, err := parseChecksum(in.Checksum); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 大きなファイルはハッシュと転送だけでサーバ全体の WriteTimeout（30 秒）を超えるので、この応答だけ延ばす
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(uploadCompleteTimeout + 10*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ws := workspaceID(r)
+	var up Upload
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var err error
+		up, err = scanUpload(tx.QueryRow(ctx, `select `+uploadColumns+` from public.uploads where id = $1`, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case up.Status == "completed" && up.ImportID != nil:
+		h.writeUploadImport(w, r, ws, *up.ImportID)
+		return
+	case up.Status != "uploading":
+		http.Error(w, "upload is "+up.Status, http.StatusConflict)
+		return
+	case up.Offset != up.Size:
+		writeUploadHeaders(w, up)
+		http.Error(w, fmt.Sprintf("upload is incomplete: %d of %d bytes", up.Offset, up.Size), http.StatusConflict)
+		return
+	}
+
+	// 作成時と complete の両方で指定されたら同じであること
+	want := strings.ToLower(in.Checksum)
+	if up.Checksum != nil {
+		if want != "" && want != *up.Checksum {
+			http.Error(w, "checksum differs from the one given at creation", http.StatusBadRequest)
+			return
+		}
+		want = *up.Checksum
+	}
+
+	part := h.partPath(ws, id)
+	got, err := fileSHA256(part)
+	if err != nil {
+		// 同時に通った complete が .part を消した
+		if !h.completedElsewhere(w, r, ws, id) {
+			http.Error(w, "read error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if want != "" {
+		wantHex, _ := parseChecksum(want)
+		if got != wantHex {
+			h.resetUpload(r, ws, id)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"error": "checksum_mismatch", "expected": "sha256:" + wantHex, "actual": "sha256:" + got,
+			})
+			return
+		}
+	}
+
+	f, err := os.Open(part)
+	if err != nil {
+		if !h.completedElsewhere(w, r, ws, id) {
+			http.Error(w, "read error", http.StatusInternalServerError)
+		}
+		return
+	}
+	opts := formatFromUpload(up.Filename, "") // .json / .ndjson は JSON、.ods / .xls は表計算として読む
+	resp, err := buildPreviewWith(f, opts)
+	f.Close()
+	if err != nil {
+		http.Error(w, "csv parse error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 元ファイルを BlobStore（S3 など）へ送るので長めに取る
+	ictx, icancel := context.WithTimeout(r.Context(), uploadCompleteTimeout)
+	defer icancel()
+	importID, jobID, err := h.createImport(ictx, r, importSource{
+		Filename: up.Filename,
+		Size:     up.Size,
+		UploadID: id,
+		Options:  opts,
+		open:     func() (io.ReadCloser, error) { return os.Open(part) },
+	}, &resp)
+	if errors.Is(err, errUploadNotOpen) {
+		if !h.completedElsewhere(w, r, ws, id) {
+			http.Error(w, "upload is no longer uploading", http.StatusConflict)
+		}
+		return
+	}
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+	_ = os.Remove(part)
+
+	resp.ImportID = importID
+	resp.JobID = jobID
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// completedElsewhere は別の complete が先に通っていれば、その取り込みを書いて true を返す
+func (h *ImportHandler) completedElsewhere(w http.ResponseWriter, r *http.Request, ws, id string) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	var up Upload
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var err error
+		up, err = scanUpload(tx.QueryRow(ctx, `select `+uploadColumns+` from public.uploads where id = $1`, id))
+		return err
+	})
+	if err != nil || up.Status != "completed" || up.ImportID == nil {
+		return false
+	}
+	h.writeUploadImport(w, r, ws, *up.ImportID)
+	return true
+}
+
+// writeUploadImport は complete で作った取り込みを、complete の応答と同じ形で返す
+// プレビューは imports.sample（previewSample と同じキー）から、ジョブは最初の parse ジョブ
+func (h *ImportHandler) writeUploadImport(w http.ResponseWriter, r *http.Request, ws, importID string) {
+	const q = `
+select row_count, sample,
+       coalesce((select j.id::text from public.jobs j where j.import_id = i.id and j.type = 'parse' order by j.created_at limit 1), '')
+from public.imports i
+where i.id = $1;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	var resp previewResponse
+	var sample []byte
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, q, importID).Scan(&resp.RowCount, &sample, &resp.JobID)
+	})
+	if err == nil && len(sample) > 0 {
+		err = json.Unmarshal(sample, &resp)
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+	resp.ImportID = importID
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// resetUpload は受信済みを捨てて 0 からやり直せるようにする
+func (h *ImportHandler) resetUpload(r *http.Request, ws, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	_ = h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update public.uploads set upload_offset = 0 where id = $1 and status = 'uploading'`, id); err != nil {
+			return err
+		}
+		return os.Truncate(h.partPath(ws, id), 0)
+	})
+}
+
+// DELETE /api/uploads/{id}
+func (h *ImportHandler) AbortUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ws := workspaceID(r)
+	var status string
+	err := h.Store.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+update public.uploads set status = case when status = 'uploading' then 'aborted' else status end
+where id = $1
+returning status`, id).Scan(&status)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+	if status == "completed" {
+		http.Error(w, "upload is completed", http.StatusConflict)
+		return
+	}
+	h.removeUploadFiles(ws, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunUploadPurger は ctx が終わるまで interval ごとに期限切れのアップロードを中止し、途中のファイルを消す
+func (h *ImportHandler) RunUploadPurger(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		n, err := h.purgeExpiredUploads(pctx)
+		cancel()
+		if err != nil {
+			logger.Error("upload purge failed", "err", err)
+		} else if n > 0 {
+			logger.Info("purged expired uploads", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// purgeExpiredUploads は全ワークスペース分をまとめて処理する（テンプレートのパージと同じくオーナー接続）
+func (h *ImportHandler) purgeExpiredUploads(ctx context.Context) (int, error) {
+	const q = `
+update public.uploads set status = 'aborted'
+where status = 'uploading' and expires_at < now()
+returning id, workspace_id;
+`
+	rows, err := h.Store.Pool.Query(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var id, ws string
+		if err := rows.Scan(&id, &ws); err != nil {
+			return n, err
+		}
+		h.removeUploadFiles(ws, id)
+		n++
+	}
+	return n, rows.Err()
+}
+
+// removeUploadFiles は .part と、PATCH の途中で落ちて残った一時ファイルを消す
+func (h *ImportHandler) removeUploadFiles(ws, id string) {
+	part := h.partPath(ws, id)
+	_ = os.Remove(part)
+	chunks, _ := filepath.Glob(part + ".*.chunk")
+	for _, c := range chunks {
+		_ = os.Remove(c)
+	}
+}
+
+// parseChecksum は "sha256:<hex>" の hex 部分を返す
+func parseChecksum(s string) (string, error) {
+	algo, v, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	if !ok || algo != "sha256" {
+		return "", errors.New("checksum must be 'sha256:<hex>'")
+	}
+	if b, err := hex.DecodeString(v); err != nil || len(b) != sha256.Size {
+		return "", errors.New("checksum must be 'sha256:<hex>'")
+	}
+	return v, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hw := sha256.New()
+	if _, err := io.Copy(hw, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hw.Sum(nil)), nil
+}
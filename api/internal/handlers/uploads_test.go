@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"csv-import-kit/api/internal/blob"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// 途中で切れる本体（接続断の再現）
+type brokenReader struct {
+	data string
+	done bool
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, errors.New("connection reset")
+	}
+	b.done = true
+	return copy(p, b.data), nil
+}
+
+func TestAppendChunk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "u.part")
+	const size = 10
+
+	n, err := appendChunk(path, 0, size, strings.NewReader("abcd"), nil)
+	if err != nil || n != 4 {
+		t.Fatalf("first chunk: %d %v", n, err)
+	}
+	// 接続断: 届いた分は残る
+	n, err = appendChunk(path, 4, size-4, &brokenReader{data: "ef"}, nil)
+	if err == nil || n != 2 {
+		t.Fatalf("broken chunk: %d %v", n, err)
+	}
+	// DB 更新前に落ちて offset より後ろに残ったゴミは次の PATCH で捨てる
+	if err := os.WriteFile(path, []byte("abcdefXXX"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("ghij"))
+	n, err = appendChunk(path, 6, size-6, strings.NewReader("ghij"), sum[:])
+	if err != nil || n != 4 {
+		t.Fatalf("checksummed chunk: %d %v", n, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdefghij" {
+		t.Fatalf("content: %q", b)
+	}
+
+	// 宣言サイズ超過・チェックサム不一致は書いた分を取り消す
+	if _, err := appendChunk(path, 6, size-6, strings.NewReader("ghijk"), nil); !errors.Is(err, errChunkTooLarge) {
+		t.Fatalf("overflow: %v", err)
+	}
+	if _, err := appendChunk(path, 6, size-6, strings.NewReader("zzzz"), sum[:]); !errors.Is(err, errUploadChecksum) {
+		t.Fatalf("checksum: %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Fatalf("rolled back content: %q", b)
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("x"))
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if got, err := parseChecksum("SHA256:" + hexSum); err != nil || got != strings.ToLower(hexSum) {
+		t.Fatalf("valid: %q %v", got, err)
+	}
+	for _, bad := range []string{"", "md5:abcd", "sha256:zz", "sha256:abcd"} {
+		if _, err := parseChecksum(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestBuildPreviewFromMatchesBytes(t *testing.T) {
+	csv := "\xEF\xBB\xBFname;email\nAlice;a@example.com\nBob;b@example.com\n"
+	want, err := buildPreview([]byte(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := buildPreviewFrom(io.MultiReader(strings.NewReader(csv[:5]), strings.NewReader(csv[5:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Delimiter != ";" || got.RowCount != 2 || !got.HasHeader || got.Headers[0] != "name" {
+		t.Fatalf("preview: %+v", got)
+	}
+	if got.RowCount != want.RowCount || got.Delimiter != want.Delimiter || len(got.SampleRows) != len(want.SampleRows) {
+		t.Fatalf("stream %+v != bytes %+v", got, want)
+	}
+}
+
+func TestPutOriginal(t *testing.T) {
+	mem := blob.NewMemory()
+	h := &ImportHandler{Blobs: mem}
+	const body = "email,name\na@example.com,A\n"
+	key := originalKey("ws1", "imp1")
+	src := importSource{
+		Size: int64(len(body)),
+		open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(body)), nil },
+	}
+	sum, size, err := h.putOriginal(context.Background(), key, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte(body))
+	if sum != hex.EncodeToString(want[:]) || size != int64(len(body)) {
+		t.Fatalf("sum=%s size=%d", sum, size)
+	}
+	rc, err := mem.Get(context.Background(), "ws1/imports/imp1/original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != body {
+		t.Fatalf("stored %q", got)
+	}
+
+	// 宣言サイズと実サイズが違えば失敗させる（途中で切れた .part など）
+	src.Size = 100
+	if _, _, err := h.putOriginal(context.Background(), key, src); err == nil {
+		t.Fatal("size mismatch should fail")
+	}
+}
+
+// 最初の Read で started を閉じ、release まで待つ本体（同じ offset への PATCH を並べる）
+type gatedReader struct {
+	r       io.Reader
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	g.once.Do(func() {
+		close(g.started)
+		<-g.release
+	})
+	return g.r.Read(p)
+}
+
+// uploadRequester はワークスペースの呼び出し元と URL の {id} をリクエストに付ける
+func uploadRequester(ws string) func(r *http.Request, id string) *http.Request {
+	p := &Principal{WorkspaceID: ws, Name: "test"}
+	return func(r *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return r.WithContext(context.WithValue(withPrincipal(r.Context(), p), chi.RouteCtxKey, rctx))
+	}
+}
+
+func createTestUpload(t *testing.T, h *ImportHandler, withID func(*http.Request, string) *http.Request, size int) Upload {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"filename":"a.csv","size":%d}`, size)
+	h.CreateUpload(rec, withID(httptest.NewRequest("POST", "/api/uploads", strings.NewReader(body)), ""))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	var up Upload
+	if err := json.NewDecoder(rec.Body).Decode(&up); err != nil {
+		t.Fatal(err)
+	}
+	return up
+}
+
+func TestPatchUploadConcurrentSameOffset(t *testing.T) {
+	st, ws := testWorkspace(t, "uploads-cas")
+	h := &ImportHandler{Store: st, UploadDir: t.TempDir()}
+	withID := uploadRequester(ws)
+	up := createTestUpload(t, h, withID, 8)
+
+	// 2 つとも offset 0 を確かめてから本体を読ませる
+	release := make(chan struct{})
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i, body := range []string{"aaaa", "bbbb"} {
+		g := &gatedReader{r: strings.NewReader(body), started: make(chan struct{}), release: release}
+		r := withID(httptest.NewRequest("PATCH", "/api/uploads/"+up.ID, g), up.ID)
+		r.Header.Set("Upload-Offset", "0")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.PatchUpload(rec, r)
+			codes[i] = rec.Code
+		}(i)
+		<-g.started
+	}
+	close(release)
+	wg.Wait()
+
+	won := -1
+	for i, c := range codes {
+		if c == http.StatusNoContent {
+			won = i
+		} else if c != http.StatusConflict {
+			t.Fatalf("codes = %v", codes)
+		}
+	}
+	if won < 0 || codes[0] == codes[1] {
+		t.Fatalf("exactly one PATCH should win: %v", codes)
+	}
+	b, err := os.ReadFile(h.partPath(ws, up.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aaaa", "bbbb"}[won]; string(b) != want {
+		t.Fatalf("part = %q, want %q", b, want)
+	}
+	// 一時ファイルは残らない
+	if left, _ := filepath.Glob(h.partPath(ws, up.ID) + ".*.chunk"); len(left) != 0 {
+		t.Fatalf("leftover chunks: %v", left)
+	}
+}
+
+func TestCompleteUploadRetry(t *testing.T) {
+	st, ws := testWorkspace(t, "uploads-complete")
+	h := &ImportHandler{Store: st, UploadDir: t.TempDir()}
+	withID := uploadRequester(ws)
+	data := "a,b\n1,2\n"
+	up := createTestUpload(t, h, withID, len(data))
+
+	r := withID(httptest.NewRequest("PATCH", "/api/uploads/"+up.ID, strings.NewReader(data)), up.ID)
+	r.Header.Set("Upload-Offset", "0")
+	rec := httptest.NewRecorder()
+	h.PatchUpload(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("patch: %d %s", rec.Code, rec.Body)
+	}
+
+	complete := func() previewResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.CompleteUpload(rec, withID(httptest.NewRequest("POST", "/api/uploads/"+up.ID+"/complete", nil), up.ID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("complete: %d %s", rec.Code, rec.Body)
+		}
+		var resp previewResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	first := complete()
+	// 応答を受け取れなかったクライアントの再送は同じ取り込みを返す（2 件目を作らない）
+	again := complete()
+	if first.ImportID == "" || again.ImportID != first.ImportID || again.JobID != first.JobID || again.RowCount != 1 {
+		t.Fatalf("first = %+v, again = %+v", first, again)
+	}
+	var n int
+	err := st.InWorkspace(context.Background(), ws, func(tx pgx.Tx) error {
+		return tx.QueryRow(context.Background(), `select count(*) from public.imports`).Scan(&n)
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("imports = %d, err = %v", n, err)
+	}
+
+	// 元ファイルは complete のトランザクションの前に置かれ、そのまま返る
+	rec = httptest.NewRecorder()
+	h.GetOriginal(rec, withID(httptest.NewRequest("GET", "/api/imports/"+first.ImportID+"/original", nil), first.ImportID))
+	if rec.Code != http.StatusOK || rec.Body.String() != data || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("original: %d %q %v", rec.Code, rec.Body, rec.Header())
+	}
+}
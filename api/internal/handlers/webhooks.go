@@ -0,0 +1,498 @@
+// api/internal/handlers/webhooks.go
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+	"csv-import-kit/api/internal/webhooks"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const webhookSecretPrefix = "whsec_"
+
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedBy   *string   `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookReq struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active,omitempty"` // 省略時 true
+	Secret      string   `json:"secret,omitempty"` // 省略時は生成（PUT では省略すると変えない）
+}
+
+// secret は作成時（と PUT で差し替えた時）のレスポンスでしか返さない
+type WebhookSecretResp struct {
+	Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery は配信 1 件と試行の履歴
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	Event          string           `json:"event"`
+	Status         string           `json:"status"` // pending / succeeded / dead
+	Attempts       int              `json:"attempts"`
+	MaxAttempts    int              `json:"max_attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"` // pending のみ
+	LastStatusCode *int             `json:"last_status_code,omitempty"`
+	LastError      *string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	Payload        json.RawMessage  `json:"payload"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log"`
+}
+
+type WebhookAttempt struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"` // null = 接続できなかった
+	Error      *string   `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	Response   *string   `json:"response,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookHandler struct {
+	Store *store.Store
+}
+
+func NewWebhookHandler(s *store.Store) *WebhookHandler {
+	return &WebhookHandler{Store: s}
+}
+
+const webhookColumns = `id, url, events, description, active, created_by, created_at, updated_at`
+
+func scanWebhook(row pgx.Row) (Webhook, error) {
+	var wh Webhook
+	err := row.Scan(&wh.ID, &wh.URL, &wh.Events, &wh.Description, &wh.Active, &wh.CreatedBy, &wh.CreatedAt, &wh.UpdatedAt)
+	return wh, err
+}
+
+// snapshotWebhook は監査ログ用（secret は載せない）
+func snapshotWebhook(ctx context.Context, tx pgx.Tx, id string) (map[string]interface{}, error) {
+	return snapshotRow(ctx, tx, `select to_jsonb(w) - 'secret' from public.webhooks w where id = $1 for update`, id)
+}
+
+// GET /api/webhooks
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := make([]Webhook, 0)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `select `+webhookColumns+` from public.webhooks order by created_at`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			wh, err := scanWebhook(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, wh)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeWebhookReq(w, r)
+	if !ok {
+		return
+	}
+	secret := in.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			http.Error(w, "secret generation error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	const q = `
+insert into public.webhooks (url, secret, events, description, active, created_by)
+values ($1, $2, $3, $4, $5, nullif($6, ''))
+returning ` + webhookColumns + `;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	p := PrincipalFrom(r.Context())
+	out := WebhookSecretResp{Secret: secret}
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out.Webhook, err = scanWebhook(tx.QueryRow(ctx, q, in.URL, secret, in.Events, in.Description, *in.Active, p.Actor()))
+		if err != nil {
+			return err
+		}
+		after, err := snapshotWebhook(ctx, tx, out.ID)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, p, auditRecord{
+			Action: AuditWebhookCreate, TargetType: "webhook", TargetID: out.ID, After: after,
+		})
+	})
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GET /api/webhooks/{id}
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var out Webhook
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var err error
+		out, err = scanWebhook(tx.QueryRow(ctx, `select `+webhookColumns+` from public.webhooks where id = $1`, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// PUT /api/webhooks/{id}  （secret を送った時だけ差し替える）
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	in, ok := decodeWebhookReq(w, r)
+	if !ok {
+		return
+	}
+
+	const q = `
+update public.webhooks
+set url = $2, events = $3, description = $4, active = $5, secret = coalesce(nullif($6, ''), secret)
+where id = $1
+returning ` + webhookColumns + `;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := WebhookSecretResp{Secret: in.Secret}
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotWebhook(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		out.Webhook, err = scanWebhook(tx.QueryRow(ctx, q, id, in.URL, in.Events, in.Description, *in.Active, in.Secret))
+		if err != nil {
+			return err
+		}
+		after, err := snapshotWebhook(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditWebhookUpdate, TargetType: "webhook", TargetID: id, Before: before, After: after,
+			Extra: map[string]interface{}{"secret_rotated": in.Secret != ""},
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// DELETE /api/webhooks/{id}  （未送信の配信も消える）
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		before, err := snapshotWebhook(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from public.webhooks where id = $1`, id); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, PrincipalFrom(r.Context()), auditRecord{
+			Action: AuditWebhookDelete, TargetType: "webhook", TargetID: id, Before: before,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db delete error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/webhooks/{id}/deliveries?status=&limit=   （新しい順、試行の履歴付き）
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "pending" && status != "succeeded" && status != "dead" {
+		http.Error(w, "status must be pending, succeeded or dead", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			http.Error(w, "limit must be 1..500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	out := make([]WebhookDelivery, 0)
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var one int
+		if err := tx.QueryRow(ctx, `select 1 from public.webhooks where id = $1`, id).Scan(&one); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, `
+select id, event, status, attempts, max_attempts,
+       case when status = 'pending' then next_attempt_at end,
+       last_status_code, last_error, delivered_at, created_at, payload
+from public.webhook_deliveries
+where webhook_id = $1 and ($2 = '' or status = $2)
+order by created_at desc
+limit $3`, id, status, limit)
+		if err != nil {
+			return err
+		}
+		idx := map[string]int{}
+		ids := []string{}
+		for rows.Next() {
+			var d WebhookDelivery
+			if err := rows.Scan(&d.ID, &d.Event, &d.Status, &d.Attempts, &d.MaxAttempts, &d.NextAttemptAt,
+				&d.LastStatusCode, &d.LastError, &d.DeliveredAt, &d.CreatedAt, &d.Payload); err != nil {
+				rows.Close()
+				return err
+			}
+			d.AttemptLog = make([]WebhookAttempt, 0)
+			idx[d.ID] = len(out)
+			ids = append(ids, d.ID)
+			out = append(out, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		rows, err = tx.Query(ctx, `
+select delivery_id, attempt, status_code, error, duration_ms, response, created_at
+from public.webhook_delivery_attempts
+where delivery_id = any($1::uuid[])
+order by delivery_id, attempt, id`, ids)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var did string
+			var a WebhookAttempt
+			if err := rows.Scan(&did, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.Response, &a.CreatedAt); err != nil {
+				return err
+			}
+			i := idx[did]
+			out[i].AttemptLog = append(out[i].AttemptLog, a)
+		}
+		return rows.Err()
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/webhooks/{id}/deliveries/{deliveryID}/redeliver
+// dead になった配信をもう 1 回だけ送る（試行の履歴は残る）
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, did := chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID")
+
+	const q = `
+update public.webhook_deliveries
+set status = 'pending', next_attempt_at = now(), max_attempts = attempts + 1
+where id = $1 and webhook_id = $2
+returning status;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx, `select status from public.webhook_deliveries where id = $1 and webhook_id = $2 for update`, did, id).Scan(&status)
+		if err != nil {
+			return err
+		}
+		if status != "dead" {
+			return errDeliveryNotDead
+		}
+		return tx.QueryRow(ctx, q, did, id).Scan(&status)
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errDeliveryNotDead):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "db update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+var errDeliveryNotDead = errors.New("only dead deliveries can be redelivered")
+
+// POST /api/webhooks/{id}/ping  （疎通確認。購読イベントに関係なく ping を 1 件積む）
+func (h *WebhookHandler) PingWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	const q = `
+with d as (select gen_random_uuid() as id, w.id as webhook_id, w.workspace_id from public.webhooks w where w.id = $1)
+insert into public.webhook_deliveries (id, webhook_id, event, payload, max_attempts)
+select d.id, d.webhook_id, $2,
+       jsonb_build_object('id', d.id, 'event', $2, 'workspace_id', d.workspace_id, 'created_at', now(),
+                          'data', jsonb_build_object('webhook_id', d.webhook_id)),
+       1
+from d
+returning id;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var did string
+	err := h.Store.InWorkspace(ctx, workspaceID(r), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, q, id, webhooks.EventPing).Scan(&did)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"delivery_id": did})
+}
+
+func decodeWebhookReq(w http.ResponseWriter, r *http.Request) (WebhookReq, bool) {
+	var in WebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return in, false
+	}
+	in.URL = strings.TrimSpace(in.URL)
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return in, false
+	}
+	// 明らかに社内を指すものはここで断る（名前で指したものは送信時に解決したアドレスで確かめる）
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if ip, err := netip.ParseAddr(host); (err == nil && !webhooks.PublicAddr(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		http.Error(w, "url must point to a public address", http.StatusBadRequest)
+		return in, false
+	}
+	if len(in.Events) == 0 {
+		http.Error(w, "events are required", http.StatusBadRequest)
+		return in, false
+	}
+	for _, e := range in.Events {
+		if !webhooks.ValidEvent(e) {
+			http.Error(w, "unknown event: "+e+" (allowed: "+strings.Join(webhooks.Events, ", ")+", *)", http.StatusBadRequest)
+			return in, false
+		}
+	}
+	if in.Secret != "" && len(in.Secret) < 16 {
+		http.Error(w, "secret must be at least 16 characters", http.StatusBadRequest)
+		return in, false
+	}
+	if in.Active == nil {
+		t := true
+		in.Active = &t
+	}
+	in.Description = strings.TrimSpace(in.Description)
+	return in, true
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeWebhookReqRejectsPrivateURL(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"https://hooks.example.com/x":              true,
+		"http://169.254.169.254/latest/meta-data/": false,
+		"http://127.0.0.1:8080/":                   false,
+		"http://[::1]/":                            false,
+		"http://10.0.0.5/hook":                     false,
+		"http://localhost:3000/":                   false,
+		"http://api.localhost./":                   false,
+		"ftp://example.com/":                       false,
+	} {
+		body := `{"url":"` + url + `","events":["*"]}`
+		w := httptest.NewRecorder()
+		_, got := decodeWebhookReq(w, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body)))
+		if got != ok || (!ok && w.Code != http.StatusBadRequest) {
+			t.Errorf("%s: ok = %v (%d %s)", url, got, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// api/internal/handlers/workspaces.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+)
+
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WorkspaceHandler struct {
+	Store *store.Store
+}
+
+func NewWorkspaceHandler(s *store.Store) *WorkspaceHandler {
+	return &WorkspaceHandler{Store: s}
+}
+
+// POST /api/workspaces  （ブートストラップキーのみ）
+// 作成後は POST /api/keys に workspace_id を付けてそのワークスペースのキーを発行する
+func (h *WorkspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	const q = `
+insert into public.workspaces (name)
+values ($1)
+returning id, name, created_at;
+`
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var ws Workspace
+	if err := h.Store.Pool.QueryRow(ctx, q, in.Name).Scan(&ws.ID, &ws.Name, &ws.CreatedAt); err != nil {
+		http.Error(w, "db insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ws)
+}
@@ -0,0 +1,388 @@
+// Package jobs は Postgres の jobs テーブルを使うバックグラウンドジョブ実行器。
+// API はトランザクション内で Enqueue するだけで、サーバ内のワーカーが
+// FOR UPDATE SKIP LOCKED で 1 件ずつ取り出して実行する（複数インスタンスでも二重実行しない）。
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ステータス（jobs.status）
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// ErrCancelled はキャンセル要求で止まったことを表す（リトライしない）
+var ErrCancelled = errors.New("job cancelled")
+
+// permanentError はリトライしても直らない失敗（入力不正など）
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent は err をリトライ対象外にする
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Job は取り出したジョブ 1 件
+type Job struct {
+	ID          string
+	WorkspaceID string
+	ImportID    *string
+	Type        string
+	Payload     json.RawMessage
+	Attempts    int // 今回を含む試行回数
+	MaxAttempts int
+	CreatedBy   *string
+}
+
+// LastAttempt は失敗したらもうリトライしないか
+func (j *Job) LastAttempt() bool { return j.Attempts >= j.MaxAttempts }
+
+// Spec は Enqueue の入力
+type Spec struct {
+	Type        string
+	ImportID    string      // 空なら null
+	Payload     interface{} // JSON にして保存（nil なら {}）
+	MaxAttempts int         // 0 なら既定（5）
+	CreatedBy   string
+}
+
+// Enqueue は tx（テナントロールのトランザクション）に jobs 行を追加して ID を返す
+// 呼び出し側の変更と一緒にコミットされるので、「保存したのにジョブが無い」状態にならない
+func Enqueue(ctx context.Context, tx pgx.Tx, s Spec) (string, error) {
+	payload := []byte("{}")
+	if s.Payload != nil {
+		b, err := json.Marshal(s.Payload)
+		if err != nil {
+			return "", err
+		}
+		payload = b
+	}
+	maxAttempts := s.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	const q = `
+insert into public.jobs (import_id, type, payload, max_attempts, created_by)
+values (nullif($1, '')::uuid, $2, $3::jsonb, $4, nullif($5, ''))
+returning id;
+`
+	var id string
+	err := tx.QueryRow(ctx, q, s.ImportID, s.Type, string(payload), maxAttempts, s.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// Handler は 1 種類のジョブの処理。返した result は jobs.result に保存される
+type Handler func(ctx context.Context, j *Job, p *Progress) (interface{}, error)
+
+// Runner はワーカープール
+type Runner struct {
+	Store    *store.Store
+	Handlers map[string]Handler
+	Workers  int
+	Logger   *slog.Logger
+
+	PollInterval      time.Duration // queued が無い時の待ち
+	HeartbeatInterval time.Duration // 実行中の生存通知・キャンセル確認
+	StaleAfter        time.Duration // これ以上 heartbeat が無い running は取り直す
+	// Backoff は attempt 回目が失敗した後の待ち時間
+	Backoff func(attempt int) time.Duration
+	// OnFinalFailure はリトライを使い切った（または Permanent な）失敗の後に呼ばれる
+	OnFinalFailure func(ctx context.Context, j *Job, err error)
+
+	workerID string
+}
+
+// NewRunner は既定値入りの Runner を返す（Handlers は Register で足す）
+func NewRunner(st *store.Store, workers int, logger *slog.Logger) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		Store:             st,
+		Handlers:          map[string]Handler{},
+		Workers:           workers,
+		Logger:            logger,
+		PollInterval:      time.Second,
+		HeartbeatInterval: 5 * time.Second,
+		StaleAfter:        time.Minute,
+		Backoff:           ExponentialBackoff(5*time.Second, 10*time.Minute),
+		workerID:          host + ":" + strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Register は type のハンドラを登録する
+func (r *Runner) Register(typ string, h Handler) {
+	r.Handlers[typ] = h
+}
+
+// ExponentialBackoff は base × 2^(attempt-1)（上限 max）
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(attempt int) time.Duration {
+		if attempt < 1 {
+			attempt = 1
+		}
+		d := time.Duration(float64(base) * math.Pow(2, float64(attempt-1)))
+		if d <= 0 || d > max {
+			return max
+		}
+		return d
+	}
+}
+
+// Run は ctx が終わるまでワーカーを動かす（実行中のジョブは ctx キャンセルで中断され、再キューされる）
+func (r *Runner) Run(ctx context.Context) {
+	if r.Logger == nil {
+		r.Logger = slog.Default()
+	}
+	workers := r.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			r.work(ctx, fmt.Sprintf("%s#%d", r.workerID, n))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, worker string) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.requeueStale(ctx); err != nil && ctx.Err() == nil {
+			r.Logger.Error("requeue stale jobs failed", "err", err)
+		}
+		j, err := r.claim(ctx, worker)
+		if err != nil && ctx.Err() == nil {
+			r.Logger.Error("claim job failed", "err", err)
+		}
+		if j == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.PollInterval):
+			}
+			continue
+		}
+		r.execute(ctx, j)
+	}
+}
+
+// claim は実行可能な queued を 1 件 running にして返す（無ければ nil）
+// ワーカーはテナントロールを使わない（全ワークスペースのジョブを扱う）。処理の中で InWorkspace する
+func (r *Runner) claim(ctx context.Context, worker string) (*Job, error) {
+	const q = `
+update public.jobs j
+set status = 'running', attempts = j.attempts + 1, locked_by = $1,
+    locked_at = now(), heartbeat_at = now(), last_error = null
+where j.id = (
+  select id from public.jobs
+  where status = 'queued' and run_at <= now()
+  order by run_at, created_at
+  for update skip locked
+  limit 1
+)
+returning j.id, j.workspace_id, j.import_id, j.type, j.payload, j.attempts, j.max_attempts, j.created_by;
+`
+	var j Job
+	err := r.Store.Pool.QueryRow(ctx, q, worker).Scan(&j.ID, &j.WorkspaceID, &j.ImportID, &j.Type, &j.Payload, &j.Attempts, &j.MaxAttempts, &j.CreatedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// requeueStale は heartbeat が途絶えた running（プロセスが落ちた等）を queued に戻す
+// 試行回数を使い切ったものは failed にし、finish と同じく OnFinalFailure に渡す
+func (r *Runner) requeueStale(ctx context.Context) error {
+	failed, err := r.markStale(ctx)
+	if err != nil {
+		return err
+	}
+	for _, j := range failed {
+		r.Logger.Error("job failed", "job_id", j.ID, "type", j.Type, "attempt", j.Attempts, "err", errWorkerLost)
+		if r.OnFinalFailure != nil {
+			uctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			r.OnFinalFailure(uctx, j, errWorkerLost)
+			cancel()
+		}
+	}
+	return nil
+}
+
+// errWorkerLost は heartbeat が途絶えたジョブの失敗理由
+var errWorkerLost = errors.New("worker lost (no heartbeat)")
+
+// markStale は途絶えた running を queued / failed にし、failed にしたものを返す
+func (r *Runner) markStale(ctx context.Context) ([]*Job, error) {
+	const q = `
+update public.jobs
+set status = case when attempts >= max_attempts then 'failed' else 'queued' end,
+    locked_by = null, last_error = $2,
+    finished_at = case when attempts >= max_attempts then now() else null end
+where status = 'running' and heartbeat_at < now() - make_interval(secs => $1)
+returning id, workspace_id, import_id, type, payload, attempts, max_attempts, created_by, status;
+`
+	rows, err := r.Store.Pool.Query(ctx, q, r.StaleAfter.Seconds(), errWorkerLost.Error())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var failed []*Job
+	for rows.Next() {
+		var j Job
+		var status string
+		if err := rows.Scan(&j.ID, &j.WorkspaceID, &j.ImportID, &j.Type, &j.Payload, &j.Attempts, &j.MaxAttempts, &j.CreatedBy, &status); err != nil {
+			return nil, err
+		}
+		if status == StatusFailed {
+			failed = append(failed, &j)
+		}
+	}
+	return failed, rows.Err()
+}
+
+func (r *Runner) execute(ctx context.Context, j *Job) {
+	log := r.Logger.With("job_id", j.ID, "type", j.Type, "attempt", j.Attempts)
+
+	h, ok := r.Handlers[j.Type]
+	if !ok {
+		r.finish(ctx, j, nil, Permanent(fmt.Errorf("no handler for job type %q", j.Type)), log)
+		return
+	}
+
+	jctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p := &Progress{store: r.Store, jobID: j.ID, cancel: cancel}
+
+	// heartbeat（兼キャンセル確認）
+	hbDone := make(chan struct{})
+	go func() {
+		defer close(hbDone)
+		t := time.NewTicker(r.HeartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-jctx.Done():
+				return
+			case <-t.C:
+				p.heartbeat(jctx)
+			}
+		}
+	}()
+
+	result, err := runHandler(jctx, h, j, p)
+	cancel()
+	<-hbDone
+	_ = p.flush(ctx)
+
+	if err != nil && p.cancelled() {
+		err = ErrCancelled
+	}
+	r.finish(ctx, j, result, err, log)
+}
+
+// runHandler はハンドラの panic をジョブの失敗として扱う
+func runHandler(ctx context.Context, h Handler, j *Job, p *Progress) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return h(ctx, j, p)
+}
+
+// finish は結果に応じて succeeded / queued（リトライ）/ failed / cancelled にする
+func (r *Runner) finish(ctx context.Context, j *Job, result interface{}, err error, log *slog.Logger) {
+	// サーバ停止で中断されたものは試行回数を戻して再キュー
+	if err != nil && ctx.Err() != nil {
+		const q = `update public.jobs set status = 'queued', attempts = greatest(attempts - 1, 0), locked_by = null where id = $1`
+		if _, e := r.Store.Pool.Exec(context.Background(), q, j.ID); e != nil {
+			log.Error("requeue on shutdown failed", "err", e)
+		}
+		return
+	}
+
+	var q string
+	args := []interface{}{j.ID}
+	var perm permanentError
+	final := false
+	switch {
+	case err == nil:
+		b, e := json.Marshal(result)
+		if e != nil {
+			b = []byte("null")
+		}
+		q = `update public.jobs set status = 'succeeded', progress = 100, result = $2::jsonb, locked_by = null, finished_at = now() where id = $1`
+		args = append(args, string(b))
+		log.Info("job succeeded")
+	case errors.Is(err, ErrCancelled):
+		q = `update public.jobs set status = 'cancelled', locked_by = null, finished_at = now() where id = $1`
+		log.Info("job cancelled")
+	case errors.As(err, &perm) || j.LastAttempt():
+		q = `update public.jobs set status = 'failed', last_error = $2, locked_by = null, finished_at = now() where id = $1`
+		args = append(args, err.Error())
+		final = true
+		log.Error("job failed", "err", err)
+	default:
+		q = `update public.jobs set status = 'queued', last_error = $2, run_at = now() + make_interval(secs => $3), locked_by = null where id = $1`
+		backoff := r.Backoff(j.Attempts)
+		args = append(args, err.Error(), backoff.Seconds())
+		log.Warn("job failed, will retry", "err", err, "backoff", backoff)
+	}
+
+	uctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, e := r.Store.Pool.Exec(uctx, q, args...); e != nil {
+		log.Error("update job status failed", "err", e)
+	}
+	if final && r.OnFinalFailure != nil {
+		r.OnFinalFailure(uctx, j, err)
+	}
+}
+
+// Cancel はジョブのキャンセルを要求する（queued は即 cancelled、running はワーカーが次の確認で止める）
+// 戻り値は変更後のステータス。終了済みなら変更せずそのステータスを返す
+func Cancel(ctx context.Context, tx pgx.Tx, id string) (string, error) {
+	const q = `
+update public.jobs
+set status = case when status = 'queued' then 'cancelled' else status end,
+    cancel_requested = status in ('queued', 'running'),
+    finished_at = case when status = 'queued' then now() else finished_at end
+where id = $1
+returning status;
+`
+	var status string
+	err := tx.QueryRow(ctx, q, id).Scan(&status)
+	return status, err
+}
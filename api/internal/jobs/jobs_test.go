@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(5*time.Second, time.Minute)
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := b(i); got != w {
+			t.Fatalf("attempt %d: got %v, want %v", i, got, w)
+		}
+	}
+	// 大きな attempt でも溢れずに上限
+	if got := b(200); got != time.Minute {
+		t.Fatalf("attempt 200: got %v", got)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("bad input")
+	err := Permanent(base)
+	var perm permanentError
+	if !errors.As(err, &perm) || !errors.Is(err, base) {
+		t.Fatalf("Permanent should wrap: %v", err)
+	}
+	if Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) should be nil")
+	}
+}
+
+func TestCountersPercent(t *testing.T) {
+	cases := []struct {
+		c    Counters
+		want float64
+	}{
+		{Counters{}, 0},
+		{Counters{Total: 4, Done: 1}, 25},
+		{Counters{Total: 4, Done: 9}, 100},
+		{Counters{Percent: 42}, 42},
+	}
+	for _, c := range cases {
+		if got := c.c.percent(); got != c.want {
+			t.Fatalf("%+v: got %v, want %v", c.c, got, c.want)
+		}
+	}
+}
+
+// マイグレーション適用済みの DB が必要（TEST_DATABASE_URL、store のテストと同じ）
+func TestRequeueStaleFinalFailure(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	st, err := store.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+	var ws string
+	if err := st.Pool.QueryRow(ctx, `insert into public.workspaces (name) values ('jobs-stale') returning id`).Scan(&ws); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = st.Pool.Exec(context.Background(), `delete from public.workspaces where id = $1`, ws) }()
+
+	// 使い切ったもの（1/1）とまだ残っているもの（1/3）を、heartbeat が途絶えた running にする
+	var exhausted, retry string
+	err = st.InWorkspace(ctx, ws, func(tx pgx.Tx) error {
+		var err error
+		if exhausted, err = Enqueue(ctx, tx, Spec{Type: "parse", MaxAttempts: 1}); err != nil {
+			return err
+		}
+		retry, err = Enqueue(ctx, tx, Spec{Type: "parse", MaxAttempts: 3})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.Pool.Exec(ctx, `
+update public.jobs set status = 'running', attempts = 1, heartbeat_at = now() - interval '1 hour'
+where id = any($1)`, []string{exhausted, retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(st, 1, slog.Default())
+	var failed []string
+	r.OnFinalFailure = func(_ context.Context, j *Job, err error) {
+		if j.WorkspaceID == ws {
+			failed = append(failed, j.ID)
+		}
+	}
+	if err := r.requeueStale(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0] != exhausted {
+		t.Fatalf("OnFinalFailure got %v, want [%s]", failed, exhausted)
+	}
+	for id, want := range map[string]string{exhausted: StatusFailed, retry: StatusQueued} {
+		var status string
+		if err := st.Pool.QueryRow(ctx, `select status from public.jobs where id = $1`, id).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status != want {
+			t.Fatalf("job %s: got %s, want %s", id, status, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// api/internal/jobs/progress.go
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"csv-import-kit/api/internal/store"
+)
+
+// Counters はジョブの進捗（jobs.rows_* / progress）
+type Counters struct {
+	Total   int     `json:"rows_total"`
+	Done    int     `json:"rows_done"`
+	Failed  int     `json:"rows_failed"`
+	Percent float64 `json:"progress"` // 0 なら Done/Total から計算
+}
+
+// percent は 0〜100 に丸めた進捗率
+func (c Counters) percent() float64 {
+	p := c.Percent
+	if p == 0 && c.Total > 0 {
+		p = float64(c.Done) / float64(c.Total) * 100
+	}
+	switch {
+	case p < 0:
+		return 0
+	case p > 100:
+		return 100
+	}
+	return p
+}
+
+// Progress はハンドラから進捗を報告するためのもの
+// 毎行書くと重いので、DB へは minInterval ごと（と終了時）にまとめて書く
+type Progress struct {
+	store  *store.Store
+	jobID  string
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	cur         Counters
+	dirty       bool
+	lastFlush   time.Time
+	isCancelled bool
+}
+
+const minFlushInterval = 500 * time.Millisecond
+
+// Report は現在の進捗を記録する（一定間隔で DB に反映）
+func (p *Progress) Report(ctx context.Context, c Counters) error {
+	p.mu.Lock()
+	p.cur = c
+	p.dirty = true
+	due := time.Since(p.lastFlush) >= minFlushInterval
+	p.mu.Unlock()
+	if due {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// Current は最後に報告された進捗
+func (p *Progress) Current() Counters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cur
+}
+
+func (p *Progress) flush(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.dirty || p.store == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	c := p.cur
+	p.dirty = false
+	p.lastFlush = time.Now()
+	p.mu.Unlock()
+
+	const q = `
+update public.jobs
+set progress = $2, rows_total = $3, rows_done = $4, rows_failed = $5, heartbeat_at = now()
+where id = $1;
+`
+	_, err := p.store.Pool.Exec(ctx, q, p.jobID, c.percent(), c.Total, c.Done, c.Failed)
+	return err
+}
+
+// heartbeat は生存を記録し、キャンセル要求があればハンドラの ctx を止める
+func (p *Progress) heartbeat(ctx context.Context) {
+	_ = p.flush(ctx)
+	var requested bool
+	err := p.store.Pool.QueryRow(ctx,
+		`update public.jobs set heartbeat_at = now() where id = $1 returning cancel_requested`, p.jobID).Scan(&requested)
+	if err == nil && requested {
+		p.mu.Lock()
+		p.isCancelled = true
+		p.mu.Unlock()
+		p.cancel()
+	}
+}
+
+func (p *Progress) cancelled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isCancelled
+}
@@ -0,0 +1,294 @@
+// api/internal/spreadsheet/ods.go
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenDocument の名前空間
+const (
+	nsOffice = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	nsTable  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	nsText   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// ODSMimeType は .ods の mimetype ファイルの中身
+const ODSMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// IsODS は zip の先頭に置かれる mimetype で .ods か見る
+func IsODS(b []byte) bool {
+	return len(b) > 38 && bytes.HasPrefix(b, []byte("PK\x03\x04")) && bytes.Contains(b[:min(len(b), 128)], []byte(ODSMimeType))
+}
+
+// ReadODS は .ods のシートを行の配列にする
+// 数式のセルは保存時に計算された値（office:value など）を使う
+func ReadODS(b []byte, opts Options) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("not an OpenDocument file: %w", err)
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+			break
+		}
+	}
+	if content == nil {
+		return nil, errors.New("content.xml is missing")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	dec := xml.NewDecoder(rc)
+	var names []string
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Space != nsTable || se.Name.Local != "table" {
+			continue
+		}
+		name := attr(se, nsTable, "name")
+		names = append(names, name)
+		if !odsWanted(opts.Sheet, name, len(names)-1) {
+			if err := dec.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return readODSTable(dec)
+	}
+	_, err = pickSheet(names, opts.Sheet)
+	if err == nil {
+		err = ErrSheetNotFound
+	}
+	return nil, err
+}
+
+// odsWanted はシート名 / 番号の指定に当たるか（名前を優先）
+func odsWanted(want, name string, index int) bool {
+	if want == "" {
+		return index == 0
+	}
+	if want == name {
+		return true
+	}
+	i, err := strconv.Atoi(want)
+	return err == nil && i == index
+}
+
+func attr(se xml.StartElement, space, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// repeat は number-*-repeated（無ければ 1）
+func repeat(se xml.StartElement, local string) int {
+	n, err := strconv.Atoi(attr(se, nsTable, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// readODSTable は table:table の中身を読む（末尾の空行・空セルの大量の繰り返しは位置だけ進める）
+func readODSTable(dec *xml.Decoder) ([][]string, error) {
+	g := newGrid()
+	row := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != nsTable || t.Name.Local != "table-row" {
+				continue // table-header-rows / table-row-group などは中の行をそのまま読む
+			}
+			cells, err := readODSRow(dec)
+			if err != nil {
+				return nil, err
+			}
+			n := repeat(t, "number-rows-repeated")
+			if len(cells) == 0 {
+				row += n
+				continue
+			}
+			// 値のある行の繰り返しは、展開する前にセル数の上限と行数の上限を見る
+			if row+n > MaxRows {
+				return nil, fmt.Errorf("sheet is longer than %d rows", MaxRows)
+			}
+			if !g.fits(n * len(cells)) {
+				return nil, ErrTooManyCells
+			}
+			for i := 0; i < n; i++ {
+				for c, v := range cells {
+					if err := g.set(row, c, v); err != nil {
+						return nil, err
+					}
+				}
+				row++
+			}
+		case xml.EndElement:
+			if t.Name.Space == nsTable && t.Name.Local == "table" {
+				return g.records(), nil
+			}
+		}
+	}
+}
+
+// readODSRow は 1 行のセル（列位置 → 値）を読む
+func readODSRow(dec *xml.Decoder) (map[int]string, error) {
+	cells := map[int]string{}
+	col := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != nsTable || (t.Name.Local != "table-cell" && t.Name.Local != "covered-table-cell") {
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			v, err := odsCellValue(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			n := repeat(t, "number-columns-repeated")
+			if v == "" {
+				col += n
+				continue
+			}
+			if col+n > MaxCols {
+				return nil, fmt.Errorf("sheet is wider than %d columns", MaxCols)
+			}
+			for i := 0; i < n; i++ {
+				cells[col] = v
+				col++
+			}
+		case xml.EndElement:
+			if t.Name.Local == "table-row" {
+				return cells, nil
+			}
+		}
+	}
+}
+
+// odsCellValue はセルの値（型つきの属性があればそれ、無ければ段落のテキスト）
+func odsCellValue(dec *xml.Decoder, se xml.StartElement) (string, error) {
+	text, err := odsCellText(dec)
+	if err != nil {
+		return "", err
+	}
+	switch attr(se, nsOffice, "value-type") {
+	case "float", "percentage", "currency":
+		if f, err := strconv.ParseFloat(attr(se, nsOffice, "value"), 64); err == nil {
+			return formatNumber(f), nil
+		}
+	case "date":
+		return odsDate(attr(se, nsOffice, "date-value")), nil
+	case "time":
+		return odsDuration(attr(se, nsOffice, "time-value")), nil
+	case "boolean":
+		return strconv.FormatBool(attr(se, nsOffice, "boolean-value") == "true"), nil
+	case "string":
+		if v := attr(se, nsOffice, "string-value"); v != "" {
+			return v, nil
+		}
+	}
+	return text, nil
+}
+
+// odsCellText は text:p を改行でつなぐ（text:s は空白、text:tab はタブ、コメント office:annotation は除く）
+func odsCellText(dec *xml.Decoder) (string, error) {
+	var b strings.Builder
+	paragraphs := 0
+	depth := 1
+	for depth > 0 {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == nsOffice && t.Name.Local == "annotation":
+				if err := dec.Skip(); err != nil {
+					return "", err
+				}
+				continue
+			case t.Name.Space == nsText && t.Name.Local == "p":
+				if paragraphs > 0 {
+					b.WriteByte('\n')
+				}
+				paragraphs++
+			case t.Name.Space == nsText && t.Name.Local == "s":
+				n, err := strconv.Atoi(attr(t, nsText, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				b.WriteString(strings.Repeat(" ", min(n, 1024)))
+			case t.Name.Space == nsText && t.Name.Local == "tab":
+				b.WriteByte('\t')
+			case t.Name.Space == nsText && t.Name.Local == "line-break":
+				b.WriteByte('\n')
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if paragraphs > 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// odsDate は "2024-01-02" / "2024-01-02T10:30:00.123" を日付 / 日時にそろえる
+func odsDate(v string) string {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+				return t.Format("2006-01-02")
+			}
+			return t.Format("2006-01-02 15:04:05")
+		}
+	}
+	return v
+}
+
+// odsDuration は "PT10H30M00S" を "10:30:00" にする
+func odsDuration(v string) string {
+	var h, m int
+	var s float64
+	if _, err := fmt.Sscanf(v, "PT%dH%dM%fS", &h, &m, &s); err != nil {
+		return v
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, int(s+0.5))
+}
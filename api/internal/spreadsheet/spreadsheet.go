@@ -0,0 +1,149 @@
+// Package spreadsheet は表計算ファイル（OpenDocument .ods / Excel 97-2003 .xls）を外部コマンドなしで行の配列にする。
+// 値は表示用の書式ではなく中身で返す（数値は元の精度、日付は "2006-01-02" / "2006-01-02 15:04:05"、数式はキャッシュされた結果）。
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSheetNotFound は指定したシートが無い
+	ErrSheetNotFound = errors.New("sheet not found")
+	// ErrEncrypted はパスワード付きのブック
+	ErrEncrypted = errors.New("workbook is password protected")
+	// ErrTooManyCells は値のあるセルが MaxCells を超えた
+	ErrTooManyCells = fmt.Errorf("sheet has more than %d non-empty cells", MaxCells)
+)
+
+// 読み込む範囲の上限（繰り返し指定や壊れたファイルでメモリを使い切らないため）
+// MaxCells はシート全体で値を持てるセルの数（数百バイトの .ods でも行・列の繰り返しを掛けると億単位になる）
+const (
+	MaxRows  = 1 << 20
+	MaxCols  = 1 << 14
+	MaxCells = 4_000_000
+)
+
+// Options は読み込むシート（名前か 0 始まりの番号。空なら先頭のワークシート）
+type Options struct {
+	Sheet string
+}
+
+// pickSheet は names から opts.Sheet に当たる位置を返す
+func pickSheet(names []string, want string) (int, error) {
+	if len(names) == 0 {
+		return 0, ErrSheetNotFound
+	}
+	if want == "" {
+		return 0, nil
+	}
+	for i, n := range names {
+		if n == want {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(want); err == nil && i >= 0 && i < len(names) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("%w: %q (sheets: %s)", ErrSheetNotFound, want, strings.Join(names, ", "))
+}
+
+// formatNumber は浮動小数点の誤差（0.30000000000000004）を Excel と同じ 15 桁で丸めて返す
+func formatNumber(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return ""
+	}
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(r, 'f', -1, 64)
+}
+
+// formatSerial は Excel の日付シリアル値を文字列にする（時刻だけなら "15:04:05"）
+// 1900 年系は 1900-02-29 が実在する扱い（Lotus 互換のバグ）なので 60 以下は 1 日ずらす
+func formatSerial(v float64, date1904 bool) string {
+	if v < 0 {
+		return formatNumber(v)
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	switch {
+	case date1904:
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	case v < 61:
+		base = time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(v)
+	secs := math.Round((v - days) * 86400)
+	t := base.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	switch {
+	case days == 0 && !date1904:
+		return t.Format("15:04:05")
+	case secs == 0:
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// grid は (行, 列) → 値を集めて、空行を除いた行の配列にする
+type grid struct {
+	rows  map[int]map[int]string
+	max   int
+	cells int // 値のあるセルの数（MaxCells まで）
+}
+
+func newGrid() *grid { return &grid{rows: map[int]map[int]string{}, max: -1} }
+
+func (g *grid) set(row, col int, v string) error {
+	if v == "" {
+		return nil
+	}
+	if row >= MaxRows || col >= MaxCols {
+		return fmt.Errorf("sheet is larger than %d rows x %d columns", MaxRows, MaxCols)
+	}
+	r := g.rows[row]
+	if r == nil {
+		r = map[int]string{}
+		g.rows[row] = r
+	}
+	if _, ok := r[col]; !ok {
+		if !g.fits(1) {
+			return ErrTooManyCells
+		}
+		g.cells++
+	}
+	r[col] = v
+	if row > g.max {
+		g.max = row
+	}
+	return nil
+}
+
+// fits は n 個のセルをまだ足せるか（繰り返しを展開する前に見る）
+func (g *grid) fits(n int) bool {
+	return n >= 0 && n <= MaxCells-g.cells
+}
+
+// records は空行を飛ばした行（各行は最後の値のある列まで）
+func (g *grid) records() [][]string {
+	out := make([][]string, 0, len(g.rows))
+	for i := 0; i <= g.max; i++ {
+		cells := g.rows[i]
+		if len(cells) == 0 {
+			continue
+		}
+		n := 0
+		for c := range cells {
+			if c+1 > n {
+				n = c + 1
+			}
+		}
+		rec := make([]string, n)
+		for c, v := range cells {
+			rec[c] = v
+		}
+		out = append(out, rec)
+	}
+	return out
+}
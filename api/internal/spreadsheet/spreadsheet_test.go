@@ -0,0 +1,329 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestFormatSerial(t *testing.T) {
+	cases := []struct {
+		v    float64
+		d    bool
+		want string
+	}{
+		{45292, false, "2024-01-01"},
+		{45292.5, false, "2024-01-01 12:00:00"},
+		{0.75, false, "18:00:00"},
+		{1, false, "1900-01-01"},
+		{61, false, "1900-03-01"},
+		{0, true, "1904-01-01"},
+	}
+	for _, c := range cases {
+		if got := formatSerial(c.v, c.d); got != c.want {
+			t.Errorf("formatSerial(%v, %v) = %q, want %q", c.v, c.d, got, c.want)
+		}
+	}
+	if got := formatNumber(0.1 + 0.2); got != "0.3" {
+		t.Errorf("formatNumber = %q", got)
+	}
+}
+
+// odsFile は content.xml の table 部分から .ods を作る
+func odsFile(t *testing.T, tables string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	_, _ = w.Write([]byte(ODSMimeType))
+	w, _ = zw.Create("content.xml")
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>` + tables + `</office:spreadsheet></office:body></office:document-content>`))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadODS(t *testing.T) {
+	b := odsFile(t, `
+<table:table table:name="メモ"><table:table-row><table:table-cell office:value-type="string"><text:p>skip</text:p></table:table-cell></table:table-row></table:table>
+<table:table table:name="売上">
+  <table:table-row>
+    <table:table-cell office:value-type="string"><text:p>日付</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>商品</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>金額</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>済</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row>
+    <table:table-cell office:value-type="date" office:date-value="2024-01-02"><text:p>2024/1/2</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>りんご<text:s text:c="2"/>箱</text:p><text:p>2 行目</text:p><office:annotation><text:p>comment</text:p></office:annotation></table:table-cell>
+    <table:table-cell table:formula="of:=[.X1]*2" office:value-type="float" office:value="0.30000000000000004"><text:p>0.3</text:p></table:table-cell>
+    <table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="3"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+  <table:table-row>
+    <table:table-cell office:value-type="date" office:date-value="2024-01-03T09:30:00"/>
+    <table:table-cell table:number-columns-repeated="2" office:value-type="string"><text:p>x</text:p></table:table-cell>
+    <table:table-cell office:value-type="time" office:time-value="PT10H05M00S"/>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>
+</table:table>`)
+	if !IsODS(b) {
+		t.Fatal("IsODS = false")
+	}
+	got, err := ReadODS(b, Options{Sheet: "売上"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"日付", "商品", "金額", "済"},
+		{"2024-01-02", "りんご  箱\n2 行目", "0.3", "true"},
+		{"2024-01-03 09:30:00", "x", "x", "10:05:00"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got, err := ReadODS(b, Options{}); err != nil || !reflect.DeepEqual(got, [][]string{{"skip"}}) {
+		t.Fatalf("first sheet = %q, %v", got, err)
+	}
+	if got, err := ReadODS(b, Options{Sheet: "1"}); err != nil || len(got) != 3 {
+		t.Fatalf("sheet by index = %q, %v", got, err)
+	}
+	if _, err := ReadODS(b, Options{Sheet: "なし"}); !errors.Is(err, ErrSheetNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// biff は BIFF8 のレコードを並べる
+type biff struct{ bytes.Buffer }
+
+func (b *biff) rec(typ uint16, data ...[]byte) {
+	d := bytes.Join(data, nil)
+	_ = binary.Write(&b.Buffer, binary.LittleEndian, [2]uint16{typ, uint16(len(d))})
+	b.Write(d)
+}
+
+func u16(v ...uint16) []byte {
+	out := make([]byte, 2*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint16(out[2*i:], x)
+	}
+	return out
+}
+
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+func f64(v float64) []byte { return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)) }
+
+// wide は UTF-16 の XLUnicodeString（長さ 2 バイト）
+func wide(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	out := append(u16(uint16(len(u))), 1)
+	for _, c := range u {
+		out = binary.LittleEndian.AppendUint16(out, c)
+	}
+	return out
+}
+
+// cfbFile は stream を "Workbook" として 512 バイトセクタの CFB に入れる（4096 バイト以上に詰める）
+func cfbFile(stream []byte) []byte {
+	if len(stream) < 4096 {
+		stream = append(stream, make([]byte, 4096-len(stream))...)
+	}
+	n := (len(stream) + 511) / 512
+	out := make([]byte, 512*(3+n))
+	le := binary.LittleEndian
+	copy(out, cfbSignature)
+	le.PutUint16(out[0x18:], 0x3E)
+	le.PutUint16(out[0x1A:], 3)
+	le.PutUint16(out[0x1C:], 0xFFFE)
+	le.PutUint16(out[0x1E:], 9)
+	le.PutUint16(out[0x20:], 6)
+	le.PutUint32(out[0x2C:], 1)
+	le.PutUint32(out[0x30:], 1) // ディレクトリはセクタ 1
+	le.PutUint32(out[0x38:], 4096)
+	le.PutUint32(out[0x3C:], cfbEndOfChain)
+	le.PutUint32(out[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(out[0x4C+4*i:], cfbFree)
+	}
+	le.PutUint32(out[0x4C:], 0) // FAT はセクタ 0
+
+	fat := out[512:1024]
+	for i := 0; i < 128; i++ {
+		le.PutUint32(fat[4*i:], cfbFree)
+	}
+	le.PutUint32(fat[0:], 0xFFFFFFFD)
+	le.PutUint32(fat[4:], cfbEndOfChain)
+	for i := 0; i < n; i++ {
+		next := uint32(3 + i)
+		if i == n-1 {
+			next = cfbEndOfChain
+		}
+		le.PutUint32(fat[4*(2+i):], next)
+	}
+
+	dir := out[1024:1536]
+	entry := func(d []byte, name string, typ byte, start, size uint32) {
+		u := utf16.Encode([]rune(name))
+		for i, c := range u {
+			le.PutUint16(d[2*i:], c)
+		}
+		le.PutUint16(d[64:], uint16(2*len(u)+2))
+		d[66] = typ
+		le.PutUint32(d[116:], start)
+		le.PutUint32(d[120:], size)
+	}
+	entry(dir[0:128], "Root Entry", 5, cfbEndOfChain, 0)
+	entry(dir[128:256], "Workbook", 2, 2, uint32(len(stream)))
+	copy(out[1536:], stream)
+	return out
+}
+
+// xlsFile は 2 シート（Data と Other）の BIFF8 ブックを作る
+func xlsFile(t *testing.T, encrypted bool) []byte {
+	t.Helper()
+	bof := func(b *biff, dt uint16) { b.rec(recBOF, u16(0x0600, dt), make([]byte, 12)) }
+	sheet := func(cells func(*biff)) []byte {
+		var s biff
+		bof(&s, 0x10)
+		cells(&s)
+		s.rec(recEOF)
+		return s.Bytes()
+	}
+	data := sheet(func(s *biff) {
+		s.rec(recLabelSST, u16(0, 0, 0), u32(0))
+		s.rec(recLabelSST, u16(0, 1, 0), u32(1))
+		s.rec(recLabelSST, u16(0, 2, 0), u32(2))
+		s.rec(recNumber, u16(1, 0, 1), f64(45292)) // XF 1 = 組み込みの日付書式 14
+		s.rec(recLabel, u16(1, 1, 0), wide("東京"))
+		s.rec(recRK, u16(1, 2, 0), u32(1234<<2|0x02|0x01))                                                              // 12.34
+		s.rec(recMulRK, u16(3, 0), u16(0), u32(7<<2|0x02), u16(2), u32(uint32(math.Float64bits(45292.25)>>32)), u16(1)) // 45292.25 は double の上位 30 ビットで表せる
+		s.rec(recFormula, u16(4, 0, 0), []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}, make([]byte, 6))
+		s.rec(recString, wide("計算結果"))
+		s.rec(recFormula, u16(4, 1, 0), f64(0.1+0.2), make([]byte, 6))
+		s.rec(recBoolErr, u16(4, 2, 0), []byte{1, 0})
+		s.rec(recBoolErr, u16(4, 3, 0), []byte{0x07, 1})
+	})
+	other := sheet(func(s *biff) {
+		s.rec(recLabel, u16(0, 0, 0), wide("other"))
+	})
+
+	// グローバル。BOUNDSHEET の位置はシートの BOF のオフセット
+	globals := func(offData, offOther uint32) []byte {
+		var g biff
+		bof(&g, 0x05)
+		if encrypted {
+			g.rec(recFilePass, u16(1), make([]byte, 52))
+		}
+		g.rec(recFormat, u16(164), wide(`yyyy"年"m"月"`))
+		g.rec(recXF, u16(0, 0), make([]byte, 16))
+		g.rec(recXF, u16(0, 14), make([]byte, 16))
+		g.rec(recXF, u16(0, 164), make([]byte, 16))
+		g.rec(recBoundSheet, u32(offData), []byte{0, 0, 4, 0}, []byte("Data"))
+		g.rec(recBoundSheet, u32(offOther), []byte{0, 0, 5, 0}, []byte("Other"))
+		// SST。3 つ目の文字列は CONTINUE をまたぎ、続きは 1 バイト文字（フラグ 0）
+		g.rec(recSST, u32(3), u32(3), wide("日付"), wide("支店"), u16(7), []byte{1}, utf16le("金額"))
+		g.rec(recContinue, []byte{0}, []byte("(JPY)"))
+		g.rec(recEOF)
+		return g.Bytes()
+	}
+	n := uint32(len(globals(0, 0)))
+	wb := append(globals(n, n+uint32(len(data))), data...)
+	wb = append(wb, other...)
+	return cfbFile(wb)
+}
+
+func utf16le(s string) []byte {
+	var out []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, c)
+	}
+	return out
+}
+
+func TestReadXLS(t *testing.T) {
+	b := xlsFile(t, false)
+	if !IsXLS(b) {
+		t.Fatal("IsXLS = false")
+	}
+	got, err := ReadXLS(b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"日付", "支店", "金額(JPY)"},
+		{"2024-01-01", "東京", "12.34"},
+		{"7", "2024-01-01 06:00:00"},
+		{"計算結果", "0.3", "true", "#DIV/0!"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got, err := ReadXLS(b, Options{Sheet: "Other"}); err != nil || !reflect.DeepEqual(got, [][]string{{"other"}}) {
+		t.Fatalf("Other = %q, %v", got, err)
+	}
+	if _, err := ReadXLS(b, Options{Sheet: "5"}); !errors.Is(err, ErrSheetNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := ReadXLS(xlsFile(t, true), Options{}); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestIsDateFormatCode(t *testing.T) {
+	for f, want := range map[string]bool{
+		"General":            false,
+		"#,##0.00":           false,
+		"0.00E+00":           false,
+		`"yen"#,##0`:         false,
+		`[Red]#,##0;-#,##0`:  false,
+		"yyyy/mm/dd":         true,
+		"[h]:mm:ss":          true,
+		`ggge"年"m"月"d"日"`:    true,
+		`[$-411]yyyy"年"m"月"`: true,
+	} {
+		if got := isDateFormatCode(f); got != want {
+			t.Errorf("isDateFormatCode(%q) = %v", f, got)
+		}
+	}
+}
+
+func TestReadODSRepeatBomb(t *testing.T) {
+	// 数百バイトで 2^20 行 × 2^14 列の値を持つシート（展開すると 1.7e10 セル）
+	b := odsFile(t, `
+<table:table table:name="bomb">
+  <table:table-row table:number-rows-repeated="1048575"><table:table-cell table:number-columns-repeated="16384" office:value-type="string"><text:p>x</text:p></table:table-cell></table:table-row>
+</table:table>`)
+	if _, err := ReadODS(b, Options{}); !errors.Is(err, ErrTooManyCells) {
+		t.Fatalf("err = %v, want ErrTooManyCells", err)
+	}
+}
+
+func TestReadSSTHugeLength(t *testing.T) {
+	// 拡張データの長さ（ext）に 4 GB 近い値。確保する前に足りないと分かる
+	sst := bytes.Join([][]byte{u32(1), u32(1), u16(1), {0x04}, u32(0xFFFFFFFF), []byte("a")}, nil)
+	if _, err := readSST([][]byte{sst}); err == nil {
+		t.Fatal("expected an error for a truncated extension block")
+	}
+	if n := testing.AllocsPerRun(10, func() { _, _ = readSST([][]byte{sst}) }); n > 20 {
+		t.Fatalf("allocs = %v", n)
+	}
+}
+
+func FuzzReadSST(f *testing.F) {
+	f.Add(bytes.Join([][]byte{u32(1), u32(1), u16(2), {0}, []byte("ab")}, nil), []byte{})
+	f.Add(bytes.Join([][]byte{u32(1), u32(1), u16(1), {0x0c}, u16(3), u32(0xFFFFFFFF), []byte("a")}, nil), []byte{1, 'b'})
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		_, _ = readSST([][]byte{a, b})
+	})
+}
@@ -0,0 +1,630 @@
+// api/internal/spreadsheet/xls.go
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// 複合ドキュメント（CFB）のシグネチャ
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// IsXLS は CFB のシグネチャで .xls（Excel 97-2003）か見る
+func IsXLS(b []byte) bool { return bytes.HasPrefix(b, cfbSignature) }
+
+// FAT の特別な値
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbFree       = 0xFFFFFFFF
+)
+
+// ReadXLS は .xls（BIFF8）のワークシートを行の配列にする
+// 数式のセルは保存時の計算結果を使う。BIFF5 以前（Excel 95）とパスワード付きは読まない
+func ReadXLS(b []byte, opts Options) ([][]string, error) {
+	wb, err := cfbStream(b, "Workbook")
+	if err != nil {
+		return nil, err
+	}
+	book, err := readGlobals(wb)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(book.sheets))
+	for i, s := range book.sheets {
+		names[i] = s.name
+	}
+	i, err := pickSheet(names, opts.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	return book.readSheet(wb, book.sheets[i].offset)
+}
+
+// --- CFB ---
+
+// cfbStream は CFB から name のストリームを取り出す
+func cfbStream(b []byte, name string) ([]byte, error) {
+	if len(b) < 512 || !IsXLS(b) {
+		return nil, errors.New("not an Excel 97-2003 file")
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(b[0x1E:])
+	miniShift := le.Uint16(b[0x20:])
+	if shift < 7 || shift > 16 || miniShift > shift {
+		return nil, errors.New("broken compound document header")
+	}
+	ssz := 1 << shift
+	sector := func(n uint32) []byte {
+		off := (int64(n) + 1) << shift
+		if off < 0 || off+int64(ssz) > int64(len(b)) {
+			return nil
+		}
+		return b[off : off+int64(ssz)]
+	}
+
+	// FAT のセクタ番号（ヘッダの 109 個 + DIFAT の連鎖）
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if n := le.Uint32(b[0x4C+4*i:]); n != cfbFree {
+			fatSectors = append(fatSectors, n)
+		}
+	}
+	next := le.Uint32(b[0x44:])
+	for guard := 0; next != cfbEndOfChain && next != cfbFree; guard++ {
+		s := sector(next)
+		if s == nil || guard > len(b)/ssz {
+			return nil, errors.New("broken compound document DIFAT")
+		}
+		for i := 0; i < ssz/4-1; i++ {
+			if n := le.Uint32(s[4*i:]); n != cfbFree {
+				fatSectors = append(fatSectors, n)
+			}
+		}
+		next = le.Uint32(s[ssz-4:])
+	}
+	var fat []uint32
+	for _, n := range fatSectors {
+		s := sector(n)
+		if s == nil {
+			return nil, errors.New("broken compound document FAT")
+		}
+		for i := 0; i < ssz; i += 4 {
+			fat = append(fat, le.Uint32(s[i:]))
+		}
+	}
+	chain := func(table []uint32, start uint32, read func(uint32) []byte) ([]byte, error) {
+		var out []byte
+		for n, guard := start, 0; n != cfbEndOfChain; guard++ {
+			if int(n) >= len(table) || guard > len(table) {
+				return nil, errors.New("broken compound document sector chain")
+			}
+			s := read(n)
+			if s == nil {
+				return nil, errors.New("compound document is truncated")
+			}
+			out = append(out, s...)
+			n = table[n]
+		}
+		return out, nil
+	}
+
+	dir, err := chain(fat, le.Uint32(b[0x30:]), sector)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		name  string
+		typ   byte
+		start uint32
+		size  uint32
+	}
+	var root, found *entry
+	for off := 0; off+128 <= len(dir); off += 128 {
+		d := dir[off : off+128]
+		n := int(le.Uint16(d[64:]))
+		if n < 2 || n > 64 {
+			continue
+		}
+		u := make([]uint16, n/2-1)
+		for i := range u {
+			u[i] = le.Uint16(d[2*i:])
+		}
+		e := &entry{name: string(utf16.Decode(u)), typ: d[66], start: le.Uint32(d[116:]), size: le.Uint32(d[120:])}
+		switch {
+		case e.typ == 5:
+			root = e
+		case e.typ == 2 && strings.EqualFold(e.name, name):
+			found = e
+		case e.typ == 2 && e.name == "Book" && found == nil && name == "Workbook":
+			return nil, errors.New("Excel 5.0/95 workbooks are not supported; save as .xlsx or Excel 97-2003")
+		}
+	}
+	if found == nil || root == nil {
+		return nil, fmt.Errorf("%s stream is missing", name)
+	}
+
+	var data []byte
+	if found.size >= le.Uint32(b[0x38:]) {
+		if data, err = chain(fat, found.start, sector); err != nil {
+			return nil, err
+		}
+	} else {
+		// 小さいストリームはルートの mini stream にある
+		ministream, err := chain(fat, root.start, sector)
+		if err != nil {
+			return nil, err
+		}
+		minifatBytes, err := chain(fat, le.Uint32(b[0x3C:]), sector)
+		if err != nil {
+			return nil, err
+		}
+		minifat := make([]uint32, len(minifatBytes)/4)
+		for i := range minifat {
+			minifat[i] = le.Uint32(minifatBytes[4*i:])
+		}
+		msz := 1 << miniShift
+		mini := func(n uint32) []byte {
+			off := int64(n) << miniShift
+			if off+int64(msz) > int64(len(ministream)) {
+				return nil
+			}
+			return ministream[off : off+int64(msz)]
+		}
+		if data, err = chain(minifat, found.start, mini); err != nil {
+			return nil, err
+		}
+	}
+	if int(found.size) > len(data) {
+		return nil, errors.New("compound document is truncated")
+	}
+	return data[:found.size], nil
+}
+
+// --- BIFF8 ---
+
+// BIFF8 のレコード種別
+const (
+	recBOF        = 0x0809
+	recEOF        = 0x000A
+	recFilePass   = 0x002F
+	recDateMode   = 0x0022
+	recFormat     = 0x041E
+	recXF         = 0x00E0
+	recBoundSheet = 0x0085
+	recSST        = 0x00FC
+	recContinue   = 0x003C
+	recLabelSST   = 0x00FD
+	recLabel      = 0x0204
+	recNumber     = 0x0203
+	recRK         = 0x027E
+	recMulRK      = 0x00BD
+	recBoolErr    = 0x0205
+	recFormula    = 0x0006
+	recString     = 0x0207
+)
+
+// record は BIFF のレコード 1 件
+type record struct {
+	typ  uint16
+	data []byte
+}
+
+// records は off から順にレコードを返す（壊れていれば途中まで）
+func records(wb []byte, off int, fn func(record) (bool, error)) error {
+	for off+4 <= len(wb) {
+		typ := binary.LittleEndian.Uint16(wb[off:])
+		n := int(binary.LittleEndian.Uint16(wb[off+2:]))
+		if off+4+n > len(wb) {
+			return errors.New("workbook stream is truncated")
+		}
+		more, err := fn(record{typ: typ, data: wb[off+4 : off+4+n]})
+		if err != nil || !more {
+			return err
+		}
+		off += 4 + n
+	}
+	return nil
+}
+
+type xlsSheet struct {
+	name   string
+	offset int
+}
+
+// workbook はグローバル部分（共有文字列・書式・シート一覧）
+type workbook struct {
+	date1904 bool
+	sst      []string
+	formats  map[uint16]string // 独自の数値書式
+	xfFormat []uint16          // XF 番号 → 数値書式番号
+	sheets   []xlsSheet
+}
+
+func readGlobals(wb []byte) (*workbook, error) {
+	book := &workbook{formats: map[uint16]string{}}
+	var sst [][]byte // SST と続く CONTINUE
+	inSST := false
+	err := records(wb, 0, func(r record) (bool, error) {
+		if inSST && r.typ == recContinue {
+			sst = append(sst, r.data)
+			return true, nil
+		}
+		inSST = false
+		switch r.typ {
+		case recBOF:
+			if len(r.data) >= 2 && binary.LittleEndian.Uint16(r.data) != 0x0600 {
+				return false, errors.New("only Excel 97-2003 (BIFF8) workbooks are supported")
+			}
+		case recFilePass:
+			return false, ErrEncrypted
+		case recDateMode:
+			book.date1904 = len(r.data) >= 2 && binary.LittleEndian.Uint16(r.data) == 1
+		case recFormat:
+			if len(r.data) >= 2 {
+				s, _ := xlUnicodeString(r.data[2:], 2)
+				book.formats[binary.LittleEndian.Uint16(r.data)] = s
+			}
+		case recXF:
+			if len(r.data) >= 4 {
+				book.xfFormat = append(book.xfFormat, binary.LittleEndian.Uint16(r.data[2:]))
+			}
+		case recBoundSheet:
+			if len(r.data) >= 8 && r.data[5] == 0 { // 0 = ワークシート（グラフ・マクロシートは除く）
+				name, _ := xlUnicodeString(r.data[6:], 1)
+				book.sheets = append(book.sheets, xlsSheet{name: name, offset: int(binary.LittleEndian.Uint32(r.data))})
+			}
+		case recSST:
+			sst = [][]byte{r.data}
+			inSST = true
+		case recEOF:
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sst != nil {
+		if book.sst, err = readSST(sst); err != nil {
+			return nil, err
+		}
+	}
+	return book, nil
+}
+
+// xlUnicodeString は長さ（lenBytes = 1 か 2）+ フラグ + 文字の文字列を読む
+func xlUnicodeString(b []byte, lenBytes int) (string, int) {
+	if len(b) < lenBytes+1 {
+		return "", len(b)
+	}
+	n := int(b[0])
+	if lenBytes == 2 {
+		n = int(binary.LittleEndian.Uint16(b))
+	}
+	flags := b[lenBytes]
+	p := lenBytes + 1
+	return decodeChars(b[p:], n, flags&1 != 0)
+}
+
+// decodeChars は n 文字を読み、文字列と使ったバイト数を返す（wide = UTF-16LE、それ以外は Latin-1）
+func decodeChars(b []byte, n int, wide bool) (string, int) {
+	if !wide {
+		n = min(n, len(b))
+		r := make([]rune, n)
+		for i := 0; i < n; i++ {
+			r[i] = rune(b[i])
+		}
+		return string(r), n
+	}
+	n = min(n, len(b)/2)
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u)), 2 * n
+}
+
+// segments は CONTINUE で分かれたレコードを続けて読む
+type segments struct {
+	parts [][]byte
+	i, p  int
+}
+
+func (s *segments) eof() bool {
+	for s.i < len(s.parts) && s.p >= len(s.parts[s.i]) {
+		s.i, s.p = s.i+1, 0
+	}
+	return s.i >= len(s.parts)
+}
+
+// remaining は残りのバイト数
+func (s *segments) remaining() int {
+	if s.eof() {
+		return 0
+	}
+	n := len(s.parts[s.i]) - s.p
+	for _, p := range s.parts[s.i+1:] {
+		n += len(p)
+	}
+	return n
+}
+
+// skip は n バイト読み飛ばす（書式・拡張データは中身を使わないので確保しない）
+func (s *segments) skip(n int) error {
+	if n < 0 || n > s.remaining() {
+		return errors.New("shared string table is truncated")
+	}
+	for n > 0 {
+		s.eof()
+		k := min(n, len(s.parts[s.i])-s.p)
+		s.p += k
+		n -= k
+	}
+	return nil
+}
+
+// bytes は n バイト（区切りをまたいでよい）。長さはファイルの値なので、残りより長ければ確保する前に断る
+func (s *segments) bytes(n int) ([]byte, error) {
+	if n < 0 || n > s.remaining() {
+		return nil, errors.New("shared string table is truncated")
+	}
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if s.eof() {
+			return nil, errors.New("shared string table is truncated")
+		}
+		k := min(n-len(out), len(s.parts[s.i])-s.p)
+		out = append(out, s.parts[s.i][s.p:s.p+k]...)
+		s.p += k
+	}
+	return out, nil
+}
+
+// chars は n 文字。CONTINUE をまたぐと先頭に 1 バイトのフラグが入り、幅が変わることがある
+func (s *segments) chars(n int, wide bool) (string, error) {
+	var b strings.Builder
+	for n > 0 {
+		if s.p >= len(s.parts[s.i]) {
+			if s.i+1 >= len(s.parts) {
+				return "", errors.New("shared string table is truncated")
+			}
+			s.i, s.p = s.i+1, 0
+			flag, err := s.bytes(1)
+			if err != nil {
+				return "", err
+			}
+			wide = flag[0]&1 != 0
+		}
+		part := s.parts[s.i][s.p:]
+		k := min(n, len(part))
+		if wide {
+			k = min(n, len(part)/2)
+		}
+		if k == 0 {
+			return "", errors.New("shared string table is broken")
+		}
+		str, used := decodeChars(part, k, wide)
+		b.WriteString(str)
+		s.p += used
+		n -= k
+	}
+	return b.String(), nil
+}
+
+// readSST は共有文字列表を読む
+func readSST(parts [][]byte) ([]string, error) {
+	s := &segments{parts: parts}
+	head, err := s.bytes(8)
+	if err != nil {
+		return nil, err
+	}
+	unique := int(binary.LittleEndian.Uint32(head[4:]))
+	out := make([]string, 0, min(unique, 1<<16))
+	for i := 0; i < unique && !s.eof(); i++ {
+		h, err := s.bytes(3)
+		if err != nil {
+			return nil, err
+		}
+		n := int(binary.LittleEndian.Uint16(h))
+		flags := h[2]
+		runs, ext := 0, 0
+		if flags&0x08 != 0 {
+			b, err := s.bytes(2)
+			if err != nil {
+				return nil, err
+			}
+			runs = int(binary.LittleEndian.Uint16(b))
+		}
+		if flags&0x04 != 0 {
+			b, err := s.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			ext = int(binary.LittleEndian.Uint32(b))
+		}
+		str, err := s.chars(n, flags&1 != 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.skip(4*runs + ext); err != nil {
+			return nil, err
+		}
+		out = append(out, str)
+	}
+	return out, nil
+}
+
+// readSheet は off の BOF から EOF までのセルを読む
+func (book *workbook) readSheet(wb []byte, off int) ([][]string, error) {
+	if off <= 0 || off >= len(wb) {
+		return nil, errors.New("sheet offset is out of range")
+	}
+	g := newGrid()
+	var pending *[2]int // 文字列の結果を持つ FORMULA の位置（続く STRING に値がある）
+	le := binary.LittleEndian
+	err := records(wb, off, func(r record) (bool, error) {
+		d := r.data
+		if r.typ == recEOF {
+			return false, nil
+		}
+		if r.typ == recString && pending != nil {
+			s, _ := xlUnicodeString(d, 2)
+			err := g.set(pending[0], pending[1], s)
+			pending = nil
+			return err == nil, err
+		}
+		if len(d) < 6 {
+			return true, nil
+		}
+		row, col, xf := int(le.Uint16(d)), int(le.Uint16(d[2:])), le.Uint16(d[4:])
+		var v string
+		switch r.typ {
+		case recLabelSST:
+			if len(d) >= 10 {
+				if i := int(le.Uint32(d[6:])); i < len(book.sst) {
+					v = book.sst[i]
+				}
+			}
+		case recLabel:
+			v, _ = xlUnicodeString(d[6:], 2)
+		case recNumber:
+			if len(d) >= 14 {
+				v = book.number(math.Float64frombits(le.Uint64(d[6:])), xf)
+			}
+		case recRK:
+			if len(d) >= 10 {
+				v = book.number(rkValue(le.Uint32(d[6:])), xf)
+			}
+		case recMulRK:
+			// row, 先頭列, (XF, RK) × n, 最終列
+			for p, c := 4, col; p+6 <= len(d)-2; p, c = p+6, c+1 {
+				if err := g.set(row, c, book.number(rkValue(le.Uint32(d[p+2:])), le.Uint16(d[p:]))); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		case recBoolErr:
+			if len(d) >= 8 {
+				v = boolErr(d[6], d[7] != 0)
+			}
+		case recFormula:
+			if len(d) < 14 {
+				return true, nil
+			}
+			if le.Uint16(d[12:]) != 0xFFFF {
+				v = book.number(math.Float64frombits(le.Uint64(d[6:])), xf)
+				break
+			}
+			switch d[6] {
+			case 0:
+				pending = &[2]int{row, col}
+			case 1:
+				v = boolErr(d[8], false)
+			case 2:
+				v = boolErr(d[8], true)
+			}
+		default:
+			return true, nil
+		}
+		return true, g.set(row, col, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g.records(), nil
+}
+
+// rkValue は RK 形式（bit0 = 1/100、bit1 = 30 ビット整数、それ以外は double の上位 30 ビット）を数値にする
+func rkValue(rk uint32) float64 {
+	var f float64
+	if rk&0x02 != 0 {
+		f = float64(int32(rk) >> 2)
+	} else {
+		f = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		f /= 100
+	}
+	return f
+}
+
+// boolErr は真偽値またはエラー値（#DIV/0! など）を文字列にする
+func boolErr(b byte, isErr bool) string {
+	if !isErr {
+		return strconv.FormatBool(b != 0)
+	}
+	switch b {
+	case 0x00:
+		return "#NULL!"
+	case 0x07:
+		return "#DIV/0!"
+	case 0x0F:
+		return "#VALUE!"
+	case 0x17:
+		return "#REF!"
+	case 0x1D:
+		return "#NAME?"
+	case 0x24:
+		return "#NUM!"
+	case 0x2A:
+		return "#N/A"
+	}
+	return "#ERROR"
+}
+
+// number はセルの書式が日付・時刻なら日付に、それ以外は数値の文字列にする
+func (book *workbook) number(f float64, xf uint16) string {
+	if int(xf) < len(book.xfFormat) && book.isDateFormat(book.xfFormat[xf]) {
+		return formatSerial(f, book.date1904)
+	}
+	return formatNumber(f)
+}
+
+// isDateFormat は組み込み（日本語ロケールの和暦・年月日を含む）か、独自書式に日付・時刻の記号があるか
+func (book *workbook) isDateFormat(ifmt uint16) bool {
+	switch {
+	case ifmt >= 14 && ifmt <= 22, ifmt >= 27 && ifmt <= 36, ifmt >= 45 && ifmt <= 47, ifmt >= 50 && ifmt <= 58:
+		return true
+	}
+	f, ok := book.formats[ifmt]
+	if !ok {
+		return false
+	}
+	return isDateFormatCode(f)
+}
+
+// isDateFormatCode は "..." の文字列・[Red] などの括弧・\ のエスケープを除いて y/m/d/h/s があるか
+func isDateFormatCode(f string) bool {
+	if strings.EqualFold(f, "General") {
+		return false
+	}
+	var b strings.Builder
+	quoted, bracket, escaped := false, false, false
+	for _, r := range f {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			quoted = r != '"'
+		case bracket:
+			bracket = r != ']'
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = true
+		case r == '[':
+			bracket = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	// 書式が ; で分かれるときは正の数の部分で見る
+	code, _, _ := strings.Cut(strings.ToLower(b.String()), ";")
+	return strings.ContainsAny(code, "ymdhs")
+}
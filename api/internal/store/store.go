@@ -2,13 +2,23 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// TenantRole は RLS ポリシーの対象ロール（006_workspaces.up.sql で作成）
+const TenantRole = "app_tenant"
+
+// DefaultWorkspaceID は移行前データを寄せた既定ワークスペース
+const DefaultWorkspaceID = "00000000-0000-0000-0000-000000000001"
+
+var ErrNoWorkspace = errors.New("workspace is not set")
+
 type Store struct {
 	Pool *pgxpool.Pool
 }
@@ -18,6 +28,11 @@ func New() (*Store, error) {
 	if dsn == "" {
 		return nil, fmt.Errorf("DATABASE_URL is empty")
 	}
+	return Open(dsn)
+}
+
+// Open は dsn で接続プールを作る（テストから直接使う）
+func Open(dsn string) (*Store, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parse DATABASE_URL: %w", err)
@@ -42,3 +57,29 @@ func (s *Store) Close() {
 		s.Pool.Close()
 	}
 }
+
+// InWorkspace は workspaceID に閉じたトランザクションで fn を実行する。
+// set_config / SET LOCAL ROLE はトランザクション限りなので、
+// プール（Supabase の transaction pooler 含む）で接続が使い回されても他テナントへ漏れない。
+// fn が error を返したらロールバックする。
+func (s *Store) InWorkspace(ctx context.Context, workspaceID string, fn func(tx pgx.Tx) error) error {
+	if workspaceID == "" {
+		return ErrNoWorkspace
+	}
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `select set_config('app.workspace_id', $1, true)`, workspaceID); err != nil {
+		return fmt.Errorf("set workspace: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "set local role "+TenantRole); err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
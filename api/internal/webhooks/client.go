@@ -0,0 +1,78 @@
+// api/internal/webhooks/client.go
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress は配信先が公開アドレスでない（ループバック・社内網・メタデータなど）
+var ErrPrivateAddress = errors.New("webhook destination is not a public address")
+
+// 公開アドレスでない範囲（netip の Is* で見られないもの）
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64（中の IPv4 が社内を指せる）
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// PublicAddr は配信してよいアドレスか
+// ループバック・プライベート・リンクローカル（169.254.169.254 のメタデータを含む）・マルチキャスト・予約済みは不可
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewClient は配信用の HTTP クライアント
+// 接続する直前（DNS を引いた後）にアドレスを確かめるので、DNS の向け直し（rebinding）でも社内には繋がない
+// リダイレクトは追わず、3xx をそのまま結果にする
+func NewClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, PublicAddr)
+}
+
+func newClient(timeout time.Duration, allow func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+			}
+			if !allow(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil // プロキシ経由だとプロキシのアドレスしか確かめられない
+	tr.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
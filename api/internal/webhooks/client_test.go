@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true, "2606:4700::1111": true,
+		"127.0.0.1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.1.1": false,
+		"169.254.169.254": false, "100.64.0.1": false, "0.0.0.0": false, "::1": false,
+		"fe80::1": false, "fd00::1": false, "::ffff:127.0.0.1": false, "::ffff:10.0.0.1": false,
+		"64:ff9b::a00:1": false, "224.0.0.1": false,
+	} {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestClientRejectsPrivateDestinations(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	c := NewClient(5 * time.Second)
+	// IP 直書きでも、名前解決した先がループバックでも繋がない
+	for _, u := range []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)} {
+		res := Send(context.Background(), c, u, testSecret, "d1", EventPing, []byte(`{}`))
+		if !errors.Is(res.Err, ErrPrivateAddress) || res.StatusCode != 0 {
+			t.Fatalf("%s: %+v", u, res)
+		}
+	}
+	if hit {
+		t.Fatal("private destination was contacted")
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	hit := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// テストの受信側はループバックなのでアドレスの確認だけ外す
+	c := newClient(5*time.Second, func(netip.Addr) bool { return true })
+	res := Send(context.Background(), c, srv.URL, testSecret, "d1", EventPing, []byte(`{}`))
+	if res.StatusCode != http.StatusFound || res.OK() || strings.Contains(res.Body, "secret") {
+		t.Fatalf("redirect: %+v", res)
+	}
+	if hit {
+		t.Fatal("redirect was followed")
+	}
+}
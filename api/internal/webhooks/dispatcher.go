@@ -0,0 +1,232 @@
+// api/internal/webhooks/dispatcher.go
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"csv-import-kit/api/internal/jobs"
+	"csv-import-kit/api/internal/store"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 試行記録に残すレスポンス本文の上限
+const maxResponseBody = 1024
+
+// Dispatcher は積まれた配信を送るワーカー
+type Dispatcher struct {
+	Store   *store.Store
+	Client  *http.Client
+	Workers int
+	Logger  *slog.Logger
+
+	PollInterval time.Duration
+	// Lease は送信中の配信を他のワーカーが拾わない時間（プロセスが落ちたらこの後に再送される）
+	Lease time.Duration
+	// Backoff は attempt 回目が失敗した後の待ち時間
+	Backoff func(attempt int) time.Duration
+}
+
+// NewDispatcher は既定値入りの Dispatcher を返す
+// 既定のバックオフは 10 秒から倍々で上限 1 時間（8 回で約 21 分）
+func NewDispatcher(st *store.Store, workers int, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Store:        st,
+		Client:       NewClient(10 * time.Second),
+		Workers:      workers,
+		Logger:       logger,
+		PollInterval: 2 * time.Second,
+		Lease:        time.Minute,
+		Backoff:      jobs.ExponentialBackoff(10*time.Second, time.Hour),
+	}
+}
+
+// delivery は送信対象 1 件
+type delivery struct {
+	ID          string
+	WorkspaceID string
+	Event       string
+	Payload     []byte
+	Attempts    int // 今回を含む
+	MaxAttempts int
+	URL         string
+	Secret      string
+	Active      bool
+}
+
+// Result は 1 回の送信結果
+type Result struct {
+	StatusCode int // 0 = 接続できなかった
+	Err        error
+	Duration   time.Duration
+	Body       string
+}
+
+// OK は 2xx を受け取ったか
+func (r Result) OK() bool { return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300 }
+
+func (r Result) errorText() *string {
+	switch {
+	case r.Err != nil:
+		s := r.Err.Error()
+		return &s
+	case !r.OK():
+		s := fmt.Sprintf("unexpected status %d", r.StatusCode)
+		return &s
+	}
+	return nil
+}
+
+// Run は ctx が終わるまで配信を続ける
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d.Logger == nil {
+		d.Logger = slog.Default()
+	}
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		dl, err := d.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.Logger.Error("claim webhook delivery failed", "err", err)
+		}
+		if dl == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.PollInterval):
+			}
+			continue
+		}
+
+		var res Result
+		if dl.Active {
+			res = Send(ctx, d.Client, dl.URL, dl.Secret, dl.ID, dl.Event, dl.Payload)
+		} else {
+			res = Result{Err: errors.New("webhook is inactive")}
+		}
+		if ctx.Err() != nil {
+			return // 停止中の失敗は記録しない（リース切れで再送される）
+		}
+		if err := d.record(ctx, dl, res); err != nil {
+			d.Logger.Error("record webhook delivery failed", "delivery_id", dl.ID, "err", err)
+		}
+	}
+}
+
+// claim は送信期限の来た pending を 1 件取り出し、リース期限まで他から見えなくする
+func (d *Dispatcher) claim(ctx context.Context) (*delivery, error) {
+	const q = `
+update public.webhook_deliveries d
+set attempts = d.attempts + 1, next_attempt_at = now() + make_interval(secs => $1), last_attempt_at = now()
+from public.webhooks w
+where w.id = d.webhook_id and d.id = (
+  select id from public.webhook_deliveries
+  where status = 'pending' and next_attempt_at <= now()
+  order by next_attempt_at
+  for update skip locked
+  limit 1
+)
+returning d.id, d.workspace_id, d.event, d.payload, d.attempts, d.max_attempts, w.url, w.secret, w.active;
+`
+	var dl delivery
+	var payload json.RawMessage
+	err := d.Store.Pool.QueryRow(ctx, q, d.Lease.Seconds()).Scan(&dl.ID, &dl.WorkspaceID, &dl.Event, &payload,
+		&dl.Attempts, &dl.MaxAttempts, &dl.URL, &dl.Secret, &dl.Active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dl.Payload = payload
+	return &dl, nil
+}
+
+// record は試行を残し、成功 / 再試行待ち / dead に振り分ける
+func (d *Dispatcher) record(ctx context.Context, dl *delivery, res Result) error {
+	var code *int
+	if res.StatusCode != 0 {
+		code = &res.StatusCode
+	}
+	errText := res.errorText()
+	status, retryIn := nextState(res, dl.Attempts, dl.MaxAttempts, !dl.Active, d.Backoff)
+
+	return pgx.BeginFunc(ctx, d.Store.Pool, func(tx pgx.Tx) error {
+		const ins = `
+insert into public.webhook_delivery_attempts (workspace_id, delivery_id, attempt, status_code, error, duration_ms, response)
+values ($1, $2, $3, $4, $5, $6, nullif($7, ''));
+`
+		if _, err := tx.Exec(ctx, ins, dl.WorkspaceID, dl.ID, dl.Attempts, code, errText, res.Duration.Milliseconds(), res.Body); err != nil {
+			return err
+		}
+		const upd = `
+update public.webhook_deliveries
+set status = $2, last_status_code = $3, last_error = $4,
+    next_attempt_at = now() + make_interval(secs => $5),
+    delivered_at = case when $2 = 'succeeded' then now() else delivered_at end
+where id = $1;
+`
+		_, err := tx.Exec(ctx, upd, dl.ID, status, code, errText, retryIn.Seconds())
+		return err
+	})
+}
+
+// nextState は送信結果から次の状態を決める（pending のときは retryIn 後に再送）
+func nextState(res Result, attempt, maxAttempts int, inactive bool, backoff func(int) time.Duration) (status string, retryIn time.Duration) {
+	switch {
+	case res.OK():
+		return "succeeded", 0
+	case inactive || attempt >= maxAttempts:
+		return "dead", 0
+	}
+	return "pending", backoff(attempt)
+}
+
+// Send は署名付きで 1 回 POST する（リトライはしない）
+func Send(ctx context.Context, client *http.Client, url, secret, deliveryID, event string, body []byte) Result {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "csv-import-kit-webhooks/1")
+	req.Header.Set(HeaderSignature, Sign(secret, start, body))
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Err: err, Duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20)) // 接続を使い回すため読み切る
+	return Result{StatusCode: resp.StatusCode, Duration: time.Since(start), Body: string(b)}
+}
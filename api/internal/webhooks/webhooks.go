@@ -0,0 +1,138 @@
+// Package webhooks は取り込みのライフサイクルイベントを外部 URL に送る。
+// イベントを起こしたトランザクションで webhook_deliveries に積み（Enqueue）、
+// Dispatcher が FOR UPDATE SKIP LOCKED で取り出して HMAC-SHA256 署名付きで POST する。
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// イベント種別（webhooks.events に入れる値）
+const (
+	EventImportValidated = "import.validated"
+	EventImportCommitted = "import.committed"
+	EventImportFailed    = "import.failed"
+	EventPing            = "ping" // POST /api/webhooks/{id}/ping（購読していなくても送る）
+)
+
+// Events は購読できるイベント一覧
+var Events = []string{EventImportValidated, EventImportCommitted, EventImportFailed}
+
+// ValidEvent は購読できるイベントか（"*" は全部）
+func ValidEvent(e string) bool {
+	if e == "*" {
+		return true
+	}
+	for _, v := range Events {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+// 受信側に付けるヘッダ
+const (
+	HeaderSignature = "X-Webhook-Signature" // t=<unix>,v1=<hex>
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery" // 再送でも同じ（受信側の重複排除用）
+)
+
+// Payload は送信する本文
+type Payload struct {
+	ID          string      `json:"id"` // webhook_deliveries.id
+	Event       string      `json:"event"`
+	WorkspaceID string      `json:"workspace_id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Data        interface{} `json:"data"`
+}
+
+// Enqueue は event を購読している有効な webhook ごとに配信を積み、積んだ件数を返す
+// tx はテナントロールのトランザクション（イベントを起こした変更と一緒にコミットされる）
+func Enqueue(ctx context.Context, tx pgx.Tx, event string, data interface{}) (int, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	// payload の id は配信 ID と同じにする（受信側は X-Webhook-Delivery と突き合わせられる）
+	const q = `
+with d as (select gen_random_uuid() as id, w.id as webhook_id, w.workspace_id
+           from public.webhooks w
+           where w.active and ($1 = any(w.events) or '*' = any(w.events)))
+insert into public.webhook_deliveries (id, webhook_id, event, payload)
+select d.id, d.webhook_id, $1,
+       jsonb_build_object('id', d.id, 'event', $1, 'workspace_id', d.workspace_id,
+                          'created_at', now(), 'data', $2::jsonb)
+from d;
+`
+	ct, err := tx.Exec(ctx, q, event, string(b))
+	if err != nil {
+		return 0, err
+	}
+	return int(ct.RowsAffected()), nil
+}
+
+// Sign は署名ヘッダの値を作る（HMAC-SHA256(secret, "<unix>.<body>")）
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + mac(secret, t, body)
+}
+
+func mac(secret, t string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(t))
+	m.Write([]byte("."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+var (
+	ErrBadSignature = errors.New("webhook signature mismatch")
+	ErrStale        = errors.New("webhook timestamp outside tolerance")
+)
+
+// Verify は受信側での検証（tolerance 0 なら時刻は見ない）
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrBadSignature)
+	}
+	if tolerance > 0 {
+		d := now.Sub(time.Unix(unix, 0))
+		if d < -tolerance || d > tolerance {
+			return ErrStale
+		}
+	}
+	want := mac(secret, t, body)
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
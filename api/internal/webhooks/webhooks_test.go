@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test_secret_0123456789"
+
+func TestSendSignedToReceiver(t *testing.T) {
+	body := []byte(`{"id":"d1","event":"import.committed","data":{"import_id":"imp-1"}}`)
+
+	var got struct {
+		event, delivery string
+		verr            error
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got.event = r.Header.Get(HeaderEvent)
+		got.delivery = r.Header.Get(HeaderDelivery)
+		got.verr = Verify(testSecret, r.Header.Get(HeaderSignature), b, time.Now(), 5*time.Minute)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	res := Send(context.Background(), srv.Client(), srv.URL, testSecret, "d1", EventImportCommitted, body)
+	if !res.OK() || res.StatusCode != http.StatusNoContent {
+		t.Fatalf("send: %+v", res)
+	}
+	if got.verr != nil {
+		t.Fatalf("receiver could not verify signature: %v", got.verr)
+	}
+	if got.event != EventImportCommitted || got.delivery != "d1" {
+		t.Fatalf("headers: %+v", got)
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	res := Send(context.Background(), srv.Client(), srv.URL, testSecret, "d1", EventPing, []byte(`{}`))
+	if res.OK() || res.StatusCode != http.StatusBadGateway || res.Body != "boom\n" {
+		t.Fatalf("5xx: %+v", res)
+	}
+	if e := res.errorText(); e == nil || *e != "unexpected status 502" {
+		t.Fatalf("error text: %v", e)
+	}
+
+	// 受信側が落ちている
+	srv.Close()
+	res = Send(context.Background(), http.DefaultClient, srv.URL, testSecret, "d1", EventPing, []byte(`{}`))
+	if res.OK() || res.StatusCode != 0 || res.Err == nil {
+		t.Fatalf("connection refused: %+v", res)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"a":1}`)
+	sig := Sign(testSecret, now, body)
+
+	if err := Verify(testSecret, sig, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("valid: %v", err)
+	}
+	if err := Verify(testSecret, sig, []byte(`{"a":2}`), now, 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered body: %v", err)
+	}
+	if err := Verify("other-secret-value", sig, body, now, 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("wrong secret: %v", err)
+	}
+	if err := Verify(testSecret, sig, body, now.Add(time.Hour), 5*time.Minute); !errors.Is(err, ErrStale) {
+		t.Fatalf("stale: %v", err)
+	}
+	if err := Verify(testSecret, "garbage", body, now, 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("malformed: %v", err)
+	}
+}
+
+func TestNextState(t *testing.T) {
+	backoff := func(n int) time.Duration { return time.Duration(n) * time.Second }
+	ok := Result{StatusCode: 200}
+	fail := Result{StatusCode: 500}
+
+	cases := []struct {
+		res         Result
+		attempt     int
+		inactive    bool
+		wantStatus  string
+		wantRetryIn time.Duration
+	}{
+		{ok, 3, false, "succeeded", 0},
+		{fail, 3, false, "pending", 3 * time.Second},
+		{fail, 8, false, "dead", 0},
+		{fail, 1, true, "dead", 0},
+	}
+	for _, c := range cases {
+		st, in := nextState(c.res, c.attempt, 8, c.inactive, backoff)
+		if st != c.wantStatus || in != c.wantRetryIn {
+			t.Fatalf("%+v: got %s/%v", c, st, in)
+		}
+	}
+}
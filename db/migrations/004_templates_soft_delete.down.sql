@@ -0,0 +1,3 @@
+drop index if exists public.idx_mapping_templates_deleted_at;
+drop index if exists public.idx_mapping_templates_active_created_at;
+alter table public.mapping_templates drop column if exists deleted_at;
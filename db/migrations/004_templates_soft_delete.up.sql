@@ -0,0 +1,13 @@
+-- テンプレートの論理削除（ゴミ箱）
+alter table public.mapping_templates
+  add column if not exists deleted_at timestamptz null;
+
+-- 一覧は「削除されていないもの」を新しい順に引くのが基本
+create index if not exists idx_mapping_templates_active_created_at
+  on public.mapping_templates (created_at desc)
+  where deleted_at is null;
+
+-- 定期パージ用
+create index if not exists idx_mapping_templates_deleted_at
+  on public.mapping_templates (deleted_at)
+  where deleted_at is not null;
@@ -0,0 +1,19 @@
+-- API キー（平文は発行時に一度だけ返し、DB には SHA-256 のみ保存）
+create table if not exists public.api_keys (
+  id            uuid primary key default gen_random_uuid(),
+  name          text        not null,            -- 監査ログの actor に使う表示名
+  key_prefix    text        not null,            -- 一覧表示用（例: 'csvk_AbCd'）
+  key_hash      text        not null unique,     -- sha256(平文キー) の hex
+  scopes        text[]      not null default '{}', -- 'templates:read' / 'templates:write' / 'imports:write' / 'imports:commit' / 'keys:admin'
+  expires_at    timestamptz null,
+  last_used_at  timestamptz null,
+  revoked_at    timestamptz null,
+  created_at    timestamptz not null default now()
+);
+
+create index if not exists idx_api_keys_created_at
+  on public.api_keys (created_at desc);
+
+-- RLS は有効化するがポリシーは作らない（PostgREST 経由では一切見せない）
+-- API サーバはテーブル所有者で接続するため影響を受けない
+alter table public.api_keys enable row level security;
@@ -0,0 +1,62 @@
+BEGIN;
+
+drop policy if exists tenant_isolation on public.workspaces;
+
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'import_rows_raw',
+    'import_mappings',
+    'contacts',
+    'import_audit_logs',
+    'mapping_templates'
+  ]) LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON public.%I;', t);
+  END LOOP;
+END $$;
+
+-- 002 / 003 の暫定ポリシーに戻す
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'import_rows_raw',
+    'import_mappings',
+    'contacts',
+    'import_audit_logs'
+  ]) LOOP
+    EXECUTE format('CREATE POLICY allow_all ON public.%I FOR ALL USING (true) WITH CHECK (true);', t);
+  END LOOP;
+END $$;
+
+create policy "mt_select_all" on public.mapping_templates for select using (true);
+create policy "mt_insert_all" on public.mapping_templates for insert with check (true);
+create policy "mt_update_all" on public.mapping_templates for update using (true) with check (true);
+create policy "mt_delete_all" on public.mapping_templates for delete using (true);
+
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'mapping_templates',
+    'contacts',
+    'import_audit_logs',
+    'api_keys'
+  ]) LOOP
+    EXECUTE format('ALTER TABLE public.%I DROP COLUMN IF EXISTS workspace_id;', t);
+  END LOOP;
+END $$;
+
+-- ロールは他 DB オブジェクトの権限を持つため落とさない（REVOKE のみ）
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM app_tenant;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM app_tenant;
+REVOKE USAGE ON SCHEMA public FROM app_tenant;
+
+drop function if exists public.current_workspace_id();
+drop table if exists public.workspaces;
+
+COMMIT;
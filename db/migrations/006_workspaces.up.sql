@@ -0,0 +1,124 @@
+BEGIN;
+
+-- ============= workspaces（テナント） =============
+create table if not exists public.workspaces (
+  id          uuid primary key default gen_random_uuid(),
+  name        text        not null,
+  created_at  timestamptz not null default now()
+);
+
+-- 既存データの受け皿（API の DEFAULT_WORKSPACE_ID の既定値と同じ）
+insert into public.workspaces (id, name)
+values ('00000000-0000-0000-0000-000000000001', 'default')
+on conflict (id) do nothing;
+
+-- セッション設定 app.workspace_id（API がトランザクションごとに set_config する）
+create or replace function public.current_workspace_id()
+returns uuid language sql stable as $$
+  select nullif(current_setting('app.workspace_id', true), '')::uuid
+$$;
+
+-- ============= workspace_id 列の追加 =============
+-- 既存行は default ワークスペースへ寄せ、以降の insert はセッション設定から自動で埋める
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'mapping_templates',
+    'contacts',
+    'import_audit_logs',
+    'api_keys'
+  ]) LOOP
+    EXECUTE format('ALTER TABLE public.%I ADD COLUMN IF NOT EXISTS workspace_id uuid REFERENCES public.workspaces(id) ON DELETE CASCADE;', t);
+    EXECUTE format('UPDATE public.%I SET workspace_id = %L WHERE workspace_id IS NULL;', t, '00000000-0000-0000-0000-000000000001');
+    EXECUTE format('ALTER TABLE public.%I ALTER COLUMN workspace_id SET DEFAULT public.current_workspace_id();', t);
+    EXECUTE format('ALTER TABLE public.%I ALTER COLUMN workspace_id SET NOT NULL;', t);
+    EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON public.%I (workspace_id);', 'idx_' || t || '_workspace', t);
+  END LOOP;
+END $$;
+
+-- ============= テナント用ロール =============
+-- API はトランザクション内で SET LOCAL ROLE app_tenant してから問い合わせる。
+-- 接続ユーザ（テーブル所有者/スーパーユーザ）のままだと RLS がバイパスされるため。
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'app_tenant') THEN
+    CREATE ROLE app_tenant NOLOGIN;
+  END IF;
+END $$;
+GRANT app_tenant TO CURRENT_USER;
+
+GRANT USAGE ON SCHEMA public TO app_tenant;
+GRANT SELECT ON public.workspaces TO app_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON
+  public.imports,
+  public.import_rows_raw,
+  public.import_mappings,
+  public.contacts,
+  public.import_audit_logs,
+  public.mapping_templates
+TO app_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app_tenant;
+
+-- ============= ポリシー（暫定の全許可を置き換え） =============
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'import_rows_raw',
+    'import_mappings',
+    'contacts',
+    'import_audit_logs'
+  ]) LOOP
+    EXECUTE format('DROP POLICY IF EXISTS allow_all ON public.%I;', t);
+  END LOOP;
+END $$;
+
+drop policy if exists "mt_select_all" on public.mapping_templates;
+drop policy if exists "mt_insert_all" on public.mapping_templates;
+drop policy if exists "mt_update_all" on public.mapping_templates;
+drop policy if exists "mt_delete_all" on public.mapping_templates;
+
+-- workspace_id を持つテーブル
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'imports',
+    'mapping_templates',
+    'contacts',
+    'import_audit_logs'
+  ]) LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON public.%I;', t);
+    EXECUTE format(
+      'CREATE POLICY tenant_isolation ON public.%I FOR ALL TO app_tenant '
+      'USING (workspace_id = public.current_workspace_id()) '
+      'WITH CHECK (workspace_id = public.current_workspace_id());', t);
+  END LOOP;
+END $$;
+
+-- imports の子テーブルは親が見えるかどうかで判定（imports 側の RLS が効く）
+DO $$
+DECLARE t text;
+BEGIN
+  FOR t IN SELECT unnest(ARRAY[
+    'import_rows_raw',
+    'import_mappings'
+  ]) LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON public.%I;', t);
+    EXECUTE format(
+      'CREATE POLICY tenant_isolation ON public.%I FOR ALL TO app_tenant '
+      'USING (EXISTS (SELECT 1 FROM public.imports i WHERE i.id = import_id)) '
+      'WITH CHECK (EXISTS (SELECT 1 FROM public.imports i WHERE i.id = import_id));', t);
+  END LOOP;
+END $$;
+
+alter table public.workspaces enable row level security;
+drop policy if exists tenant_isolation on public.workspaces;
+create policy tenant_isolation on public.workspaces
+  for select to app_tenant
+  using (id = public.current_workspace_id());
+
+COMMIT;
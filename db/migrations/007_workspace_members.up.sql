@@ -0,0 +1,28 @@
+BEGIN;
+
+-- ワークスペースごとのユーザロール（JWT の sub = Supabase Auth のユーザ ID）
+create table if not exists public.workspace_members (
+  workspace_id  uuid        not null default public.current_workspace_id()
+                            references public.workspaces(id) on delete cascade,
+  user_id       text        not null,
+  role          text        not null check (role in ('viewer','editor','admin')),
+  created_at    timestamptz not null default now(),
+  updated_at    timestamptz not null default now(),
+  primary key (workspace_id, user_id)
+);
+
+drop trigger if exists trg_workspace_members_updated_at on public.workspace_members;
+create trigger trg_workspace_members_updated_at
+before update on public.workspace_members
+for each row execute function public.set_updated_at();
+
+alter table public.workspace_members enable row level security;
+grant select, insert, update, delete on public.workspace_members to app_tenant;
+
+drop policy if exists tenant_isolation on public.workspace_members;
+create policy tenant_isolation on public.workspace_members
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+COMMIT;
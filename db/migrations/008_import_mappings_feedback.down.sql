@@ -0,0 +1,9 @@
+BEGIN;
+drop index if exists public.idx_import_mappings_overrides;
+delete from public.import_mappings where target_field is null;
+alter table public.import_mappings
+  drop column if exists updated_at,
+  drop column if exists decided_by,
+  drop column if exists suggested_field,
+  alter column target_field set not null;
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- インポートごとのマッピング判断（サジェスト vs ユーザの選択）を保存する
+-- target_field が null = 「サジェストされたが未割当にした」
+alter table public.import_mappings
+  alter column target_field drop not null,
+  add column if not exists suggested_field text null,
+  add column if not exists decided_by      text null,
+  add column if not exists updated_at      timestamptz not null default now();
+
+-- 学習用フィードバックの書き出し（上書きのみを新しい順に）
+create index if not exists idx_import_mappings_overrides
+  on public.import_mappings (updated_at desc)
+  where is_override;
+
+COMMIT;
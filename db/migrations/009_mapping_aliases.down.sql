@@ -0,0 +1,4 @@
+BEGIN;
+drop table if exists public.mapping_aliases;
+alter table public.imports drop column if exists schema_key;
+COMMIT;
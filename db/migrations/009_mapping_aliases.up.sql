@@ -0,0 +1,42 @@
+BEGIN;
+
+-- インポートが対象とするスキーマ（mapping_templates.schema_key と同じ値。学習の単位になる）
+alter table public.imports
+  add column if not exists schema_key text null;
+
+-- ワークスペース × スキーマ項目ごとのヘッダ別名（ユーザの上書きから学習 / 手動登録）
+create table if not exists public.mapping_aliases (
+  id            uuid        primary key default gen_random_uuid(),
+  workspace_id  uuid        not null default public.current_workspace_id()
+                            references public.workspaces(id) on delete cascade,
+  schema_key    text        not null,
+  target_field  text        not null,
+  alias         text        not null,            -- 正規化済みヘッダ（小文字・空白/ハイフン → _）
+  display       text        not null,            -- 最後に見た元の表記
+  hits          integer     not null default 0,  -- 上書きとして確定されたインポート数
+  weight        real        not null default 1 check (weight >= 0), -- 0 で無効
+  manual        boolean     not null default false, -- 手動登録/編集（hits が 0 になっても消さない）
+  last_seen_at  timestamptz null,
+  created_at    timestamptz not null default now(),
+  updated_at    timestamptz not null default now(),
+  unique (workspace_id, schema_key, target_field, alias)
+);
+
+create index if not exists idx_mapping_aliases_schema
+  on public.mapping_aliases (workspace_id, schema_key);
+
+drop trigger if exists trg_mapping_aliases_updated_at on public.mapping_aliases;
+create trigger trg_mapping_aliases_updated_at
+before update on public.mapping_aliases
+for each row execute function public.set_updated_at();
+
+alter table public.mapping_aliases enable row level security;
+grant select, insert, update, delete on public.mapping_aliases to app_tenant;
+
+drop policy if exists tenant_isolation on public.mapping_aliases;
+create policy tenant_isolation on public.mapping_aliases
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+drop index if exists public.idx_contacts_import;
+alter table public.contacts drop column if exists import_id;
+alter table public.import_rows_raw drop column if exists normalized_json;
+drop table if exists public.jobs;
+COMMIT;
@@ -0,0 +1,71 @@
+BEGIN;
+
+-- ============= background jobs =============
+-- API は行を入れるだけ。ワーカーが FOR UPDATE SKIP LOCKED で 1 件ずつ取り出して実行する
+create table if not exists public.jobs (
+  id               uuid        primary key default gen_random_uuid(),
+  workspace_id     uuid        not null default public.current_workspace_id()
+                               references public.workspaces(id) on delete cascade,
+  import_id        uuid        null references public.imports(id) on delete cascade,
+  type             text        not null check (type in ('parse','apply','validate','commit')),
+  status           text        not null default 'queued'
+                               check (status in ('queued','running','succeeded','failed','cancelled')),
+  payload          jsonb       not null default '{}'::jsonb,
+  attempts         integer     not null default 0,
+  max_attempts     integer     not null default 5,
+  run_at           timestamptz not null default now(), -- リトライ時はバックオフ後の時刻
+  locked_by        text        null,
+  locked_at        timestamptz null,
+  heartbeat_at     timestamptz null,
+  cancel_requested boolean     not null default false,
+  progress         real        not null default 0 check (progress between 0 and 100),
+  rows_total       integer     not null default 0,
+  rows_done        integer     not null default 0,
+  rows_failed      integer     not null default 0,
+  last_error       text        null,
+  result           jsonb       null,
+  created_by       text        null,
+  created_at       timestamptz not null default now(),
+  updated_at       timestamptz not null default now(),
+  finished_at      timestamptz null
+);
+
+-- 取り出し用（queued を run_at 順に）
+create index if not exists idx_jobs_queued
+  on public.jobs (run_at, created_at)
+  where status = 'queued';
+-- 止まったワーカーの検出用
+create index if not exists idx_jobs_running
+  on public.jobs (heartbeat_at)
+  where status = 'running';
+create index if not exists idx_jobs_import
+  on public.jobs (import_id, created_at desc);
+-- 1 インポートにつき実行待ち/実行中は 1 件だけ（parse → apply → validate → commit は順番に）
+create unique index if not exists uq_jobs_import_active
+  on public.jobs (import_id)
+  where status in ('queued','running');
+
+drop trigger if exists trg_jobs_updated_at on public.jobs;
+create trigger trg_jobs_updated_at
+before update on public.jobs
+for each row execute function public.set_updated_at();
+
+alter table public.jobs enable row level security;
+grant select, insert, update on public.jobs to app_tenant;
+
+drop policy if exists tenant_isolation on public.jobs;
+create policy tenant_isolation on public.jobs
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+-- ステージング: マッピング適用後の 1 行（スキーマ項目: 値）
+alter table public.import_rows_raw
+  add column if not exists normalized_json jsonb null;
+
+-- 確定先: どのインポートから入った行か（ロールバック・追跡用）
+alter table public.contacts
+  add column if not exists import_id uuid null references public.imports(id) on delete set null;
+create index if not exists idx_contacts_import on public.contacts (import_id);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+drop trigger if exists trg_imports_emit_status on public.imports;
+drop trigger if exists trg_jobs_emit_event on public.jobs;
+drop function if exists public.imports_emit_status();
+drop function if exists public.jobs_emit_event();
+drop function if exists public.emit_import_event(uuid, uuid, uuid, text, jsonb);
+drop table if exists public.import_events;
+COMMIT;
@@ -0,0 +1,112 @@
+BEGIN;
+
+-- ============= import events (SSE) =============
+-- jobs / imports の変化をトリガで 1 行ずつ記録し、NOTIFY import_events で API に知らせる
+-- id は SSE の Last-Event-ID（インポート内で単調増加）
+create table if not exists public.import_events (
+  id           bigint      generated always as identity primary key,
+  workspace_id uuid        not null references public.workspaces(id) on delete cascade,
+  import_id    uuid        not null references public.imports(id) on delete cascade,
+  job_id       uuid        null,
+  type         text        not null
+                           check (type in ('status','queued','phase','progress','retry','completed','failed','cancelled')),
+  data         jsonb       not null default '{}'::jsonb,
+  created_at   timestamptz not null default now()
+);
+
+create index if not exists idx_import_events_import
+  on public.import_events (import_id, id);
+
+alter table public.import_events enable row level security;
+grant select on public.import_events to app_tenant;
+
+drop policy if exists tenant_isolation on public.import_events;
+create policy tenant_isolation on public.import_events
+  for select to app_tenant
+  using (workspace_id = public.current_workspace_id());
+
+-- 記録 + 通知（payload は 8000 バイト制限があるので ID だけ。中身は API が読み直す）
+-- テナントロールの更新（キャンセル等）からも書けるよう security definer
+create or replace function public.emit_import_event(
+  p_workspace_id uuid, p_import_id uuid, p_job_id uuid, p_type text, p_data jsonb
+) returns void
+language plpgsql
+security definer
+set search_path = public
+as $$
+declare
+  v_id bigint;
+begin
+  insert into public.import_events (workspace_id, import_id, job_id, type, data)
+  values (p_workspace_id, p_import_id, p_job_id, p_type, coalesce(p_data, '{}'::jsonb))
+  returning id into v_id;
+  perform pg_notify('import_events', json_build_object('id', v_id, 'import_id', p_import_id)::text);
+end;
+$$;
+
+-- ジョブ: 積まれた / 開始（phase）/ 進捗 / 再試行待ち / 完了・失敗・キャンセル
+create or replace function public.jobs_emit_event() returns trigger
+language plpgsql
+as $$
+declare
+  v_type text;
+  v_data jsonb := jsonb_build_object('phase', new.type, 'status', new.status, 'attempt', new.attempts);
+begin
+  if new.import_id is null then
+    return null;
+  end if;
+
+  if tg_op = 'INSERT' then
+    v_type := 'queued';
+  elsif new.status is distinct from old.status then
+    v_type := case new.status
+      when 'running'   then 'phase'
+      when 'queued'    then 'retry'
+      when 'succeeded' then 'completed'
+      else new.status -- failed / cancelled
+    end;
+    if new.status = 'succeeded' then
+      v_data := v_data || jsonb_build_object('result', new.result);
+    elsif new.status in ('failed','queued') then
+      v_data := v_data || jsonb_build_object('error', new.last_error, 'run_at', new.run_at);
+    end if;
+  elsif new.status = 'running'
+    and (new.rows_total, new.rows_done, new.rows_failed, new.progress)
+        is distinct from (old.rows_total, old.rows_done, old.rows_failed, old.progress) then
+    v_type := 'progress';
+  else
+    return null; -- heartbeat などは記録しない
+  end if;
+
+  v_data := v_data || jsonb_build_object(
+    'progress', new.progress, 'rows_total', new.rows_total,
+    'rows_done', new.rows_done, 'rows_failed', new.rows_failed);
+  perform public.emit_import_event(new.workspace_id, new.import_id, new.id, v_type, v_data);
+  return null;
+end;
+$$;
+
+drop trigger if exists trg_jobs_emit_event on public.jobs;
+create trigger trg_jobs_emit_event
+after insert or update on public.jobs
+for each row execute function public.jobs_emit_event();
+
+-- インポートのステータス変化（uploaded → mapping → validating → ready_to_commit → committed / failed）
+create or replace function public.imports_emit_status() returns trigger
+language plpgsql
+as $$
+begin
+  if new.status is distinct from old.status then
+    perform public.emit_import_event(new.workspace_id, new.id, null, 'status',
+      jsonb_build_object('status', new.status, 'previous', old.status, 'row_count', new.row_count));
+  end if;
+  return null;
+end;
+$$;
+
+drop trigger if exists trg_imports_emit_status on public.imports;
+create trigger trg_imports_emit_status
+after update of status on public.imports
+for each row execute function public.imports_emit_status();
+
+COMMIT;
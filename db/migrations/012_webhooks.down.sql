@@ -0,0 +1,5 @@
+BEGIN;
+drop table if exists public.webhook_delivery_attempts;
+drop table if exists public.webhook_deliveries;
+drop table if exists public.webhooks;
+COMMIT;
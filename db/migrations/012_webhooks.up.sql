@@ -0,0 +1,99 @@
+BEGIN;
+
+-- ============= outbound webhooks =============
+-- 購読（ワークスペースごと）。secret は署名に使うので平文で持つ（API では作成時しか返さない）
+create table if not exists public.webhooks (
+  id           uuid        primary key default gen_random_uuid(),
+  workspace_id uuid        not null default public.current_workspace_id()
+                           references public.workspaces(id) on delete cascade,
+  url          text        not null check (url ~ '^https?://'),
+  secret       text        not null,
+  events       text[]      not null,
+  description  text        not null default '',
+  active       boolean     not null default true,
+  created_by   text        null,
+  created_at   timestamptz not null default now(),
+  updated_at   timestamptz not null default now()
+);
+
+create index if not exists idx_webhooks_workspace on public.webhooks (workspace_id);
+
+-- 配信（イベント × 購読ごとに 1 行）。イベントを起こしたのと同じトランザクションで積む
+-- pending → succeeded / dead（最大試行回数まで失敗）
+create table if not exists public.webhook_deliveries (
+  id               uuid        primary key default gen_random_uuid(),
+  workspace_id     uuid        not null default public.current_workspace_id()
+                               references public.workspaces(id) on delete cascade,
+  webhook_id       uuid        not null references public.webhooks(id) on delete cascade,
+  event            text        not null,
+  payload          jsonb       not null,
+  status           text        not null default 'pending'
+                               check (status in ('pending','succeeded','dead')),
+  attempts         integer     not null default 0,
+  max_attempts     integer     not null default 8,
+  next_attempt_at  timestamptz not null default now(), -- 送信中はリース期限
+  last_status_code integer     null,
+  last_error       text        null,
+  last_attempt_at  timestamptz null,
+  delivered_at     timestamptz null,
+  created_at       timestamptz not null default now(),
+  updated_at       timestamptz not null default now()
+);
+
+create index if not exists idx_webhook_deliveries_due
+  on public.webhook_deliveries (next_attempt_at)
+  where status = 'pending';
+create index if not exists idx_webhook_deliveries_webhook
+  on public.webhook_deliveries (webhook_id, created_at desc);
+
+-- 試行の記録（レスポンスコード・所要時間・本文の先頭）
+create table if not exists public.webhook_delivery_attempts (
+  id           bigint      generated always as identity primary key,
+  workspace_id uuid        not null references public.workspaces(id) on delete cascade,
+  delivery_id  uuid        not null references public.webhook_deliveries(id) on delete cascade,
+  attempt      integer     not null,
+  status_code  integer     null, -- 接続できなかった場合は null
+  error        text        null,
+  duration_ms  integer     not null default 0,
+  response     text        null,
+  created_at   timestamptz not null default now()
+);
+
+create index if not exists idx_webhook_attempts_delivery
+  on public.webhook_delivery_attempts (delivery_id, attempt);
+
+drop trigger if exists trg_webhooks_updated_at on public.webhooks;
+create trigger trg_webhooks_updated_at
+before update on public.webhooks
+for each row execute function public.set_updated_at();
+
+drop trigger if exists trg_webhook_deliveries_updated_at on public.webhook_deliveries;
+create trigger trg_webhook_deliveries_updated_at
+before update on public.webhook_deliveries
+for each row execute function public.set_updated_at();
+
+alter table public.webhooks enable row level security;
+alter table public.webhook_deliveries enable row level security;
+alter table public.webhook_delivery_attempts enable row level security;
+grant select, insert, update, delete on public.webhooks to app_tenant;
+grant select, insert, update on public.webhook_deliveries to app_tenant;
+grant select on public.webhook_delivery_attempts to app_tenant;
+
+drop policy if exists tenant_isolation on public.webhooks;
+create policy tenant_isolation on public.webhooks
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+drop policy if exists tenant_isolation on public.webhook_deliveries;
+create policy tenant_isolation on public.webhook_deliveries
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+drop policy if exists tenant_isolation on public.webhook_delivery_attempts;
+create policy tenant_isolation on public.webhook_delivery_attempts
+  for select to app_tenant
+  using (workspace_id = public.current_workspace_id());
+
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+drop table if exists public.uploads;
+COMMIT;
@@ -0,0 +1,42 @@
+BEGIN;
+
+-- ============= resumable uploads =============
+-- POST /api/uploads で作り、PATCH でチャンクを追記（upload_offset まで受け取り済み）、
+-- POST complete で検証して imports を作る。途中のファイルは UploadDir/<workspace>/uploads/<id>.part
+create table if not exists public.uploads (
+  id            uuid        primary key default gen_random_uuid(),
+  workspace_id  uuid        not null default public.current_workspace_id()
+                            references public.workspaces(id) on delete cascade,
+  filename      text        not null,
+  size          bigint      not null check (size > 0),
+  upload_offset bigint      not null default 0 check (upload_offset between 0 and size),
+  checksum      text        null, -- 'sha256:<hex>'（作成時か complete で指定）
+  status        text        not null default 'uploading'
+                            check (status in ('uploading','completed','aborted')),
+  import_id     uuid        null references public.imports(id) on delete set null,
+  created_by    text        null,
+  expires_at    timestamptz not null default now() + interval '24 hours', -- チャンクを受けるたびに延長
+  created_at    timestamptz not null default now(),
+  updated_at    timestamptz not null default now()
+);
+
+-- 期限切れの掃除用
+create index if not exists idx_uploads_expiry
+  on public.uploads (expires_at)
+  where status = 'uploading';
+
+drop trigger if exists trg_uploads_updated_at on public.uploads;
+create trigger trg_uploads_updated_at
+before update on public.uploads
+for each row execute function public.set_updated_at();
+
+alter table public.uploads enable row level security;
+grant select, insert, update on public.uploads to app_tenant;
+
+drop policy if exists tenant_isolation on public.uploads;
+create policy tenant_isolation on public.uploads
+  for all to app_tenant
+  using (workspace_id = public.current_workspace_id())
+  with check (workspace_id = public.current_workspace_id());
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+alter table public.imports
+  drop column if exists original_content_type,
+  drop column if exists original_size,
+  drop column if exists original_sha256,
+  drop column if exists original_key;
+COMMIT;
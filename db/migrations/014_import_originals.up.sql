@@ -0,0 +1,11 @@
+BEGIN;
+
+-- ============= original files =============
+-- アップロードされた元ファイル（BlobStore のキー・SHA-256・サイズ）。再取り込みと受領の証跡に使う
+alter table public.imports
+  add column if not exists original_key          text   null,
+  add column if not exists original_sha256       text   null check (original_sha256 ~ '^[0-9a-f]{64}$'),
+  add column if not exists original_size         bigint null check (original_size >= 0),
+  add column if not exists original_content_type text   null;
+
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+alter table public.imports drop column if exists parse_options;
+COMMIT;
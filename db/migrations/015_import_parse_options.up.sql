@@ -0,0 +1,9 @@
+BEGIN;
+
+-- ============= parse options =============
+-- reparse で明示した読み取り設定（区切り・囲み・文字コード・ヘッダ位置など）。null は推定
+alter table public.imports
+  add column if not exists parse_options jsonb null
+    check (parse_options is null or jsonb_typeof(parse_options) = 'object');
+
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+alter table public.mapping_templates drop column if exists parse_options;
+COMMIT;
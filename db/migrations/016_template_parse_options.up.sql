@@ -0,0 +1,9 @@
+BEGIN;
+
+-- ============= template parse options =============
+-- テンプレートに読み取り設定（固定長の列定義など）を持たせる。アップロード時に templateId で使う
+alter table public.mapping_templates
+  add column if not exists parse_options jsonb null
+    check (parse_options is null or jsonb_typeof(parse_options) = 'object');
+
+COMMIT;
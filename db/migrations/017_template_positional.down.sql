@@ -0,0 +1,5 @@
+BEGIN;
+alter table public.mapping_templates drop constraint if exists mapping_templates_positional_column_count;
+alter table public.mapping_templates drop column if exists column_count;
+alter table public.mapping_templates drop column if exists positional;
+COMMIT;
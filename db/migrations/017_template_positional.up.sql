@@ -0,0 +1,12 @@
+BEGIN;
+
+-- ============= positional templates =============
+-- ヘッダの無いファイル向けに列番号でルールを書いたテンプレート。column_count と列数が同じファイルにだけ当てる
+alter table public.mapping_templates
+  add column if not exists positional boolean not null default false,
+  add column if not exists column_count integer null
+    check (column_count is null or column_count > 0),
+  add constraint mapping_templates_positional_column_count
+    check (not positional or column_count is not null);
+
+COMMIT;
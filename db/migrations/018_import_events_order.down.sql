@@ -0,0 +1,19 @@
+BEGIN;
+drop function if exists public.import_events_last_id();
+create or replace function public.emit_import_event(
+  p_workspace_id uuid, p_import_id uuid, p_job_id uuid, p_type text, p_data jsonb
+) returns void
+language plpgsql
+security definer
+set search_path = public
+as $$
+declare
+  v_id bigint;
+begin
+  insert into public.import_events (workspace_id, import_id, job_id, type, data)
+  values (p_workspace_id, p_import_id, p_job_id, p_type, coalesce(p_data, '{}'::jsonb))
+  returning id into v_id;
+  perform pg_notify('import_events', json_build_object('id', v_id, 'import_id', p_import_id)::text);
+end;
+$$;
+COMMIT;
@@ -0,0 +1,38 @@
+BEGIN;
+
+-- ============= import events: commit order =============
+-- import_events.id は insert した時点で発番されるが、見えるのはコミットした時点なので、
+-- 長いトランザクション（commit ジョブ）の N が、後から発番された N+1 より後に見えることがある。
+-- API は「ある時点までに発番された ID を持つトランザクションがすべて終わった」ことを
+-- スナップショットの xmin / xmax で確かめてから、その ID までを読み終えたことにする。
+-- そのために、ID を取る前に必ずトランザクション ID を持たせる（ID の発番より xid の割り当てが先になる）
+create or replace function public.emit_import_event(
+  p_workspace_id uuid, p_import_id uuid, p_job_id uuid, p_type text, p_data jsonb
+) returns void
+language plpgsql
+security definer
+set search_path = public
+as $$
+declare
+  v_id bigint;
+begin
+  perform pg_current_xact_id();
+  insert into public.import_events (workspace_id, import_id, job_id, type, data)
+  values (p_workspace_id, p_import_id, p_job_id, p_type, coalesce(p_data, '{}'::jsonb))
+  returning id into v_id;
+  perform pg_notify('import_events', json_build_object('id', v_id, 'import_id', p_import_id)::text);
+end;
+$$;
+
+-- これまでに発番した最後の ID（コミット前のものも含む。テナントロールから読めるよう security definer）
+create or replace function public.import_events_last_id() returns bigint
+language sql
+security definer
+set search_path = public
+as $$
+  select coalesce(pg_sequence_last_value(pg_get_serial_sequence('public.import_events', 'id')::regclass), 0);
+$$;
+
+grant execute on function public.import_events_last_id() to app_tenant;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+update public.imports set status = 'failed' where status = 'rolled_back';
+alter table public.imports drop constraint if exists imports_status_check;
+alter table public.imports add constraint imports_status_check
+  check (status in ('uploaded','mapping','validating','ready_to_commit','committed','failed'));
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- ============= import rollback =============
+-- POST /api/imports/{id}/rollback で確定した行（contacts.import_id）を消したインポートは rolled_back
+alter table public.imports drop constraint if exists imports_status_check;
+alter table public.imports add constraint imports_status_check
+  check (status in ('uploaded','mapping','validating','ready_to_commit','committed','rolled_back','failed'));
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- ============= applied mappings =============
+-- apply で使った保存済みマッピング（{schemaKey, mappings}）。commit で別名を学習し、rollback で取り消す元
+-- ルール / テンプレートで apply したときは mappings が空（学習しない）。null はこの列より前に apply したインポート
+alter table public.imports
+  add column if not exists applied_mappings jsonb null
+    check (applied_mappings is null or jsonb_typeof(applied_mappings) = 'object');
+
+COMMIT;
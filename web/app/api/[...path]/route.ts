@@ -0,0 +1,65 @@
+// /api/* を Go API（API_BASE_URL）に中継する
+// API キー（WEB_API_KEY）はサーバ側の環境変数だけに置き、ブラウザのバンドルに入れない
+// ブラウザが Authorization: Bearer（Supabase のセッション JWT）を送ってきたらそれを優先し、キーは付けない
+// /api/sample-csv のような個別のルートはこちらより優先される
+export const dynamic = "force-dynamic";
+
+type Params = {
+  path: string[];
+};
+
+// 中継するリクエストヘッダ（Cookie などはそのまま API に渡さない）
+const forwardRequestHeaders = [
+  "accept",
+  "authorization",
+  "content-type",
+  "if-none-match",
+  "last-event-id",
+  "upload-offset",
+  "upload-checksum",
+];
+
+function apiBase(): string {
+  return (process.env.API_BASE_URL ?? "http://localhost:8080").replace(/\/+$/, "");
+}
+
+async function proxy(req: Request, { params }: { params: Params }): Promise<Response> {
+  const url = new URL(req.url);
+  const target = `${apiBase()}/api/${params.path.map(encodeURIComponent).join("/")}${url.search}`;
+
+  const headers = new Headers();
+  for (const name of forwardRequestHeaders) {
+    const v = req.headers.get(name);
+    if (v !== null) headers.set(name, v);
+  }
+  const key = process.env.WEB_API_KEY;
+  if (!headers.has("authorization") && key) {
+    headers.set("X-API-Key", key);
+  }
+
+  const hasBody = req.method !== "GET" && req.method !== "HEAD";
+  const res = await fetch(target, {
+    method: req.method,
+    headers,
+    body: hasBody ? req.body : undefined,
+    cache: "no-store",
+    redirect: "manual",
+    signal: req.signal,
+    // ストリームの本文（アップロード）を送るのに必要
+    ...(hasBody ? { duplex: "half" } : {}),
+  } as RequestInit);
+
+  // SSE やダウンロードもそのままストリームで返す
+  const out = new Headers(res.headers);
+  out.delete("content-encoding");
+  out.delete("content-length");
+  out.delete("transfer-encoding");
+  return new Response(res.body, { status: res.status, statusText: res.statusText, headers: out });
+}
+
+export const GET = proxy;
+export const HEAD = proxy;
+export const POST = proxy;
+export const PUT = proxy;
+export const PATCH = proxy;
+export const DELETE = proxy;
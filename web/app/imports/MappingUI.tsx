@@ -1,16 +1,26 @@
 "use client";
 
-import { useEffect, useMemo, useState } from "react";
+import { useEffect, useMemo, useRef, useState } from "react";
 import { listTemplates, createTemplate, deleteTemplate, TemplateItem } from "./templatesApi";
+import {
+  getImportMappings,
+  putImportMappings,
+  suggestMappings,
+  ImportMapping,
+} from "./importMappingsApi";
 
 type Props = {
   sourceHeaders: string[];
   rows: string[][]; // プレビュー用（先頭N行）
   schema: readonly string[];
   apiBase: string; // APIベースURL（親から渡す）
+  importId?: string; // サーバに保存されたインポート（マッピングの保存/再開に使う）
 };
 
 type Rules = Record<string, string | null>;
+type Suggested = { rules: Rules; confidence: Record<string, number> };
+
+const SCHEMA_KEY = "orders_v1";
 
 function normalizeKey(s: string) {
   return s
@@ -33,14 +43,48 @@ function guessRules(schema: readonly string[], headers: string[]): Rules {
   return rules as Rules;
 }
 
+// サーバのサジェストが使えない時のフォールバック
+function localSuggest(schema: readonly string[], headers: string[]): Suggested {
+  const rules = guessRules(schema, headers);
+  const confidence: Record<string, number> = {};
+  Object.entries(rules).forEach(([dest, src]) => {
+    confidence[dest] = src === null ? 0 : normalizeKey(src) === normalizeKey(dest) ? 0.9 : 0.5;
+  });
+  return { rules, confidence };
+}
+
+// dest -> source の rules を、サーバ保存用の source 単位の判断に変換する
+function toImportMappings(
+  sourceHeaders: string[],
+  rules: Rules,
+  suggested: Suggested
+): ImportMapping[] {
+  const destOf = (r: Rules, src: string) =>
+    Object.entries(r).find(([, v]) => v === src)?.[0] ?? null;
+  return sourceHeaders.map((src) => {
+    const s = destOf(suggested.rules, src);
+    return {
+      source: src,
+      target: destOf(rules, src),
+      suggested: s,
+      confidence: s === null ? 0 : (suggested.confidence[s] ?? 0),
+    };
+  });
+}
+
 function toCSV(headers: string[], rows: string[][]) {
   const esc = (s: string) => (/[",\n]/.test(s) ? `"${s.replace(/"/g, '""')}"` : s);
   const lines = [headers.map(esc).join(","), ...rows.map((r) => r.map(esc).join(","))];
   return lines.join("\n");
 }
 
-export default function MappingUI({ sourceHeaders, rows, schema, apiBase }: Props) {
+export default function MappingUI({ sourceHeaders, rows, schema, apiBase, importId }: Props) {
   const [rules, setRules] = useState<Rules>(() => guessRules(schema, sourceHeaders));
+  const [suggested, setSuggested] = useState<Suggested>(() =>
+    localSuggest(schema, sourceHeaders)
+  );
+  const restored = useRef(false); // 保存済みマッピングを復元したらサジェストで上書きしない
+  const [savedAt, setSavedAt] = useState<string | null>(null);
   const [preview, setPreview] = useState<{ headers: string[]; rows: string[][] } | null>(null);
   const [loading, setLoading] = useState(false);
 
@@ -52,11 +96,68 @@ export default function MappingUI({ sourceHeaders, rows, schema, apiBase }: Prop
   const [selectedTplId, setSelectedTplId] = useState<string>(""); // ★ 追加
 
   useEffect(() => {
-    setRules(guessRules(schema, sourceHeaders));
+    const local = localSuggest(schema, sourceHeaders);
+    setSuggested(local);
+    setRules(local.rules);
     setPreview(null);
+
+    // 学習済みの別名を使うサーバ側サジェスト（失敗したらローカル推定のまま）
+    let cancelled = false;
+    suggestMappings(apiBase, SCHEMA_KEY, schema, sourceHeaders)
+      .then((data) => {
+        if (cancelled) return;
+        const next: Suggested = { rules: data.rules as Rules, confidence: {} };
+        data.suggestions.forEach((s) => {
+          next.confidence[s.field] = s.confidence;
+        });
+        setSuggested(next);
+        if (!restored.current) setRules(next.rules);
+      })
+      .catch((e) => console.error(e));
+    return () => {
+      cancelled = true;
+    };
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, [sourceHeaders.join("|")]);
 
+  // 保存済みのマッピングがあれば復元（別セッションからの再開）
+  useEffect(() => {
+    if (!importId) return;
+    let cancelled = false;
+    getImportMappings(apiBase, importId)
+      .then((data) => {
+        if (cancelled || data.mappings.length === 0) return;
+        const next: Rules = {} as Rules;
+        schema.forEach((k) => {
+          next[k] = data.mappings.find((m) => m.target === k)?.source ?? null;
+        });
+        restored.current = true;
+        setRules(next);
+        setSavedAt(data.updatedAt ?? null);
+      })
+      .catch((e) => console.error(e));
+    return () => {
+      cancelled = true;
+    };
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [importId]);
+
+  const onSaveMappings = async () => {
+    if (!importId) return;
+    try {
+      const data = await putImportMappings(
+        apiBase,
+        importId,
+        SCHEMA_KEY,
+        toImportMappings(sourceHeaders, rules, suggested)
+      );
+      setSavedAt(data.updatedAt ?? null);
+    } catch (e) {
+      const msg = e instanceof Error ? e.message : "Unknown error";
+      alert(`Save mapping failed: ${msg}`);
+    }
+  };
+
   const options = useMemo(() => ["", ...sourceHeaders], [sourceHeaders]); // "" は未割当
 
   const onApply = async () => {
@@ -146,7 +247,7 @@ export default function MappingUI({ sourceHeaders, rows, schema, apiBase }: Prop
     try {
       const { id } = await createTemplate(apiBase, {
         name: tplName.trim(),
-        schema_key: "orders_v1",
+        schema_key: SCHEMA_KEY,
         rules: cleaned,
         description: tplDesc || undefined,
       });
@@ -219,6 +320,16 @@ export default function MappingUI({ sourceHeaders, rows, schema, apiBase }: Prop
           >
             {loading ? "Applying..." : "Apply mapping (server)"}
           </button>
+          {importId && (
+            <button className="rounded-lg border px-4 py-2" onClick={onSaveMappings}>
+              Save progress
+            </button>
+          )}
+          {savedAt && (
+            <span className="self-center text-xs text-gray-500">
+              saved {new Date(savedAt).toLocaleString()}
+            </span>
+          )}
         </div>
       </div>
 
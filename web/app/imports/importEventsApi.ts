@@ -0,0 +1,81 @@
+// web/app/imports/importEventsApi.ts
+// GET /api/imports/{id}/events（SSE）の購読
+// EventSource はヘッダを付けられないので fetch のストリームで読む（Last-Event-ID を自分で管理して送るため）
+
+export type ImportEvent = {
+  id: number;
+  import_id: string;
+  job_id?: string;
+  type: "status" | "queued" | "phase" | "progress" | "retry" | "completed" | "failed" | "cancelled";
+  data: {
+    phase?: string;
+    status?: string;
+    progress?: number;
+    rows_total?: number;
+    rows_done?: number;
+    rows_failed?: number;
+    error?: string;
+    result?: unknown;
+  };
+  created_at: string;
+};
+
+// subscribeImportEvents は切断されたら SSE の id 行（再開位置）から再接続する。戻り値で購読をやめる
+// 再開位置より後のイベントは再送されることがあるので、イベントの id で重複を除く
+export function subscribeImportEvents(
+  apiBase: string,
+  importId: string,
+  onEvent: (ev: ImportEvent) => void,
+  onError?: (err: unknown) => void
+): () => void {
+  const ctrl = new AbortController();
+  let lastId = 0;
+  const seen = new Set<number>();
+  let retryMs = 3000;
+
+  const connect = async () => {
+    while (!ctrl.signal.aborted) {
+      try {
+        const headers: Record<string, string> = { Accept: "text/event-stream" };
+        if (lastId > 0) headers["Last-Event-ID"] = String(lastId);
+        const res = await fetch(`${apiBase}/api/imports/${importId}/events`, {
+          headers,
+          cache: "no-store",
+          signal: ctrl.signal,
+        });
+        if (!res.ok || !res.body) throw new Error(await res.text());
+
+        const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+        let buf = "";
+        for (;;) {
+          const { value, done } = await reader.read();
+          if (done) break;
+          buf += value;
+          let sep: number;
+          while ((sep = buf.indexOf("\n\n")) >= 0) {
+            const block = buf.slice(0, sep);
+            buf = buf.slice(sep + 2);
+            let data = "";
+            for (const line of block.split("\n")) {
+              if (line.startsWith("data: ")) data += line.slice(6);
+              else if (line.startsWith("id: ")) lastId = Number(line.slice(4)) || lastId;
+              else if (line.startsWith("retry: ")) retryMs = Number(line.slice(7)) || retryMs;
+              // ":" で始まる行は keep-alive
+            }
+            if (!data) continue;
+            const ev = JSON.parse(data) as ImportEvent;
+            if (seen.has(ev.id)) continue;
+            seen.add(ev.id);
+            onEvent(ev);
+          }
+        }
+      } catch (e) {
+        if (ctrl.signal.aborted) return;
+        onError?.(e);
+      }
+      await new Promise((r) => setTimeout(r, retryMs));
+    }
+  };
+  void connect();
+  return () => ctrl.abort();
+}
@@ -0,0 +1,62 @@
+// web/app/imports/importMappingsApi.ts
+
+export type ImportMapping = {
+  source: string;
+  target: string | null;
+  suggested?: string | null;
+  confidence: number;
+  isOverride?: boolean;
+};
+
+export type ImportMappings = {
+  importId: string;
+  status: string;
+  mappings: ImportMapping[];
+  updatedAt?: string;
+};
+
+export async function getImportMappings(apiBase: string, importId: string): Promise<ImportMappings> {
+  const res = await fetch(`${apiBase}/api/imports/${importId}/mappings`, {
+    cache: "no-store",
+  });
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
+
+export async function putImportMappings(
+  apiBase: string,
+  importId: string,
+  schemaKey: string,
+  mappings: ImportMapping[]
+): Promise<ImportMappings> {
+  const res = await fetch(`${apiBase}/api/imports/${importId}/mappings`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ schemaKey, mappings }),
+  });
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
+
+export type Suggestion = {
+  field: string;
+  source: string | null;
+  confidence: number;
+  reason: "alias" | "exact" | "partial" | "none";
+  aliasId?: string;
+};
+
+export async function suggestMappings(
+  apiBase: string,
+  schemaKey: string,
+  fields: readonly string[],
+  headers: string[]
+): Promise<{ suggestions: Suggestion[]; rules: Record<string, string | null> }> {
+  const res = await fetch(`${apiBase}/api/mappings/suggest`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ schemaKey, fields, headers }),
+  });
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
@@ -1,12 +1,16 @@
 "use client";
-import React, { useEffect, useMemo, useState } from "react";
+import React, { useEffect, useState } from "react";
 import MappingUI from "./MappingUI";
 import { ORDER_SCHEMA_V1 } from "./schema";
 
 type Preview = {
+  importId?: string;
+  rowCount?: number;
   delimiter: string;
   hasHeader: boolean;
   headers: string[];
+  // 列ごとの元の表記・正規化したキー・推定した型
+  columns?: { index: number; original: string; normalized: string; inferredType: string }[];
   sampleRows: string[][];
   countGuessed: number;
 };
@@ -25,13 +29,8 @@ export default function ImportPage() {
   const [sampleError, setSampleError] = useState<string | null>(null);
   const [loadingSamples, setLoadingSamples] = useState(true);
 
-  // 環境変数が無い場合のフォールバック（ローカル直叩き）
-  const apiBase = useMemo(() => {
-    return (
-      process.env.NEXT_PUBLIC_API_BASE_URL ??
-      (typeof window !== "undefined" ? "http://localhost:8080" : "")
-    );
-  }, []);
+  // API は同じオリジンの /api（app/api/[...path] が API キーを付けて Go API に中継する）
+  const apiBase = "";
 
   useEffect(() => {
     let cancelled = false;
@@ -86,7 +85,10 @@ export default function ImportPage() {
       // ヘッダ上書きが選ばれていたらクエリで通知（API側対応済/対応予定どちらでもOK）
       const qs = forceHasHeader === null ? "" : `?hasHeader=${forceHasHeader ? "true" : "false"}`;
 
-      const res = await fetch(`${apiBase}/api/imports`, { method: "POST", body: fd });
+      const res = await fetch(`${apiBase}/api/imports`, {
+        method: "POST",
+        body: fd,
+      });
       if (!res.ok) throw new Error(await res.text());
 
       const data: Preview = await res.json();
@@ -106,12 +108,6 @@ export default function ImportPage() {
     <main className="p-6 space-y-6">
       <h1 className="text-2xl font-bold">CSV Import Preview</h1>
 
-      {apiBase === "" && (
-        <p className="text-sm text-red-600">
-          NEXT_PUBLIC_API_BASE_URL が未設定です。ローカルなら <code>http://localhost:8080</code>{" "}
-          を想定します。
-        </p>
-      )}
 
       <section className="rounded border border-gray-200 bg-gray-50 p-4 space-y-2">
         <h2 className="font-semibold">サンプルCSVをダウンロード</h2>
@@ -146,7 +142,7 @@ export default function ImportPage() {
       <form onSubmit={onSubmit} className="space-y-3">
         <input
           type="file"
-          accept=".csv,text/csv,application/vnd.ms-excel"
+          accept=".csv,.txt,.json,.ndjson,.jsonl,.ods,.xls,text/csv,application/json,application/x-ndjson,application/vnd.ms-excel,application/vnd.oasis.opendocument.spreadsheet"
           onChange={(e) => setFile(e.target.files?.[0] ?? null)}
           className="block"
         />
@@ -198,11 +194,18 @@ export default function ImportPage() {
           <table className="min-w-[800px] border-collapse">
             <thead>
               <tr>
-                {preview.headers.map((h, i) => (
-                  <th key={i} className="border px-2 py-1 text-left bg-gray-50">
-                    {h}
-                  </th>
-                ))}
+                {preview.headers.map((h, i) => {
+                  const col = preview.columns?.[i];
+                  return (
+                    <th
+                      key={i}
+                      className="border px-2 py-1 text-left bg-gray-50"
+                      title={col ? `${col.normalized} (${col.inferredType})` : undefined}
+                    >
+                      {col?.original || h}
+                    </th>
+                  );
+                })}
               </tr>
             </thead>
             <tbody>
@@ -226,6 +229,7 @@ export default function ImportPage() {
             rows={preview.sampleRows ?? []}
             schema={ORDER_SCHEMA_V1}
             apiBase={apiBase}
+            importId={preview.importId}
           />
         </div>
       )}
@@ -1,4 +1,5 @@
 // web/app/imports/templatesApi.ts
+
 export type TemplateItem = {
   id: string;
   name: string;
@@ -10,7 +11,9 @@ export type TemplateItem = {
 };
 
 export async function listTemplates(apiBase: string): Promise<TemplateItem[]> {
-  const res = await fetch(`${apiBase}/api/templates`, { cache: "no-store" });
+  const res = await fetch(`${apiBase}/api/templates`, {
+    cache: "no-store",
+  });
   if (!res.ok) throw new Error(await res.text());
   return res.json();
 }
@@ -29,6 +32,8 @@ export async function createTemplate(
 }
 
 export async function deleteTemplate(apiBase: string, id: string): Promise<void> {
-  const res = await fetch(`${apiBase}/api/templates/${id}`, { method: "DELETE" });
+  const res = await fetch(`${apiBase}/api/templates/${id}`, {
+    method: "DELETE",
+  });
   if (!res.ok) throw new Error(await res.text());
 }